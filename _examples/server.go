@@ -62,13 +62,21 @@ func (s *backend) PutCalendarObject(
 	path string,
 	calendar *ical.Calendar,
 	opts *caldav.PutCalendarObjectOptions,
-) (*caldav.CalendarObject, error) {
+) (*caldav.PutCalendarObjectResult, error) {
 	object := caldav.CalendarObject{
 		Path: path,
 		Data: calendar,
 	}
-	s.objectMap[path] = append(s.objectMap[path], object)
-	return &object, nil
+	calPath := path[:strings.LastIndex(path, "/")+1]
+	objs := s.objectMap[calPath]
+	for i := range objs {
+		if objs[i].Path == path {
+			objs[i] = object
+			return &caldav.PutCalendarObjectResult{CalendarObject: object}, nil
+		}
+	}
+	s.objectMap[calPath] = append(objs, object)
+	return &caldav.PutCalendarObjectResult{CalendarObject: object, Created: true}, nil
 }
 
 func (s *backend) ListCalendarObjects(
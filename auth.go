@@ -0,0 +1,460 @@
+package webdav
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// replayRequest returns a copy of req with a fresh body, suitable for sending
+// the request a second time. It returns nil if the body can't be replayed.
+func replayRequest(req *http.Request) *http.Request {
+	clone := req.Clone(req.Context())
+	if req.Body == nil || req.Body == http.NoBody {
+		return clone
+	}
+	if req.GetBody == nil {
+		return nil
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil
+	}
+	clone.Body = body
+	return clone
+}
+
+// discardResponse drains and closes a response body, so that the underlying
+// connection can be reused.
+func discardResponse(resp *http.Response) {
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 4096))
+	resp.Body.Close()
+}
+
+type hostScopeHTTPClient struct {
+	c, fallback HTTPClient
+	hosts       map[string]bool
+}
+
+type hostScopeContextKey struct{}
+
+// defaultHTTPClient is used by the HTTP clients adding credentials to
+// requests when no HTTPClient is provided. It doesn't follow redirects out of
+// the scope of HTTPClientWithHostScope.
+var defaultHTTPClient = &http.Client{CheckRedirect: checkRedirectHostScope}
+
+// checkRedirectHostScope is an http.Client.CheckRedirect function which stops
+// at redirects to hosts out of the scope of the request, if any. The
+// redirect response is then returned to HTTPClientWithHostScope, which
+// follows it without credentials.
+func checkRedirectHostScope(req *http.Request, via []*http.Request) error {
+	if c, ok := req.Context().Value(hostScopeContextKey{}).(*hostScopeHTTPClient); ok && !c.inScope(req.URL) {
+		return http.ErrUseLastResponse
+	}
+	// Same limit as the net/http default policy
+	if len(via) >= 10 {
+		return errors.New("stopped after 10 redirects")
+	}
+	return nil
+}
+
+func (c *hostScopeHTTPClient) inScope(u *url.URL) bool {
+	return c.hosts[strings.ToLower(u.Host)] || c.hosts[strings.ToLower(u.Hostname())]
+}
+
+func (c *hostScopeHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	if !c.inScope(req.URL) {
+		return c.fallback.Do(req)
+	}
+
+	// Replayed if the request needs to be redirected out of scope
+	next := replayRequest(req)
+
+	ctx := context.WithValue(req.Context(), hostScopeContextKey{}, c)
+	resp, err := c.c.Do(req.WithContext(ctx))
+	if err != nil || next == nil {
+		return resp, err
+	}
+
+	loc, err := resp.Location()
+	if err != nil || c.inScope(loc) {
+		return resp, nil
+	}
+	switch resp.StatusCode {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther:
+		if next.Method != http.MethodGet && next.Method != http.MethodHead {
+			next.Method = http.MethodGet
+			next.Body = nil
+			next.GetBody = nil
+			next.ContentLength = 0
+			next.Header.Del("Content-Type")
+		}
+	case http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+	default:
+		return resp, nil
+	}
+	discardResponse(resp)
+
+	next.URL = loc
+	next.Host = ""
+	next.Header.Del("Authorization")
+	next.Header.Del("Cookie")
+	return c.fallback.Do(next)
+}
+
+// HTTPClientWithHostScope returns an HTTP client which only sends requests
+// through c when their host is one of hosts. Requests to other hosts are sent
+// through fallback. If fallback is nil, http.DefaultClient is used.
+//
+// This can be used to prevent credentials attached by c from leaking to
+// other hosts, e.g. when following redirects during service discovery. Hosts
+// can include a port, in which case only requests to that port match.
+//
+// The scope is enforced on each redirect: redirects to other hosts are
+// followed through fallback. This requires c not to follow them itself,
+// which is the case of the clients returned by HTTPClientWithBasicAuth,
+// HTTPClientWithDigestAuth and HTTPClientWithBearerToken when they are
+// given a nil HTTPClient. Custom *http.Client values should stop at such
+// redirects with their CheckRedirect function.
+func HTTPClientWithHostScope(c, fallback HTTPClient, hosts ...string) HTTPClient {
+	if fallback == nil {
+		fallback = http.DefaultClient
+	}
+	m := make(map[string]bool, len(hosts))
+	for _, host := range hosts {
+		m[strings.ToLower(host)] = true
+	}
+	return &hostScopeHTTPClient{c, fallback, m}
+}
+
+// TokenSource supplies OAuth 2.0 bearer tokens.
+type TokenSource interface {
+	// Token returns the current access token.
+	Token(ctx context.Context) (string, error)
+	// RefreshToken obtains a new access token. It's called when the server
+	// rejects the current one.
+	RefreshToken(ctx context.Context) (string, error)
+}
+
+type bearerHTTPClient struct {
+	c  HTTPClient
+	ts TokenSource
+}
+
+func (c *bearerHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+
+	token, err := c.ts.Token(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("webdav: failed to get bearer token: %w", err)
+	}
+
+	// Keep a pristine copy around in case the token needs to be refreshed
+	retry := replayRequest(req)
+
+	authReq := req.Clone(ctx)
+	authReq.Header.Set("Authorization", "Bearer "+token)
+	resp, err := c.c.Do(authReq)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized || retry == nil {
+		return resp, err
+	}
+
+	token, err = c.ts.RefreshToken(ctx)
+	if err != nil {
+		// Return the original 401 response, the caller will get an
+		// HTTPError out of it
+		return resp, nil
+	}
+	discardResponse(resp)
+
+	retry.Header.Set("Authorization", "Bearer "+token)
+	return c.c.Do(retry)
+}
+
+// HTTPClientWithBearerToken returns an HTTP client that adds OAuth 2.0 bearer
+// token authentication to all outgoing requests, as defined in RFC 6750. If
+// the server replies with 401 Unauthorized, the token is refreshed and the
+// request is retried once, provided the request body can be replayed (see
+// http.Request.GetBody). If c is nil, a default client is used.
+func HTTPClientWithBearerToken(c HTTPClient, ts TokenSource) HTTPClient {
+	if c == nil {
+		c = defaultHTTPClient
+	}
+	return &bearerHTTPClient{c, ts}
+}
+
+// digestChallenge is a parsed Digest WWW-Authenticate challenge.
+type digestChallenge struct {
+	realm, nonce, opaque, algorithm string
+	qopAuth, stale                  bool
+}
+
+func (ch *digestChallenge) hash() func() hash.Hash {
+	switch strings.ToUpper(strings.TrimSuffix(strings.ToLower(ch.algorithm), "-sess")) {
+	case "", "MD5":
+		return md5.New
+	case "SHA-256":
+		return sha256.New
+	}
+	return nil
+}
+
+func (ch *digestChallenge) sess() bool {
+	return strings.HasSuffix(strings.ToLower(ch.algorithm), "-sess")
+}
+
+// parseAuthParams parses a comma-separated list of auth-params, as defined in
+// RFC 7235 section 2.1.
+func parseAuthParams(s string) map[string]string {
+	params := make(map[string]string)
+	for {
+		s = strings.TrimLeft(s, " \t,")
+		if s == "" {
+			return params
+		}
+
+		i := strings.IndexByte(s, '=')
+		if i < 0 {
+			return params
+		}
+		k := strings.ToLower(strings.TrimSpace(s[:i]))
+		s = strings.TrimLeft(s[i+1:], " \t")
+
+		var v string
+		if strings.HasPrefix(s, `"`) {
+			var sb strings.Builder
+			s = s[1:]
+			for len(s) > 0 && s[0] != '"' {
+				if s[0] == '\\' && len(s) > 1 {
+					s = s[1:]
+				}
+				sb.WriteByte(s[0])
+				s = s[1:]
+			}
+			s = strings.TrimPrefix(s, `"`)
+			v = sb.String()
+		} else {
+			i := strings.IndexByte(s, ',')
+			if i < 0 {
+				i = len(s)
+			}
+			v = strings.TrimSpace(s[:i])
+			s = s[i:]
+		}
+		params[k] = v
+	}
+}
+
+// parseDigestChallenge picks the strongest supported Digest challenge in
+// the WWW-Authenticate headers.
+func parseDigestChallenge(h http.Header) *digestChallenge {
+	var best *digestChallenge
+	for _, v := range h[http.CanonicalHeaderKey("WWW-Authenticate")] {
+		i := strings.IndexAny(v, " \t")
+		if i < 0 || !strings.EqualFold(v[:i], "Digest") {
+			continue
+		}
+		params := parseAuthParams(v[i+1:])
+
+		ch := &digestChallenge{
+			realm:     params["realm"],
+			nonce:     params["nonce"],
+			opaque:    params["opaque"],
+			algorithm: params["algorithm"],
+			stale:     strings.EqualFold(params["stale"], "true"),
+		}
+		if ch.nonce == "" || ch.hash() == nil {
+			continue
+		}
+		if qop, ok := params["qop"]; ok {
+			for _, q := range strings.Split(qop, ",") {
+				if strings.EqualFold(strings.TrimSpace(q), "auth") {
+					ch.qopAuth = true
+				}
+			}
+			if !ch.qopAuth {
+				// Only auth-int is offered, which we don't support
+				continue
+			}
+		}
+
+		if best == nil || strings.HasPrefix(strings.ToUpper(ch.algorithm), "SHA-256") {
+			best = ch
+		}
+	}
+	return best
+}
+
+// digestAuthorization computes the Authorization header value for a request.
+func digestAuthorization(ch *digestChallenge, username, password, method, uri, cnonce string, nc uint32) string {
+	newHash := ch.hash()
+	h := func(s string) string {
+		hh := newHash()
+		io.WriteString(hh, s)
+		return hex.EncodeToString(hh.Sum(nil))
+	}
+
+	ha1 := h(username + ":" + ch.realm + ":" + password)
+	if ch.sess() {
+		ha1 = h(ha1 + ":" + ch.nonce + ":" + cnonce)
+	}
+	ha2 := h(method + ":" + uri)
+
+	ncStr := fmt.Sprintf("%08x", nc)
+	var response string
+	if ch.qopAuth {
+		response = h(ha1 + ":" + ch.nonce + ":" + ncStr + ":" + cnonce + ":auth:" + ha2)
+	} else {
+		response = h(ha1 + ":" + ch.nonce + ":" + ha2)
+	}
+
+	quote := func(s string) string {
+		return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+	}
+
+	params := []string{
+		"username=" + quote(username),
+		"realm=" + quote(ch.realm),
+		"uri=" + quote(uri),
+		"nonce=" + quote(ch.nonce),
+	}
+	if ch.algorithm != "" {
+		params = append(params, "algorithm="+ch.algorithm)
+	}
+	params = append(params, "response="+quote(response))
+	if ch.qopAuth {
+		params = append(params, "qop=auth", "nc="+ncStr, "cnonce="+quote(cnonce))
+	}
+	if ch.opaque != "" {
+		params = append(params, "opaque="+quote(ch.opaque))
+	}
+	return "Digest " + strings.Join(params, ", ")
+}
+
+type digestAuthHTTPClient struct {
+	c                  HTTPClient
+	username, password string
+
+	mu        sync.Mutex
+	challenge *digestChallenge
+	nc        uint32
+}
+
+// authorize adds an Authorization header to req, using the cached challenge.
+// It returns the challenge used, if any.
+func (c *digestAuthHTTPClient) authorize(req *http.Request) (*digestChallenge, error) {
+	c.mu.Lock()
+	ch := c.challenge
+	c.nc++
+	nc := c.nc
+	c.mu.Unlock()
+
+	if ch == nil {
+		return nil, nil
+	}
+
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return nil, err
+	}
+	cnonce := hex.EncodeToString(b[:])
+
+	auth := digestAuthorization(ch, c.username, c.password, req.Method, req.URL.RequestURI(), cnonce, nc)
+	req.Header.Set("Authorization", auth)
+	return ch, nil
+}
+
+func (c *digestAuthHTTPClient) setChallenge(ch *digestChallenge) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.challenge = ch
+	c.nc = 0
+}
+
+// fetchChallenge sends a body-less request to obtain a challenge, for
+// requests whose body can't be replayed.
+func (c *digestAuthHTTPClient) fetchChallenge(req *http.Request) error {
+	preflight, err := http.NewRequestWithContext(req.Context(), http.MethodOptions, req.URL.String(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.c.Do(preflight)
+	if err != nil {
+		return err
+	}
+	discardResponse(resp)
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		if ch := parseDigestChallenge(resp.Header); ch != nil {
+			c.setChallenge(ch)
+		}
+	}
+	return nil
+}
+
+func (c *digestAuthHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	retry := replayRequest(req)
+
+	c.mu.Lock()
+	hasChallenge := c.challenge != nil
+	c.mu.Unlock()
+	if !hasChallenge && retry == nil {
+		if err := c.fetchChallenge(req); err != nil {
+			return nil, err
+		}
+	}
+
+	authReq := req.Clone(req.Context())
+	used, err := c.authorize(authReq)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.c.Do(authReq)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	ch := parseDigestChallenge(resp.Header)
+	if ch == nil {
+		return resp, nil
+	}
+	c.setChallenge(ch)
+	if retry == nil || (used != nil && used.nonce == ch.nonce && !ch.stale) {
+		// Either the request can't be replayed, or the credentials were
+		// rejected and retrying won't help
+		return resp, nil
+	}
+	discardResponse(resp)
+
+	if _, err := c.authorize(retry); err != nil {
+		return nil, err
+	}
+	return c.c.Do(retry)
+}
+
+// HTTPClientWithDigestAuth returns an HTTP client that adds HTTP Digest
+// authentication to all outgoing requests, as defined in RFC 7616. The MD5
+// and SHA-256 algorithms are supported, with the "auth" quality of
+// protection.
+//
+// The server nonce is cached and reused for subsequent requests. Requests are
+// retried once when the server sends a new challenge, provided the request
+// body can be replayed (see http.Request.GetBody). If c is nil, a default
+// client is used.
+func HTTPClientWithDigestAuth(c HTTPClient, username, password string) HTTPClient {
+	if c == nil {
+		c = defaultHTTPClient
+	}
+	return &digestAuthHTTPClient{c: c, username: username, password: password}
+}
@@ -0,0 +1,208 @@
+package webdav
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// https://tools.ietf.org/html/rfc7616#section-3.9.1
+func TestDigestAuthorization(t *testing.T) {
+	tests := []struct {
+		algorithm, response string
+	}{
+		{"MD5", "8ca523f5e9506fed4657c9700eebdbec"},
+		{"SHA-256", "753927fa0e85d155564e2e272a28d1802ca10daf4496794697cf8db5856cb6c1"},
+	}
+
+	for _, tc := range tests {
+		h := make(http.Header)
+		h.Add("WWW-Authenticate", `Digest realm="http-auth@example.org", qop="auth, auth-int", algorithm=`+tc.algorithm+`, nonce="7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v", opaque="FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS"`)
+		ch := parseDigestChallenge(h)
+		if ch == nil {
+			t.Fatalf("parseDigestChallenge() = nil")
+		}
+
+		auth := digestAuthorization(ch, "Mufasa", "Circle of Life", "GET", "/dir/index.html", "f2/wE4q74E6zIJEtWaHKaf5wv/H5QzzpXusqGemxURZJ", 1)
+		if !strings.Contains(auth, `response="`+tc.response+`"`) {
+			t.Errorf("digestAuthorization() with %v = %q, expected response %q", tc.algorithm, auth, tc.response)
+		}
+	}
+}
+
+func TestHTTPClientWithDigestAuth(t *testing.T) {
+	var requests, authorized int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "Digest ") {
+			w.Header().Add("WWW-Authenticate", `Digest realm="test", qop="auth", algorithm=SHA-256, nonce="abc"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		authorized++
+	}))
+	defer srv.Close()
+
+	c := HTTPClientWithDigestAuth(nil, "user", "pass")
+	for i := 0; i < 2; i++ {
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodPut, srv.URL+"/file", strings.NewReader("hello"))
+		if err != nil {
+			t.Fatalf("NewRequest() = %v", err)
+		}
+		resp, err := c.Do(req)
+		if err != nil {
+			t.Fatalf("Do() = %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("Do() status = %v, expected 200", resp.StatusCode)
+		}
+	}
+
+	// The nonce is cached after the first challenge
+	if requests != 3 || authorized != 2 {
+		t.Errorf("got %v requests and %v authorized, expected 3 and 2", requests, authorized)
+	}
+}
+
+func TestHTTPClientWithHostScope(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, _, ok := r.BasicAuth(); ok {
+			w.WriteHeader(http.StatusTeapot)
+		}
+	}))
+	defer srv.Close()
+
+	c := HTTPClientWithHostScope(HTTPClientWithBasicAuth(nil, "user", "pass"), nil, "example.org")
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, srv.URL, nil)
+	if err != nil {
+		t.Fatalf("NewRequest() = %v", err)
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		t.Fatalf("Do() = %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusTeapot {
+		t.Errorf("credentials sent to a host out of scope")
+	}
+}
+
+func TestHTTPClientWithHostScope_redirect(t *testing.T) {
+	outside := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, _, ok := r.BasicAuth(); ok {
+			w.WriteHeader(http.StatusTeapot)
+		}
+	}))
+	defer outside.Close()
+
+	inside := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, _, ok := r.BasicAuth(); !ok {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		http.Redirect(w, r, outside.URL+"/file", http.StatusFound)
+	}))
+	defer inside.Close()
+
+	host := strings.TrimPrefix(inside.URL, "http://")
+	c := HTTPClientWithHostScope(HTTPClientWithBasicAuth(nil, "user", "pass"), nil, host)
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, inside.URL, nil)
+	if err != nil {
+		t.Fatalf("NewRequest() = %v", err)
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		t.Fatalf("Do() = %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusTeapot {
+		t.Errorf("credentials sent to a host out of scope after a redirect")
+	} else if resp.StatusCode != http.StatusOK {
+		t.Errorf("Do() = %v, expected %v", resp.StatusCode, http.StatusOK)
+	}
+}
+
+type testTokenSource struct {
+	token      string
+	refreshed  string
+	refreshErr error
+	refreshes  int
+}
+
+func (ts *testTokenSource) Token(ctx context.Context) (string, error) {
+	return ts.token, nil
+}
+
+func (ts *testTokenSource) RefreshToken(ctx context.Context) (string, error) {
+	ts.refreshes++
+	if ts.refreshErr != nil {
+		return "", ts.refreshErr
+	}
+	ts.token = ts.refreshed
+	return ts.token, nil
+}
+
+func TestHTTPClientWithBearerToken(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		token      string
+		refreshErr error
+		noReplay   bool
+		status     int
+		requests   int
+		refreshes  int
+	}{
+		{name: "valid", token: "new", status: http.StatusOK, requests: 1},
+		{name: "expired", token: "old", status: http.StatusOK, requests: 2, refreshes: 1},
+		{name: "refresh-error", token: "old", refreshErr: errors.New("refresh failed"), status: http.StatusUnauthorized, requests: 1, refreshes: 1},
+		{name: "no-replay", token: "old", noReplay: true, status: http.StatusUnauthorized, requests: 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var bodies []string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				b, _ := ioutil.ReadAll(r.Body)
+				bodies = append(bodies, string(b))
+				if r.Header.Get("Authorization") != "Bearer new" {
+					w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+					w.WriteHeader(http.StatusUnauthorized)
+				}
+			}))
+			defer srv.Close()
+
+			ts := &testTokenSource{token: tc.token, refreshed: "new", refreshErr: tc.refreshErr}
+			c := HTTPClientWithBearerToken(nil, ts)
+			req, err := http.NewRequestWithContext(context.Background(), http.MethodPut, srv.URL+"/file", strings.NewReader("hello"))
+			if err != nil {
+				t.Fatalf("NewRequest() = %v", err)
+			}
+			if tc.noReplay {
+				req.GetBody = nil
+			}
+			resp, err := c.Do(req)
+			if err != nil {
+				t.Fatalf("Do() = %v", err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != tc.status {
+				t.Errorf("Do() status = %v, expected %v", resp.StatusCode, tc.status)
+			}
+			if len(bodies) != tc.requests {
+				t.Fatalf("server got %v requests, expected %v", len(bodies), tc.requests)
+			}
+			for i, b := range bodies {
+				if b != "hello" {
+					t.Errorf("request %v has body %q, expected %q", i, b, "hello")
+				}
+			}
+			if ts.refreshes != tc.refreshes {
+				t.Errorf("token refreshed %v times, expected %v", ts.refreshes, tc.refreshes)
+			}
+		})
+	}
+}
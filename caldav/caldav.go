@@ -73,8 +73,23 @@ type Calendar struct {
 	Description           string
 	MaxResourceSize       int64
 	SupportedComponentSet []string
+	// Timezone is an iCalendar object containing a single VTIMEZONE, used
+	// to resolve floating times.
+	Timezone string
+	// Color is the display color of the calendar, e.g. "#FF0000".
+	Color string
+	// Order is the display order of the calendar, 0 if unset.
+	Order int
+	// DeadProps contains arbitrary properties set by clients.
+	DeadProps []webdav.Property
+	// SyncToken is the current sync token of the calendar, if the backend
+	// implements SyncBackend.
+	SyncToken string
 }
 
+// prodID is the PRODID of iCalendar objects generated by the server.
+const prodID = "-//emersion.fr//go-webdav//EN"
+
 type CalendarCompRequest struct {
 	Name string
 
@@ -83,6 +98,20 @@ type CalendarCompRequest struct {
 
 	AllComps bool
 	Comps    []CalendarCompRequest
+
+	// Expand, if set, requests recurring components to be expanded into
+	// their instances overlapping the time range, see ExpandCalendar. Only
+	// valid for the top-level request.
+	Expand *TimeRange
+	// LimitRecurrenceSet, if set, requests overridden instances outside of
+	// the time range to be omitted, see LimitRecurrenceSet. Only valid for
+	// the top-level request.
+	LimitRecurrenceSet *TimeRange
+}
+
+// TimeRange is a time range, with an inclusive start and an exclusive end.
+type TimeRange struct {
+	Start, End time.Time
 }
 
 type CompFilter struct {
@@ -110,11 +139,19 @@ type PropFilter struct {
 type TextMatch struct {
 	Text            string
 	NegateCondition bool
+	// Collation is the collation used to compare text: "i;octet",
+	// "i;ascii-casemap" or "i;unicode-casemap". Defaults to
+	// "i;ascii-casemap".
+	Collation string
 }
 
 type CalendarQuery struct {
 	CompRequest CalendarCompRequest
 	CompFilter  CompFilter
+	// Timezone is an iCalendar object containing a single VTIMEZONE, used
+	// to resolve floating times in time ranges. If empty, floating times are
+	// interpreted as UTC.
+	Timezone string
 }
 
 type CalendarMultiGet struct {
@@ -122,6 +159,24 @@ type CalendarMultiGet struct {
 	CompRequest CalendarCompRequest
 }
 
+// SyncQuery is a request for the changes in a calendar since a sync token, as
+// defined in RFC 6578.
+type SyncQuery struct {
+	CompRequest CalendarCompRequest
+	SyncToken   string // empty for an initial sync
+	Limit       int    // <= 0 means unlimited
+}
+
+// SyncResponse contains the changes in a calendar since a sync token.
+type SyncResponse struct {
+	SyncToken string
+	Updated   []CalendarObject
+	Deleted   []string
+	// Truncated is set if only part of the changes are returned. The
+	// remaining changes can be fetched with SyncToken.
+	Truncated bool
+}
+
 type CalendarObject struct {
 	Path          string
 	ModTime       time.Time
@@ -16,10 +16,59 @@ import (
 	"github.com/emersion/go-webdav/internal"
 )
 
-// DiscoverContextURL performs a DNS-based CardDAV service discovery as
-// described in RFC 6352 section 11. It returns the URL to the CardDAV server.
+// DiscoverContextURL performs a DNS-based CalDAV service discovery as
+// described in RFC 6764 section 3 and 4. It returns the URL to the CalDAV
+// server.
 func DiscoverContextURL(ctx context.Context, domain string) (string, error) {
-	return internal.DiscoverContextURL(ctx, "caldavs", domain)
+	return internal.DiscoverContextURL(ctx, "caldav", domain)
+}
+
+// Discovery is the result of a CalDAV service discovery.
+type Discovery struct {
+	Client *Client
+	// Endpoint is the context URL of the CalDAV server.
+	Endpoint string
+	// Principal is the path of the current user principal.
+	Principal string
+	// CalendarHomeSet is the path of the current user's calendar home set.
+	CalendarHomeSet string
+}
+
+// Discover performs the CalDAV bootstrapping procedure described in RFC 6764
+// section 6: SRV and TXT lookups, well-known URI redirect handling,
+// current-user-principal and home set lookups. It returns a client for the
+// discovered server.
+//
+// domain can either be a domain name, an e-mail address or an URL. If
+// options is nil, defaults are used.
+func Discover(ctx context.Context, c webdav.HTTPClient, domain string, options *webdav.DiscoveryOptions) (*Discovery, error) {
+	if options == nil {
+		options = new(webdav.DiscoveryOptions)
+	}
+	trace := internal.DiscoveryTrace(options.Trace)
+
+	endpoint, principal, err := internal.DiscoverPrincipal(ctx, c, options.Resolver, "caldav", domain, trace)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := NewClient(c, endpoint.String())
+	if err != nil {
+		return nil, err
+	}
+
+	homeSet, err := client.FindCalendarHomeSet(ctx, principal)
+	trace.Step("home-set", client.ic.ResolveHref(principal).String(), homeSet, err)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Discovery{
+		Client:          client,
+		Endpoint:        endpoint.String(),
+		Principal:       principal,
+		CalendarHomeSet: homeSet,
+	}, nil
 }
 
 // Client provides access to a remote CardDAV server.
@@ -155,6 +204,18 @@ func encodeCalendarReq(c *CalendarCompRequest) (*internal.Prop, error) {
 	}
 
 	calDataReq := calendarDataReq{Comp: compReq}
+	if tr := c.Expand; tr != nil {
+		calDataReq.Expand = &expand{
+			Start: dateWithUTCTime(tr.Start.UTC()),
+			End:   dateWithUTCTime(tr.End.UTC()),
+		}
+	}
+	if tr := c.LimitRecurrenceSet; tr != nil {
+		calDataReq.LimitRecurrenceSet = &limitRecurrenceSet{
+			Start: dateWithUTCTime(tr.Start.UTC()),
+			End:   dateWithUTCTime(tr.End.UTC()),
+		}
+	}
 
 	getLastModReq := internal.NewRawXMLElement(internal.GetLastModifiedName, nil, nil)
 	getETagReq := internal.NewRawXMLElement(internal.GetETagName, nil, nil)
@@ -233,6 +294,9 @@ func (c *Client) QueryCalendar(
 
 	calendarQuery := calendarQuery{Prop: propReq}
 	calendarQuery.Filter.CompFilter = *encodeCompFilter(&query.CompFilter)
+	if query.Timezone != "" {
+		calendarQuery.Timezone = &timezone{Timezone: query.Timezone}
+	}
 	req, err := c.ic.NewXMLRequest("REPORT", calendar, &calendarQuery)
 	if err != nil {
 		return nil, err
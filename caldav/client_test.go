@@ -0,0 +1,106 @@
+package caldav
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/emersion/go-webdav"
+)
+
+type testResolver struct {
+	target string
+	port   uint16
+	txt    []string
+}
+
+func (r *testResolver) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	if service != "caldavs" || proto != "tcp" || name != "example.org" {
+		return "", nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+	return "", []*net.SRV{{Target: r.target + ".", Port: r.port}}, nil
+}
+
+func (r *testResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	if name != "_caldavs._tcp.example.org" {
+		return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+	return r.txt, nil
+}
+
+func TestDiscover(t *testing.T) {
+	handler := Handler{Backend: testBackend{}}
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Some servers redirect with 301, which turns the PROPFIND into a
+		// GET if the HTTP client follows it
+		if r.URL.Path == "/moved/" {
+			http.Redirect(w, r, "/user/", http.StatusMovedPermanently)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, err := strconv.Atoi(u.Port())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		client webdav.HTTPClient
+		txt    []string
+		path   string
+	}{
+		{"well-known", srv.Client(), nil, "/.well-known/caldav"},
+		{"txt-path", srv.Client(), []string{"path=/.well-known/caldav"}, "/.well-known/caldav"},
+		{"wrapped-client-301", webdav.HTTPClientWithBasicAuth(srv.Client(), "user", "pass"), []string{"path=/moved/"}, "/moved/"},
+		{"client-301", srv.Client(), []string{"path=/moved/"}, "/moved/"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			resolver := &testResolver{target: u.Hostname(), port: uint16(port), txt: tc.txt}
+
+			var steps []webdav.DiscoveryStep
+			discovery, err := Discover(context.Background(), tc.client, "user@example.org", &webdav.DiscoveryOptions{
+				Resolver: resolver,
+				Trace: func(step *webdav.DiscoveryStep) {
+					steps = append(steps, *step)
+				},
+			})
+			if err != nil {
+				t.Fatalf("Discover() = %v, steps: %+v", err, steps)
+			}
+
+			if discovery.Principal != "/user/" {
+				t.Errorf("Discovery.Principal = %q, expected %q", discovery.Principal, "/user/")
+			}
+			if discovery.CalendarHomeSet != "/user/calendars/" {
+				t.Errorf("Discovery.CalendarHomeSet = %q, expected %q", discovery.CalendarHomeSet, "/user/calendars/")
+			}
+
+			txtResult := "no path key"
+			if tc.txt != nil {
+				txtResult = "path=" + tc.path
+			}
+			expected := []webdav.DiscoveryStep{
+				{Name: "srv", Target: "_caldavs._tcp.example.org", Result: u.Host},
+				{Name: "txt", Target: "_caldavs._tcp.example.org", Result: txtResult},
+				{Name: "principal", Target: srv.URL + tc.path, Result: "redirected to " + srv.URL + "/user/"},
+				{Name: "principal", Target: srv.URL + "/user/", Result: "/user/"},
+				{Name: "home-set", Target: srv.URL + "/user/", Result: "/user/calendars/"},
+			}
+			if !reflect.DeepEqual(steps, expected) {
+				t.Errorf("got steps:\n%+v\nexpected:\n%+v", steps, expected)
+			}
+		})
+	}
+}
@@ -10,6 +10,9 @@ import (
 
 const namespace = "urn:ietf:params:xml:ns:caldav"
 
+// appleNamespace is used by Apple extensions, supported by most clients.
+const appleNamespace = "http://apple.com/ns/ical/"
+
 var (
 	calendarHomeSetName = xml.Name{namespace, "calendar-home-set"}
 
@@ -17,12 +20,25 @@ var (
 	supportedCalendarDataName         = xml.Name{namespace, "supported-calendar-data"}
 	supportedCalendarComponentSetName = xml.Name{namespace, "supported-calendar-component-set"}
 	maxResourceSizeName               = xml.Name{namespace, "max-resource-size"}
+	calendarTimezoneName              = xml.Name{namespace, "calendar-timezone"}
+	calendarColorName                 = xml.Name{appleNamespace, "calendar-color"}
+	calendarOrderName                 = xml.Name{appleNamespace, "calendar-order"}
+
+	mkcalendarName         = xml.Name{namespace, "mkcalendar"}
+	mkcalendarResponseName = xml.Name{namespace, "mkcalendar-response"}
 
 	calendarQueryName    = xml.Name{namespace, "calendar-query"}
 	calendarMultigetName = xml.Name{namespace, "calendar-multiget"}
+	freeBusyQueryName    = xml.Name{namespace, "free-busy-query"}
 
 	calendarName     = xml.Name{namespace, "calendar"}
 	calendarDataName = xml.Name{namespace, "calendar-data"}
+
+	scheduleInboxName          = xml.Name{namespace, "schedule-inbox"}
+	scheduleOutboxName         = xml.Name{namespace, "schedule-outbox"}
+	scheduleInboxURLName       = xml.Name{namespace, "schedule-inbox-URL"}
+	scheduleOutboxURLName      = xml.Name{namespace, "schedule-outbox-URL"}
+	calendarUserAddressSetName = xml.Name{namespace, "calendar-user-address-set"}
 )
 
 // https://tools.ietf.org/html/rfc4791#section-6.2.1
@@ -35,12 +51,46 @@ func (a *calendarHomeSet) GetXMLName() xml.Name {
 	return calendarHomeSetName
 }
 
+// https://datatracker.ietf.org/doc/html/rfc6638#section-2.2.1
+type scheduleInboxURL struct {
+	XMLName xml.Name      `xml:"urn:ietf:params:xml:ns:caldav schedule-inbox-URL"`
+	Href    internal.Href `xml:"DAV: href"`
+}
+
+// https://datatracker.ietf.org/doc/html/rfc6638#section-2.1.1
+type scheduleOutboxURL struct {
+	XMLName xml.Name      `xml:"urn:ietf:params:xml:ns:caldav schedule-outbox-URL"`
+	Href    internal.Href `xml:"DAV: href"`
+}
+
+// https://datatracker.ietf.org/doc/html/rfc6638#section-2.4.1
+type calendarUserAddressSet struct {
+	XMLName xml.Name        `xml:"urn:ietf:params:xml:ns:caldav calendar-user-address-set"`
+	Hrefs   []internal.Href `xml:"DAV: href"`
+}
+
 // https://tools.ietf.org/html/rfc4791#section-5.2.1
 type calendarDescription struct {
 	XMLName     xml.Name `xml:"urn:ietf:params:xml:ns:caldav calendar-description"`
 	Description string   `xml:",chardata"`
 }
 
+// https://tools.ietf.org/html/rfc4791#section-5.2.2
+type calendarTimezone struct {
+	XMLName  xml.Name `xml:"urn:ietf:params:xml:ns:caldav calendar-timezone"`
+	Timezone string   `xml:",chardata"`
+}
+
+type calendarColor struct {
+	XMLName xml.Name `xml:"http://apple.com/ns/ical/ calendar-color"`
+	Color   string   `xml:",chardata"`
+}
+
+type calendarOrder struct {
+	XMLName xml.Name `xml:"http://apple.com/ns/ical/ calendar-order"`
+	Order   string   `xml:",chardata"`
+}
+
 // https://tools.ietf.org/html/rfc4791#section-5.2.4
 type supportedCalendarData struct {
 	XMLName xml.Name           `xml:"urn:ietf:params:xml:ns:caldav supported-calendar-data"`
@@ -73,7 +123,13 @@ type calendarQuery struct {
 	AllProp  *struct{}      `xml:"DAV: allprop,omitempty"`
 	PropName *struct{}      `xml:"DAV: propname,omitempty"`
 	Filter   filter         `xml:"filter"`
-	// TODO: timezone
+	Timezone *timezone      `xml:"timezone,omitempty"`
+}
+
+// https://tools.ietf.org/html/rfc4791#section-9.8
+type timezone struct {
+	XMLName  xml.Name `xml:"urn:ietf:params:xml:ns:caldav timezone"`
+	Timezone string   `xml:",chardata"`
 }
 
 // https://tools.ietf.org/html/rfc4791#section-9.10
@@ -85,6 +141,12 @@ type calendarMultiget struct {
 	PropName *struct{}       `xml:"DAV: propname,omitempty"`
 }
 
+// https://tools.ietf.org/html/rfc4791#section-9.11
+type freeBusyQuery struct {
+	XMLName   xml.Name  `xml:"urn:ietf:params:xml:ns:caldav free-busy-query"`
+	TimeRange timeRange `xml:"time-range"`
+}
+
 // https://tools.ietf.org/html/rfc4791#section-9.7
 type filter struct {
 	XMLName    xml.Name   `xml:"urn:ietf:params:xml:ns:caldav filter"`
@@ -179,7 +241,10 @@ func (t *dateWithUTCTime) MarshalText() ([]byte, error) {
 type calendarDataReq struct {
 	XMLName xml.Name `xml:"urn:ietf:params:xml:ns:caldav calendar-data"`
 	Comp    *comp    `xml:"comp,omitempty"`
-	// TODO: expand, limit-recurrence-set, limit-freebusy-set
+
+	Expand             *expand             `xml:"expand,omitempty"`
+	LimitRecurrenceSet *limitRecurrenceSet `xml:"limit-recurrence-set,omitempty"`
+	// TODO: limit-freebusy-set
 }
 
 // https://tools.ietf.org/html/rfc4791#section-9.6.1
@@ -194,6 +259,20 @@ type comp struct {
 	Comp    []comp    `xml:"comp,omitempty"`
 }
 
+// https://tools.ietf.org/html/rfc4791#section-9.6.5
+type expand struct {
+	XMLName xml.Name        `xml:"urn:ietf:params:xml:ns:caldav expand"`
+	Start   dateWithUTCTime `xml:"start,attr"`
+	End     dateWithUTCTime `xml:"end,attr"`
+}
+
+// https://tools.ietf.org/html/rfc4791#section-9.6.6
+type limitRecurrenceSet struct {
+	XMLName xml.Name        `xml:"urn:ietf:params:xml:ns:caldav limit-recurrence-set"`
+	Start   dateWithUTCTime `xml:"start,attr"`
+	End     dateWithUTCTime `xml:"end,attr"`
+}
+
 // https://tools.ietf.org/html/rfc4791#section-9.6.4
 type prop struct {
 	XMLName xml.Name `xml:"urn:ietf:params:xml:ns:caldav prop"`
@@ -207,10 +286,31 @@ type calendarDataResp struct {
 	Data    []byte   `xml:",chardata"`
 }
 
+// https://datatracker.ietf.org/doc/html/rfc6638#section-10.1
+type scheduleResponse struct {
+	XMLName   xml.Name                    `xml:"urn:ietf:params:xml:ns:caldav schedule-response"`
+	Responses []scheduleRecipientResponse `xml:"response"`
+}
+
+// https://datatracker.ietf.org/doc/html/rfc6638#section-10.2
+type scheduleRecipientResponse struct {
+	XMLName       xml.Name          `xml:"urn:ietf:params:xml:ns:caldav response"`
+	Recipient     scheduleRecipient `xml:"recipient"`
+	RequestStatus string            `xml:"request-status"`
+	CalendarData  *calendarDataResp `xml:"calendar-data,omitempty"`
+}
+
+// https://datatracker.ietf.org/doc/html/rfc6638#section-10.3
+type scheduleRecipient struct {
+	XMLName xml.Name      `xml:"urn:ietf:params:xml:ns:caldav recipient"`
+	Href    internal.Href `xml:"DAV: href"`
+}
+
 type reportReq struct {
-	Query    *calendarQuery
-	Multiget *calendarMultiget
-	// TODO: CALDAV:free-busy-query
+	Query          *calendarQuery
+	Multiget       *calendarMultiget
+	SyncCollection *internal.SyncCollectionQuery
+	FreeBusyQuery  *freeBusyQuery
 }
 
 func (r *reportReq) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
@@ -222,6 +322,12 @@ func (r *reportReq) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
 	case calendarMultigetName:
 		r.Multiget = &calendarMultiget{}
 		v = r.Multiget
+	case internal.SyncCollectionName:
+		r.SyncCollection = &internal.SyncCollectionQuery{}
+		v = r.SyncCollection
+	case freeBusyQueryName:
+		r.FreeBusyQuery = &freeBusyQuery{}
+		v = r.FreeBusyQuery
 	default:
 		return fmt.Errorf(
 			"caldav: unsupported REPORT root %q %q",
@@ -232,10 +338,3 @@ func (r *reportReq) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
 
 	return d.DecodeElement(v, &start)
 }
-
-type mkcolReq struct {
-	XMLName      xml.Name              `xml:"DAV: mkcol"`
-	ResourceType internal.ResourceType `xml:"set>prop>resourcetype"`
-	DisplayName  string                `xml:"set>prop>displayname"`
-	// TODO this could theoretically contain all addressbook properties?
-}
@@ -0,0 +1,173 @@
+package caldav
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-ical"
+)
+
+// FreeBusyType is the type of a busy period, as defined in RFC 5545 section
+// 3.2.9.
+type FreeBusyType string
+
+const (
+	FreeBusyBusy            FreeBusyType = "BUSY"
+	FreeBusyBusyTentative   FreeBusyType = "BUSY-TENTATIVE"
+	FreeBusyBusyUnavailable FreeBusyType = "BUSY-UNAVAILABLE"
+)
+
+// FreeBusy computes the free-busy information of a set of calendars in the
+// time range [start, end), as defined in RFC 4791 section 7.10, and returns
+// it as a VFREEBUSY component.
+//
+// Recurring events are expanded and overridden instances are taken into
+// account. Transparent and cancelled events are ignored, tentative events are
+// reported as BUSY-TENTATIVE. The busy periods of VFREEBUSY components are
+// included as well.
+//
+// Floating date and times are interpreted in loc, usually the time zone of the
+// calendar (see Calendar.Timezone). If loc is nil, UTC is used.
+func FreeBusy(cals []*ical.Calendar, start, end time.Time, loc *time.Location) (*ical.Component, error) {
+	if start.IsZero() || end.IsZero() {
+		return nil, fmt.Errorf("caldav: computing free-busy information requires a bounded time range")
+	}
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	periods := make(map[FreeBusyType][]period)
+	add := func(fbType FreeBusyType, p period) {
+		if p.start.Before(start) {
+			p.start = start
+		}
+		if p.end.After(end) {
+			p.end = end
+		}
+		periods[fbType] = append(periods[fbType], p)
+	}
+	for _, cal := range cals {
+		expanded, err := expandCalendar(cal, start, end, loc)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, comp := range expanded.Children {
+			if comp.Name == ical.CompFreeBusy {
+				if err := addFreeBusyPeriods(comp, start, end, add); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			if comp.Name != ical.CompEvent {
+				continue
+			}
+
+			fbType, ok := eventFreeBusyType(comp)
+			if !ok {
+				continue
+			}
+
+			dtstart := comp.Props.Get(ical.PropDateTimeStart)
+			if dtstart == nil {
+				continue
+			}
+			t, err := dateTime(dtstart, loc)
+			if err != nil {
+				return nil, fmt.Errorf("caldav: failed to parse DTSTART: %v", err)
+			}
+			dur, err := componentDuration(comp, t, loc)
+			if err != nil {
+				return nil, err
+			}
+			if dur <= 0 || !overlaps(t, dur, start, end) {
+				continue
+			}
+			add(fbType, period{t, t.Add(dur)})
+		}
+	}
+
+	fb := ical.NewComponent(ical.CompFreeBusy)
+	fb.Props.SetDateTime(ical.PropDateTimeStamp, time.Now().UTC())
+	fb.Props.SetDateTime(ical.PropDateTimeStart, start.UTC())
+	fb.Props.SetDateTime(ical.PropDateTimeEnd, end.UTC())
+	for _, fbType := range []FreeBusyType{FreeBusyBusy, FreeBusyBusyTentative, FreeBusyBusyUnavailable} {
+		for _, p := range mergePeriods(periods[fbType]) {
+			prop := ical.NewProp(ical.PropFreeBusy)
+			if fbType != FreeBusyBusy {
+				prop.Params.Set(ical.ParamFreeBusyType, string(fbType))
+			}
+			prop.Value = p.start.UTC().Format("20060102T150405Z") + "/" + p.end.UTC().Format("20060102T150405Z")
+			fb.Props.Add(prop)
+		}
+	}
+	return fb, nil
+}
+
+// eventFreeBusyType returns the type of busy time an event instance
+// represents, or false if it doesn't affect free-busy information.
+func eventFreeBusyType(comp *ical.Component) (FreeBusyType, bool) {
+	if transp, _ := comp.Props.Text(ical.PropTransparency); strings.EqualFold(transp, "TRANSPARENT") {
+		return "", false
+	}
+	status, _ := comp.Props.Text(ical.PropStatus)
+	switch strings.ToUpper(status) {
+	case "CANCELLED":
+		return "", false
+	case "TENTATIVE":
+		return FreeBusyBusyTentative, true
+	default:
+		return FreeBusyBusy, true
+	}
+}
+
+// addFreeBusyPeriods adds the busy periods of a VFREEBUSY component which
+// overlap the time range [start, end). Periods with an unknown FBTYPE are
+// considered busy, as required by RFC 5545 section 3.2.9.
+func addFreeBusyPeriods(comp *ical.Component, start, end time.Time, add func(FreeBusyType, period)) error {
+	for _, prop := range comp.Props[ical.PropFreeBusy] {
+		fbType := FreeBusyType(strings.ToUpper(prop.Params.Get(ical.ParamFreeBusyType)))
+		if fbType == "FREE" {
+			continue
+		} else if fbType != FreeBusyBusyTentative && fbType != FreeBusyBusyUnavailable {
+			fbType = FreeBusyBusy
+		}
+
+		for _, v := range strings.Split(prop.Value, ",") {
+			// FREEBUSY values are always in UTC
+			pstart, pend, err := parsePeriod(v, "", time.UTC)
+			if err != nil {
+				return fmt.Errorf("caldav: failed to parse FREEBUSY: %v", err)
+			}
+			if dur := pend.Sub(pstart); dur > 0 && overlaps(pstart, dur, start, end) {
+				add(fbType, period{pstart, pend})
+			}
+		}
+	}
+	return nil
+}
+
+type period struct {
+	start, end time.Time
+}
+
+// mergePeriods sorts periods and merges the overlapping ones.
+func mergePeriods(l []period) []period {
+	sort.Slice(l, func(i, j int) bool {
+		return l[i].start.Before(l[j].start)
+	})
+
+	var out []period
+	for _, p := range l {
+		if n := len(out); n > 0 && !p.start.After(out[n-1].end) {
+			if p.end.After(out[n-1].end) {
+				out[n-1].end = p.end
+			}
+			continue
+		}
+		out = append(out, p)
+	}
+	return out
+}
@@ -0,0 +1,127 @@
+package caldav
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-ical"
+)
+
+var freeBusyEvent = `BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:-//Example Corp.//CalDAV Client//EN
+BEGIN:VEVENT
+UID:%s
+DTSTAMP:20060206T001121Z
+DTSTART:%s
+DURATION:PT1H
+%sEND:VEVENT
+END:VCALENDAR
+`
+
+func TestFreeBusy(t *testing.T) {
+	newCal := func(uid, start, props string) *ical.Calendar {
+		s := fmt.Sprintf(freeBusyEvent, uid, start, props)
+		cal, err := ical.NewDecoder(strings.NewReader(strings.ReplaceAll(s, "\n", "\r\n"))).Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cal
+	}
+
+	cals := []*ical.Calendar{
+		parseRecurringEvent(t),
+		// Overlaps with the first instance of the recurring event
+		newCal("busy", "20060103T173000Z", ""),
+		newCal("tentative", "20060104T100000Z", "STATUS:TENTATIVE\n"),
+		newCal("transparent", "20060104T120000Z", "TRANSP:TRANSPARENT\n"),
+		newCal("cancelled", "20060104T140000Z", "STATUS:CANCELLED\n"),
+		// Starts before the time range
+		newCal("early", "20060102T233000Z", ""),
+	}
+
+	fb, err := FreeBusy(cals, toDate(t, "20060103T000000Z"), toDate(t, "20060106T000000Z"), nil)
+	if err != nil {
+		t.Fatalf("FreeBusy() = %v", err)
+	}
+
+	if fb.Name != ical.CompFreeBusy {
+		t.Errorf("FreeBusy() returned a %v component", fb.Name)
+	}
+	if v := fb.Props.Get(ical.PropDateTimeStart).Value; v != "20060103T000000Z" {
+		t.Errorf("FreeBusy() DTSTART = %v", v)
+	}
+
+	var got []string
+	for _, prop := range fb.Props[ical.PropFreeBusy] {
+		s := prop.Value
+		if fbType := prop.Params.Get(ical.ParamFreeBusyType); fbType != "" {
+			s = fbType + ":" + s
+		}
+		got = append(got, s)
+	}
+	expected := []string{
+		"20060103T000000Z/20060103T003000Z",
+		"20060103T170000Z/20060103T183000Z",
+		"20060105T190000Z/20060105T200000Z",
+		"BUSY-TENTATIVE:20060104T100000Z/20060104T110000Z",
+	}
+	if strings.Join(got, " ") != strings.Join(expected, " ") {
+		t.Errorf("FreeBusy() = %v, expected %v", got, expected)
+	}
+}
+
+var freeBusyCalendar = `BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:-//Example Corp.//CalDAV Client//EN
+BEGIN:VEVENT
+UID:floating
+DTSTAMP:20060206T001121Z
+DTSTART:20060104T090000
+DURATION:PT1H
+END:VEVENT
+BEGIN:VFREEBUSY
+UID:freebusy
+DTSTAMP:20060206T001121Z
+DTSTART:20060101T000000Z
+DTEND:20060110T000000Z
+FREEBUSY;FBTYPE=BUSY-UNAVAILABLE:20060105T080000Z/PT1H,20060108T080000Z/PT1H
+FREEBUSY;FBTYPE=FREE:20060105T100000Z/PT1H
+FREEBUSY;FBTYPE=X-OUT-OF-OFFICE:20060105T120000Z/20060105T130000Z
+END:VFREEBUSY
+END:VCALENDAR
+`
+
+func TestFreeBusy_floatingAndVFreeBusy(t *testing.T) {
+	cal, err := ical.NewDecoder(strings.NewReader(strings.ReplaceAll(freeBusyCalendar, "\n", "\r\n"))).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loc := time.FixedZone("EST", -5*60*60)
+	fb, err := FreeBusy([]*ical.Calendar{cal}, toDate(t, "20060103T000000Z"), toDate(t, "20060106T000000Z"), loc)
+	if err != nil {
+		t.Fatalf("FreeBusy() = %v", err)
+	}
+
+	var got []string
+	for _, prop := range fb.Props[ical.PropFreeBusy] {
+		s := prop.Value
+		if fbType := prop.Params.Get(ical.ParamFreeBusyType); fbType != "" {
+			s = fbType + ":" + s
+		}
+		got = append(got, s)
+	}
+	expected := []string{
+		// The floating event is interpreted in the calendar's time zone
+		"20060104T140000Z/20060104T150000Z",
+		// Unknown busy types are considered busy
+		"20060105T120000Z/20060105T130000Z",
+		"BUSY-UNAVAILABLE:20060105T080000Z/20060105T090000Z",
+	}
+	if strings.Join(got, " ") != strings.Join(expected, " ") {
+		t.Errorf("FreeBusy() = %v, expected %v", got, expected)
+	}
+}
@@ -1,23 +1,39 @@
 package caldav
 
 import (
+	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/emersion/go-ical"
+	"github.com/emersion/go-webdav/internal"
 )
 
 // Filter returns the filtered list of calendar objects matching the provided query.
 // A nil query will return the full list of calendar objects.
+//
+// If the query requests a subset of the calendar data, the returned objects
+// are pruned with PruneCalendar. Objects are left as-is if the request
+// expands or limits recurrence sets, since pruning could drop the properties
+// needed to do so.
 func Filter(query *CalendarQuery, cos []CalendarObject) ([]CalendarObject, error) {
 	if query == nil {
 		// FIXME: should we always return a copy of the provided slice?
 		return cos, nil
 	}
 
+	loc, err := timezoneLocation(query.Timezone)
+	if err != nil {
+		return nil, err
+	}
+
 	var out []CalendarObject
 	for _, co := range cos {
-		ok, err := Match(query.CompFilter, &co)
+		if co.Data == nil || co.Data.Component == nil {
+			panic("request to process empty calendar object")
+		}
+		ok, err := match(query.CompFilter, co.Data.Component, nil, loc)
 		if err != nil {
 			return nil, err
 		}
@@ -25,28 +41,95 @@ func Filter(query *CalendarQuery, cos []CalendarObject) ([]CalendarObject, error
 			continue
 		}
 
-		// TODO properties are not currently filtered even if requested
+		req := &query.CompRequest
+		if req.Name != "" && req.Expand == nil && req.LimitRecurrenceSet == nil {
+			co.Data = PruneCalendar(co.Data, req)
+		}
 		out = append(out, co)
 	}
 	return out, nil
 }
 
 // Match reports whether the provided CalendarObject matches the query.
+// Floating date and times are interpreted as UTC, use Filter to take the time
+// zone of a CalendarQuery into account.
 func Match(query CompFilter, co *CalendarObject) (matched bool, err error) {
 	if co.Data == nil || co.Data.Component == nil {
 		panic("request to process empty calendar object")
 	}
-	return match(query, co.Data.Component)
+	return match(query, co.Data.Component, nil, time.UTC)
+}
+
+// timezoneLocation returns the location described by an iCalendar object
+// containing a single VTIMEZONE. The time zone is looked up by TZID, and
+// falls back to the standard offset of the VTIMEZONE if it's unknown. UTC is
+// returned for an empty string.
+func timezoneLocation(s string) (*time.Location, error) {
+	if s == "" {
+		return time.UTC, nil
+	}
+
+	cal, err := ical.NewDecoder(strings.NewReader(s)).Decode()
+	if err != nil {
+		return nil, fmt.Errorf("caldav: invalid time zone: %v", err)
+	}
+	for _, child := range cal.Children {
+		if child.Name != ical.CompTimezone {
+			continue
+		}
+		tzid, _ := child.Props.Text(ical.PropTimezoneID)
+		if tzid != "" {
+			if loc, err := time.LoadLocation(tzid); err == nil {
+				return loc, nil
+			}
+		}
+		for _, sub := range child.Children {
+			prop := sub.Props.Get(ical.PropTimezoneOffsetTo)
+			if sub.Name != ical.CompTimezoneStandard || prop == nil {
+				continue
+			}
+			offset, err := parseUTCOffset(prop.Value)
+			if err != nil {
+				return nil, err
+			}
+			return time.FixedZone(tzid, offset), nil
+		}
+	}
+	return nil, fmt.Errorf("caldav: time zone without a usable VTIMEZONE component")
+}
+
+// parseUTCOffset parses a UTC-OFFSET value, as defined in RFC 5545 section
+// 3.3.14, and returns it in seconds.
+func parseUTCOffset(s string) (int, error) {
+	if len(s) != len("+0000") && len(s) != len("+000000") || s[0] != '+' && s[0] != '-' {
+		return 0, fmt.Errorf("caldav: invalid UTC offset %q", s)
+	}
+	var offset int
+	for i, unit := range []int{3600, 60, 1} {
+		if 1+2*i >= len(s) {
+			break
+		}
+		n, err := strconv.Atoi(s[1+2*i : 3+2*i])
+		if err != nil {
+			return 0, fmt.Errorf("caldav: invalid UTC offset %q", s)
+		}
+		offset += n * unit
+	}
+	if s[0] == '-' {
+		offset = -offset
+	}
+	return offset, nil
 }
 
-func match(filter CompFilter, comp *ical.Component) (bool, error) {
+// match reports whether comp matches filter. parent is the component
+// containing comp, if any. Floating date and times are interpreted in loc.
+func match(filter CompFilter, comp, parent *ical.Component, loc *time.Location) (bool, error) {
 	if comp.Name != filter.Name {
 		return filter.IsNotDefined, nil
 	}
 
-	var zeroDate time.Time
-	if filter.Start != zeroDate {
-		match, err := matchCompTimeRange(filter.Start, filter.End, comp)
+	if !filter.Start.IsZero() || !filter.End.IsZero() {
+		match, err := matchCompTimeRange(filter.Start, filter.End, comp, parent, loc)
 		if err != nil {
 			return false, err
 		}
@@ -55,7 +138,7 @@ func match(filter CompFilter, comp *ical.Component) (bool, error) {
 		}
 	}
 	for _, compFilter := range filter.Comps {
-		match, err := matchCompFilter(compFilter, comp)
+		match, err := matchCompFilter(compFilter, comp, loc)
 		if err != nil {
 			return false, err
 		}
@@ -64,7 +147,7 @@ func match(filter CompFilter, comp *ical.Component) (bool, error) {
 		}
 	}
 	for _, propFilter := range filter.Props {
-		match, err := matchPropFilter(propFilter, comp)
+		match, err := matchPropFilter(propFilter, comp, loc)
 		if err != nil {
 			return false, err
 		}
@@ -75,11 +158,20 @@ func match(filter CompFilter, comp *ical.Component) (bool, error) {
 	return true, nil
 }
 
-func matchCompFilter(filter CompFilter, comp *ical.Component) (bool, error) {
+func matchCompFilter(filter CompFilter, comp *ical.Component, loc *time.Location) (bool, error) {
 	var matches []*ical.Component
 
-	for _, child := range comp.Children {
-		match, err := match(filter, child)
+	children := comp.Children
+	if comp.Name == ical.CompCalendar {
+		var err error
+		children, err = calendarInstances(comp, filter, loc)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	for _, child := range children {
+		match, err := match(filter, child, comp, loc)
 		if err != nil {
 			return false, err
 		} else if match {
@@ -92,7 +184,75 @@ func matchCompFilter(filter CompFilter, comp *ical.Component) (bool, error) {
 	return true, nil
 }
 
-func matchPropFilter(filter PropFilter, comp *ical.Component) (bool, error) {
+// calendarInstances returns the components of a calendar object a filter
+// is evaluated against. If the filter contains time ranges depending on the
+// instances, recurring components are replaced with their instances which
+// may overlap these time ranges, so that the filter is applied per instance.
+// Overridden instances are kept as-is.
+func calendarInstances(cal *ical.Component, filter CompFilter, loc *time.Location) ([]*ical.Component, error) {
+	start, end, ok := filterTimeRange(filter)
+	if !ok {
+		return cal.Children, nil
+	}
+
+	overrides := recurrenceOverrides(cal)
+
+	var out []*ical.Component
+	for _, child := range cal.Children {
+		var r *recurrence
+		if child.Props.Get(ical.PropRecurrenceID) == nil {
+			uid, _ := child.Props.Text(ical.PropUID)
+			var err error
+			r, err = newRecurrence(child, overrides[uid], loc)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if r == nil {
+			out = append(out, child)
+		} else {
+			out = append(out, r.between(start, end)...)
+		}
+	}
+	return out, nil
+}
+
+// filterTimeRange returns the union of the time ranges of a filter which
+// depend on the instance of a recurring component: the time ranges of the
+// filter and its nested comp-filters, and of prop-filters on date and times
+// shifted with the instance. ok is false if there are none.
+func filterTimeRange(filter CompFilter) (start, end time.Time, ok bool) {
+	add := func(s, e time.Time) {
+		if !ok || s.IsZero() || !start.IsZero() && s.Before(start) {
+			start = s
+		}
+		if !ok || e.IsZero() || !end.IsZero() && e.After(end) {
+			end = e
+		}
+		ok = true
+	}
+
+	if !filter.Start.IsZero() || !filter.End.IsZero() {
+		add(filter.Start, filter.End)
+	}
+	for _, propFilter := range filter.Props {
+		if propFilter.Start.IsZero() && propFilter.End.IsZero() {
+			continue
+		}
+		switch propFilter.Name {
+		case ical.PropDateTimeStart, ical.PropDateTimeEnd, ical.PropDue, ical.PropRecurrenceID:
+			add(propFilter.Start, propFilter.End)
+		}
+	}
+	for _, compFilter := range filter.Comps {
+		if s, e, found := filterTimeRange(compFilter); found {
+			add(s, e)
+		}
+	}
+	return start, end, ok
+}
+
+func matchPropFilter(filter PropFilter, comp *ical.Component, loc *time.Location) (bool, error) {
 	// TODO: this only matches first field, there can be multiple
 	field := comp.Props.Get(filter.Name)
 	if field == nil {
@@ -100,14 +260,17 @@ func matchPropFilter(filter PropFilter, comp *ical.Component) (bool, error) {
 	}
 
 	for _, paramFilter := range filter.ParamFilter {
-		if !matchParamFilter(paramFilter, field) {
+		match, err := matchParamFilter(paramFilter, field)
+		if err != nil {
+			return false, err
+		}
+		if !match {
 			return false, nil
 		}
 	}
 
-	var zeroDate time.Time
-	if filter.Start != zeroDate {
-		match, err := matchPropTimeRange(filter.Start, filter.End, field)
+	if !filter.Start.IsZero() || !filter.End.IsZero() {
+		match, err := matchPropTimeRange(filter.Start, filter.End, field, loc)
 		if err != nil {
 			return false, err
 		}
@@ -115,91 +278,296 @@ func matchPropFilter(filter PropFilter, comp *ical.Component) (bool, error) {
 			return false, nil
 		}
 	} else if filter.TextMatch != nil {
-		if !matchTextMatch(*filter.TextMatch, field.Value) {
-			return false, nil
-		}
-		return true, nil
+		return matchTextMatch(*filter.TextMatch, field.Value)
 	}
 	// empty prop-filter, property exists
 	return true, nil
 }
 
-func matchCompTimeRange(start, end time.Time, comp *ical.Component) (bool, error) {
-	// See https://datatracker.ietf.org/doc/html/rfc4791#section-9.9
+// startsBefore reports whether the start of a time range is before t, or
+// equal to t if orEqual is set. A zero start is unbounded.
+func startsBefore(start, t time.Time, orEqual bool) bool {
+	return start.IsZero() || start.Before(t) || orEqual && start.Equal(t)
+}
 
-	// evaluate recurring components
-	rset, err := comp.RecurrenceSet(start.Location())
-	if err != nil {
-		return false, err
+// endsAfter reports whether the end of a time range is after t, or equal to
+// t if orEqual is set. A zero end is unbounded.
+func endsAfter(end, t time.Time, orEqual bool) bool {
+	return end.IsZero() || end.After(t) || orEqual && end.Equal(t)
+}
+
+// matchCompTimeRange reports whether a component overlaps the time range
+// [start, end), as defined in RFC 4791 section 9.9. parent is required for
+// VALARM components.
+func matchCompTimeRange(start, end time.Time, comp, parent *ical.Component, loc *time.Location) (bool, error) {
+	switch comp.Name {
+	case ical.CompEvent, ical.CompToDo, ical.CompJournal:
+		return matchInstanceTimeRange(start, end, comp, loc)
+	case ical.CompFreeBusy:
+		return matchFreeBusyTimeRange(start, end, comp, loc)
+	case ical.CompAlarm:
+		return matchAlarmTimeRange(start, end, comp, parent, loc)
+	default:
+		return false, nil
+	}
+}
+
+// matchInstanceTimeRange reports whether a VEVENT, VTODO or VJOURNAL
+// component overlaps the time range [start, end). Recurring components are
+// expanded beforehand by calendarInstances.
+func matchInstanceTimeRange(start, end time.Time, comp *ical.Component, loc *time.Location) (bool, error) {
+	var dtstart time.Time
+	hasStart := false
+	if prop := comp.Props.Get(ical.PropDateTimeStart); prop != nil {
+		var err error
+		dtstart, err = dateTime(prop, loc)
+		if err != nil {
+			return false, fmt.Errorf("caldav: failed to parse DTSTART: %v", err)
+		}
+		hasStart = true
 	}
-	if rset != nil {
-		// TODO we can only set inclusive to true or false, but really the
-		// start time is inclusive while the end time is not :/
-		return len(rset.Between(start, end, true)) > 0, nil
+	propTime := func(name string) (time.Time, bool, error) {
+		prop := comp.Props.Get(name)
+		if prop == nil {
+			return time.Time{}, false, nil
+		}
+		t, err := dateTime(prop, loc)
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("caldav: failed to parse %v: %v", name, err)
+		}
+		return t, true, nil
+	}
+
+	switch comp.Name {
+	case ical.CompEvent, ical.CompJournal:
+		if !hasStart {
+			return false, nil
+		}
+		var dur time.Duration
+		if comp.Name == ical.CompEvent {
+			var err error
+			dur, err = componentDuration(comp, dtstart, loc)
+			if err != nil {
+				return false, err
+			}
+		} else if isDate(comp.Props.Get(ical.PropDateTimeStart)) {
+			dur = 24 * time.Hour
+		}
+		return overlaps(dtstart, dur, start, end), nil
+	case ical.CompToDo:
+		due, hasDue, err := propTime(ical.PropDue)
+		if err != nil {
+			return false, err
+		}
+
+		if hasStart {
+			if prop := comp.Props.Get(ical.PropDuration); prop != nil {
+				dur, err := prop.Duration()
+				if err != nil {
+					return false, fmt.Errorf("caldav: failed to parse DURATION: %v", err)
+				}
+				dtend := dtstart.Add(dur)
+				return startsBefore(start, dtend, true) &&
+					(endsAfter(end, dtstart, false) || endsAfter(end, dtend, true)), nil
+			}
+			if hasDue {
+				return (startsBefore(start, due, false) || startsBefore(start, dtstart, true)) &&
+					(endsAfter(end, dtstart, false) || endsAfter(end, due, true)), nil
+			}
+			return startsBefore(start, dtstart, true) && endsAfter(end, dtstart, false), nil
+		}
+		if hasDue {
+			return startsBefore(start, due, false) && endsAfter(end, due, true), nil
+		}
+
+		completed, hasCompleted, err := propTime(ical.PropCompleted)
+		if err != nil {
+			return false, err
+		}
+		created, hasCreated, err := propTime(ical.PropCreated)
+		if err != nil {
+			return false, err
+		}
+		switch {
+		case hasCompleted && hasCreated:
+			return (startsBefore(start, created, true) || startsBefore(start, completed, true)) &&
+				(endsAfter(end, created, true) || endsAfter(end, completed, true)), nil
+		case hasCompleted:
+			return startsBefore(start, completed, true) && endsAfter(end, completed, true), nil
+		case hasCreated:
+			return endsAfter(end, created, false), nil
+		default:
+			return true, nil
+		}
 	}
+	return false, nil
+}
 
-	// TODO handle more than just events
-	if comp.Name != ical.CompEvent {
+// matchFreeBusyTimeRange reports whether a VFREEBUSY component overlaps the
+// time range [start, end).
+func matchFreeBusyTimeRange(start, end time.Time, comp *ical.Component, loc *time.Location) (bool, error) {
+	if props := comp.Props[ical.PropFreeBusy]; len(props) > 0 {
+		for _, prop := range props {
+			for _, v := range strings.Split(prop.Value, ",") {
+				pstart, pend, err := parsePeriod(v, prop.Params.Get(ical.PropTimezoneID), loc)
+				if err != nil {
+					return false, fmt.Errorf("caldav: failed to parse FREEBUSY: %v", err)
+				}
+				if startsBefore(start, pend, false) && endsAfter(end, pstart, false) {
+					return true, nil
+				}
+			}
+		}
 		return false, nil
 	}
-	event := ical.Event{comp}
 
-	eventStart, err := event.DateTimeStart(start.Location())
+	dtstart := comp.Props.Get(ical.PropDateTimeStart)
+	dtend := comp.Props.Get(ical.PropDateTimeEnd)
+	if dtstart == nil || dtend == nil {
+		return false, nil
+	}
+	s, err := dateTime(dtstart, loc)
 	if err != nil {
-		return false, err
+		return false, fmt.Errorf("caldav: failed to parse DTSTART: %v", err)
 	}
-	eventEnd, err := event.DateTimeEnd(end.Location())
+	e, err := dateTime(dtend, loc)
 	if err != nil {
-		return false, err
+		return false, fmt.Errorf("caldav: failed to parse DTEND: %v", err)
 	}
+	return startsBefore(start, e, true) && endsAfter(end, s, false), nil
+}
 
-	// Event starts in time range
-	if eventStart.After(start) && (end.IsZero() || eventStart.Before(end)) {
-		return true, nil
+// matchAlarmTimeRange reports whether a VALARM component triggers in the time
+// range [start, end). Relative triggers are resolved against parent.
+func matchAlarmTimeRange(start, end time.Time, alarm, parent *ical.Component, loc *time.Location) (bool, error) {
+	trigger := alarm.Props.Get(ical.PropTrigger)
+	if trigger == nil || parent == nil {
+		return false, nil
 	}
-	// Event ends in time range
-	if eventEnd.After(start) && (end.IsZero() || eventEnd.Before(end)) {
-		return true, nil
+
+	var t time.Time
+	if trigger.ValueType() == ical.ValueDateTime {
+		var err error
+		t, err = trigger.DateTime(loc)
+		if err != nil {
+			return false, fmt.Errorf("caldav: failed to parse TRIGGER: %v", err)
+		}
+	} else {
+		offset, err := trigger.Duration()
+		if err != nil {
+			return false, fmt.Errorf("caldav: failed to parse TRIGGER: %v", err)
+		}
+		related, ok, err := alarmRelatedTime(parent, strings.EqualFold(trigger.Params.Get(ical.ParamRelated), "END"), loc)
+		if err != nil || !ok {
+			return false, err
+		}
+		t = related.Add(offset)
 	}
-	// Event covers entire time range plus some
-	if eventStart.Before(start) && (!end.IsZero() && eventEnd.After(end)) {
-		return true, nil
+
+	var repeat int
+	var interval time.Duration
+	if prop := alarm.Props.Get(ical.PropRepeat); prop != nil {
+		var err error
+		repeat, err = prop.Int()
+		if err != nil {
+			return false, fmt.Errorf("caldav: failed to parse REPEAT: %v", err)
+		}
+		if prop := alarm.Props.Get(ical.PropDuration); prop != nil {
+			interval, err = prop.Duration()
+			if err != nil {
+				return false, fmt.Errorf("caldav: failed to parse DURATION: %v", err)
+			}
+		}
+	}
+
+	for i := 0; i <= repeat; i++ {
+		at := t.Add(time.Duration(i) * interval)
+		if startsBefore(start, at, true) && endsAfter(end, at, false) {
+			return true, nil
+		}
+		if interval <= 0 {
+			break
+		}
 	}
 	return false, nil
 }
 
-func matchPropTimeRange(start, end time.Time, field *ical.Prop) (bool, error) {
+// alarmRelatedTime returns the start or end time of the component containing
+// an alarm.
+func alarmRelatedTime(parent *ical.Component, relatedEnd bool, loc *time.Location) (time.Time, bool, error) {
+	dtstart := parent.Props.Get(ical.PropDateTimeStart)
+	if !relatedEnd {
+		if dtstart == nil {
+			return time.Time{}, false, nil
+		}
+		t, err := dateTime(dtstart, loc)
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("caldav: failed to parse DTSTART: %v", err)
+		}
+		return t, true, nil
+	}
+
+	if due := parent.Props.Get(ical.PropDue); due != nil {
+		t, err := dateTime(due, loc)
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("caldav: failed to parse DUE: %v", err)
+		}
+		return t, true, nil
+	}
+	if dtstart == nil {
+		return time.Time{}, false, nil
+	}
+	t, err := dateTime(dtstart, loc)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("caldav: failed to parse DTSTART: %v", err)
+	}
+	dur, err := componentDuration(parent, t, loc)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	return t.Add(dur), true, nil
+}
+
+func matchPropTimeRange(start, end time.Time, field *ical.Prop, loc *time.Location) (bool, error) {
 	// See https://datatracker.ietf.org/doc/html/rfc4791#section-9.9
 
-	ptime, err := field.DateTime(start.Location())
+	ptime, err := dateTime(field, loc)
 	if err != nil {
 		return false, err
 	}
-	if ptime.After(start) && (end.IsZero() || ptime.Before(end)) {
-		return true, nil
+	var dur time.Duration
+	if isDate(field) {
+		dur = 24 * time.Hour
 	}
-	return false, nil
+	return overlaps(ptime, dur, start, end), nil
 }
 
-func matchParamFilter(filter ParamFilter, field *ical.Prop) bool {
+func matchParamFilter(filter ParamFilter, field *ical.Prop) (bool, error) {
 	// TODO there can be multiple values
 	value := field.Params.Get(filter.Name)
 	if value == "" {
-		return filter.IsNotDefined
+		return filter.IsNotDefined, nil
 	} else if filter.IsNotDefined {
-		return false
+		return false, nil
 	}
 	if filter.TextMatch != nil {
 		return matchTextMatch(*filter.TextMatch, value)
 	}
-	return true
+	return true, nil
 }
 
-func matchTextMatch(txt TextMatch, value string) bool {
-	// TODO: handle text-match collation attribute
-	match := strings.Contains(value, txt.Text)
+func matchTextMatch(txt TextMatch, value string) (bool, error) {
+	text, err := internal.CollationKey(txt.Collation, txt.Text)
+	if err != nil {
+		return false, err
+	}
+	value, err = internal.CollationKey(txt.Collation, value)
+	if err != nil {
+		return false, err
+	}
+	match := strings.Contains(value, text)
 	if txt.NegateCondition {
 		match = !match
 	}
-	return match
+	return match, nil
 }
@@ -270,6 +270,49 @@ END:VCALENDAR`)
 			addrs: []CalendarObject{event1, event2, event3, todo1},
 			want:  []CalendarObject{event1},
 		},
+		{
+			name: "events by description substring with octet collation",
+			query: &CalendarQuery{
+				CompFilter: CompFilter{
+					Name: "VCALENDAR",
+					Comps: []CompFilter{
+						{
+							Name: "VEVENT",
+							Props: []PropFilter{{
+								Name: "Description",
+								TextMatch: &TextMatch{
+									Text:      "steelers",
+									Collation: "i;octet",
+								},
+							}},
+						},
+					},
+				},
+			},
+			addrs: []CalendarObject{event1, event2, event3, todo1},
+			want:  nil,
+		},
+		{
+			name: "events by description substring ignoring case",
+			query: &CalendarQuery{
+				CompFilter: CompFilter{
+					Name: "VCALENDAR",
+					Comps: []CompFilter{
+						{
+							Name: "VEVENT",
+							Props: []PropFilter{{
+								Name: "Description",
+								TextMatch: &TextMatch{
+									Text: "steelers",
+								},
+							}},
+						},
+					},
+				},
+			},
+			addrs: []CalendarObject{event1, event2, event3, todo1},
+			want:  []CalendarObject{event1},
+		},
 		{
 			// Query a time range that only returns a result if recurrence is properly evaluated.
 			name: "recurring events in time range",
@@ -309,3 +352,220 @@ END:VCALENDAR`)
 		})
 	}
 }
+
+func TestMatchTimeRange(t *testing.T) {
+	newCO := func(comp string) CalendarObject {
+		s := "BEGIN:VCALENDAR\nVERSION:2.0\nPRODID:-//Example Corp.//CalDAV Client//EN\n" + comp + "END:VCALENDAR\n"
+		cal, err := ical.NewDecoder(strings.NewReader(strings.ReplaceAll(s, "\n", "\r\n"))).Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return CalendarObject{Data: cal}
+	}
+
+	newYork := `BEGIN:VCALENDAR
+PRODID:-//Example Corp.//CalDAV Client//EN
+VERSION:2.0
+BEGIN:VTIMEZONE
+TZID:America/New_York
+BEGIN:STANDARD
+DTSTART:19671029T020000
+TZOFFSETFROM:-0400
+TZOFFSETTO:-0500
+END:STANDARD
+END:VTIMEZONE
+END:VCALENDAR
+`
+	unknownTZ := strings.ReplaceAll(newYork, "America/New_York", "Example/Unknown")
+
+	for _, tc := range []struct {
+		name     string
+		comp     string
+		filter   string // name of the nested component to filter
+		start    string
+		end      string
+		timezone string
+		want     bool
+	}{
+		{"event-ends-at-start", "BEGIN:VEVENT\nUID:1\nDTSTAMP:20060206T001121Z\nDTSTART:20060104T090000Z\nDTEND:20060104T100000Z\nEND:VEVENT\n", "VEVENT", "20060104T100000Z", "20060104T110000Z", "", false},
+		{"event-starts-at-end", "BEGIN:VEVENT\nUID:1\nDTSTAMP:20060206T001121Z\nDTSTART:20060104T110000Z\nDTEND:20060104T120000Z\nEND:VEVENT\n", "VEVENT", "20060104T100000Z", "20060104T110000Z", "", false},
+		{"event-zero-duration-at-start", "BEGIN:VEVENT\nUID:1\nDTSTAMP:20060206T001121Z\nDTSTART:20060104T100000Z\nEND:VEVENT\n", "VEVENT", "20060104T100000Z", "20060104T110000Z", "", true},
+		{"event-end-only", "BEGIN:VEVENT\nUID:1\nDTSTAMP:20060206T001121Z\nDTSTART:20060104T100000Z\nDURATION:PT1H\nEND:VEVENT\n", "VEVENT", "", "20060104T103000Z", "", true},
+		{"event-floating-utc", "BEGIN:VEVENT\nUID:1\nDTSTAMP:20060206T001121Z\nDTSTART:20060104T100000\nDURATION:PT1H\nEND:VEVENT\n", "VEVENT", "20060104T143000Z", "20060104T160000Z", "", false},
+		{"event-floating-timezone", "BEGIN:VEVENT\nUID:1\nDTSTAMP:20060206T001121Z\nDTSTART:20060104T100000\nDURATION:PT1H\nEND:VEVENT\n", "VEVENT", "20060104T143000Z", "20060104T160000Z", newYork, true},
+		{"event-floating-unknown-timezone", "BEGIN:VEVENT\nUID:1\nDTSTAMP:20060206T001121Z\nDTSTART:20060104T100000\nDURATION:PT1H\nEND:VEVENT\n", "VEVENT", "20060104T143000Z", "20060104T160000Z", unknownTZ, true},
+		{"todo-due", "BEGIN:VTODO\nUID:1\nDTSTAMP:20060206T001121Z\nDUE:20060104T110000Z\nEND:VTODO\n", "VTODO", "20060104T100000Z", "20060104T110000Z", "", true},
+		{"todo-due-at-start", "BEGIN:VTODO\nUID:1\nDTSTAMP:20060206T001121Z\nDUE:20060104T100000Z\nEND:VTODO\n", "VTODO", "20060104T100000Z", "20060104T110000Z", "", false},
+		{"todo-due-date", "BEGIN:VTODO\nUID:1\nDTSTAMP:20060206T001121Z\nDUE;VALUE=DATE:20060104\nEND:VTODO\n", "VTODO", "20060103T000000Z", "20060105T000000Z", "", true},
+		{"todo-start-duration", "BEGIN:VTODO\nUID:1\nDTSTAMP:20060206T001121Z\nDTSTART:20060104T080000Z\nDURATION:PT2H\nEND:VTODO\n", "VTODO", "20060104T100000Z", "20060104T110000Z", "", true},
+		{"todo-start-due", "BEGIN:VTODO\nUID:1\nDTSTAMP:20060206T001121Z\nDTSTART:20060104T080000Z\nDUE:20060104T090000Z\nEND:VTODO\n", "VTODO", "20060104T100000Z", "20060104T110000Z", "", false},
+		{"todo-start", "BEGIN:VTODO\nUID:1\nDTSTAMP:20060206T001121Z\nDTSTART:20060104T100000Z\nEND:VTODO\n", "VTODO", "20060104T100000Z", "20060104T110000Z", "", true},
+		{"todo-completed", "BEGIN:VTODO\nUID:1\nDTSTAMP:20060206T001121Z\nCOMPLETED:20060104T110000Z\nEND:VTODO\n", "VTODO", "20060104T100000Z", "20060104T110000Z", "", true},
+		{"todo-completed-created", "BEGIN:VTODO\nUID:1\nDTSTAMP:20060206T001121Z\nCREATED:20060101T000000Z\nCOMPLETED:20060102T000000Z\nEND:VTODO\n", "VTODO", "20060104T100000Z", "20060104T110000Z", "", false},
+		{"todo-created", "BEGIN:VTODO\nUID:1\nDTSTAMP:20060206T001121Z\nCREATED:20060101T000000Z\nEND:VTODO\n", "VTODO", "20060104T100000Z", "20060104T110000Z", "", true},
+		{"todo-no-dates", "BEGIN:VTODO\nUID:1\nDTSTAMP:20060206T001121Z\nEND:VTODO\n", "VTODO", "20060104T100000Z", "20060104T110000Z", "", true},
+		{"todo-recurring", "BEGIN:VTODO\nUID:1\nDTSTAMP:20060206T001121Z\nDTSTART:20060101T100000Z\nDUE:20060101T110000Z\nRRULE:FREQ=DAILY\nEND:VTODO\n", "VTODO", "20060104T103000Z", "20060104T104500Z", "", true},
+		{"journal-date", "BEGIN:VJOURNAL\nUID:1\nDTSTAMP:20060206T001121Z\nDTSTART;VALUE=DATE:20060104\nEND:VJOURNAL\n", "VJOURNAL", "20060104T100000Z", "20060104T110000Z", "", true},
+		{"journal-no-start", "BEGIN:VJOURNAL\nUID:1\nDTSTAMP:20060206T001121Z\nEND:VJOURNAL\n", "VJOURNAL", "20060104T100000Z", "20060104T110000Z", "", false},
+		{"freebusy-period", "BEGIN:VFREEBUSY\nUID:1\nDTSTAMP:20060206T001121Z\nFREEBUSY:20060104T080000Z/PT1H,20060104T103000Z/20060104T120000Z\nEND:VFREEBUSY\n", "VFREEBUSY", "20060104T100000Z", "20060104T110000Z", "", true},
+		{"freebusy-no-period", "BEGIN:VFREEBUSY\nUID:1\nDTSTAMP:20060206T001121Z\nFREEBUSY:20060104T080000Z/PT1H\nEND:VFREEBUSY\n", "VFREEBUSY", "20060104T100000Z", "20060104T110000Z", "", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			query := CalendarQuery{
+				CompFilter: CompFilter{
+					Name: "VCALENDAR",
+					Comps: []CompFilter{{
+						Name:  tc.filter,
+						Start: parseQueryTime(t, tc.start),
+						End:   parseQueryTime(t, tc.end),
+					}},
+				},
+				Timezone: tc.timezone,
+			}
+			got, err := Filter(&query, []CalendarObject{newCO(tc.comp)})
+			if err != nil {
+				t.Fatalf("Filter() = %v", err)
+			}
+			if (len(got) == 1) != tc.want {
+				t.Errorf("Filter() matched = %v, want %v", len(got) == 1, tc.want)
+			}
+		})
+	}
+}
+
+func TestMatchAlarmTimeRange(t *testing.T) {
+	cal, err := ical.NewDecoder(strings.NewReader(strings.ReplaceAll(`BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:-//Example Corp.//CalDAV Client//EN
+BEGIN:VEVENT
+UID:1
+DTSTAMP:20060206T001121Z
+DTSTART:20060104T100000Z
+DURATION:PT1H
+BEGIN:VALARM
+ACTION:DISPLAY
+TRIGGER;RELATED=END:PT15M
+REPEAT:2
+DURATION:PT10M
+END:VALARM
+END:VEVENT
+END:VCALENDAR
+`, "\n", "\r\n"))).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		start, end string
+		want       bool
+	}{
+		{"20060104T111500Z", "20060104T111600Z", true},
+		// Second repetition
+		{"20060104T113500Z", "20060104T113600Z", true},
+		{"20060104T100000Z", "20060104T111500Z", false},
+		{"20060104T113600Z", "", false},
+	} {
+		filter := CompFilter{
+			Name: "VCALENDAR",
+			Comps: []CompFilter{{
+				Name: "VEVENT",
+				Comps: []CompFilter{{
+					Name:  "VALARM",
+					Start: parseQueryTime(t, tc.start),
+					End:   parseQueryTime(t, tc.end),
+				}},
+			}},
+		}
+		got, err := Match(filter, &CalendarObject{Data: cal})
+		if err != nil {
+			t.Fatalf("Match() = %v", err)
+		}
+		if got != tc.want {
+			t.Errorf("Match() with alarm time range [%v, %v) = %v, want %v", tc.start, tc.end, got, tc.want)
+		}
+	}
+}
+
+func TestMatchRecurrence(t *testing.T) {
+	cal, err := ical.NewDecoder(strings.NewReader(strings.ReplaceAll(`BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:-//Example Corp.//CalDAV Client//EN
+BEGIN:VEVENT
+UID:1
+DTSTAMP:20060206T001121Z
+DTSTART:20060101T100000Z
+DURATION:PT1H
+SUMMARY:Daily
+RRULE:FREQ=DAILY;COUNT=7
+EXDATE:20060102T100000Z
+RDATE;VALUE=PERIOD:20060110T150000Z/PT3H
+END:VEVENT
+BEGIN:VEVENT
+UID:1
+DTSTAMP:20060206T001121Z
+RECURRENCE-ID:20060103T100000Z
+DTSTART:20060103T140000Z
+DURATION:PT1H
+SUMMARY:Daily
+END:VEVENT
+BEGIN:VEVENT
+UID:1
+DTSTAMP:20060206T001121Z
+RECURRENCE-ID;RANGE=THISANDFUTURE:20060105T100000Z
+DTSTART:20060105T120000Z
+DURATION:PT1H
+SUMMARY:Moved
+END:VEVENT
+END:VCALENDAR
+`, "\n", "\r\n"))).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name       string
+		start, end string
+		summary    string
+		want       bool
+	}{
+		{"instance", "20060104T103000Z", "20060104T104500Z", "", true},
+		{"exdate", "20060102T100000Z", "20060102T110000Z", "", false},
+		{"overridden-slot", "20060103T100000Z", "20060103T110000Z", "", false},
+		{"override", "20060103T143000Z", "20060103T144500Z", "", true},
+		{"this-and-future-slot", "20060106T100000Z", "20060106T110000Z", "", false},
+		{"this-and-future", "20060106T123000Z", "20060106T124500Z", "", true},
+		{"rdate-period", "20060110T170000Z", "20060110T173000Z", "", true},
+		{"after-last", "20060108T000000Z", "20060110T000000Z", "", false},
+		{"prop-filter-instance", "20060106T000000Z", "20060107T000000Z", "Moved", true},
+		{"prop-filter-other-instance", "20060104T000000Z", "20060105T000000Z", "Moved", false},
+		{"unbounded", "20060106T000000Z", "", "Moved", true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			filter := CompFilter{
+				Name:  "VEVENT",
+				Start: parseQueryTime(t, tc.start),
+				End:   parseQueryTime(t, tc.end),
+			}
+			if tc.summary != "" {
+				filter.Props = []PropFilter{{
+					Name:      ical.PropSummary,
+					TextMatch: &TextMatch{Text: tc.summary},
+				}}
+			}
+			got, err := Match(CompFilter{Name: "VCALENDAR", Comps: []CompFilter{filter}}, &CalendarObject{Data: cal})
+			if err != nil {
+				t.Fatalf("Match() = %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("Match() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func parseQueryTime(t *testing.T, s string) time.Time {
+	if s == "" {
+		return time.Time{}
+	}
+	return toDate(t, s)
+}
@@ -0,0 +1,154 @@
+package caldav
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/emersion/go-ical"
+)
+
+// PruneCalendar returns a copy of cal which only contains the components and
+// properties selected by req, as defined in RFC 4791 section 9.6.1. The
+// request applies to the top-level VCALENDAR component.
+//
+// The result may not be a valid iCalendar object, for instance if the UID
+// property isn't requested. The original calendar isn't modified.
+func PruneCalendar(cal *ical.Calendar, req *CalendarCompRequest) *ical.Calendar {
+	return &ical.Calendar{Component: pruneComponent(cal.Component, req)}
+}
+
+func pruneComponent(comp *ical.Component, req *CalendarCompRequest) *ical.Component {
+	out := &ical.Component{
+		Name:  comp.Name,
+		Props: make(ical.Props),
+	}
+
+	if req.AllProps {
+		for name, props := range comp.Props {
+			out.Props[name] = append([]ical.Prop(nil), props...)
+		}
+	} else {
+		for _, name := range req.Props {
+			name = strings.ToUpper(name)
+			if props, ok := comp.Props[name]; ok {
+				out.Props[name] = append([]ical.Prop(nil), props...)
+			}
+		}
+	}
+
+	for _, child := range comp.Children {
+		if req.AllComps {
+			out.Children = append(out.Children, child)
+			continue
+		}
+		for i := range req.Comps {
+			if strings.EqualFold(req.Comps[i].Name, child.Name) {
+				out.Children = append(out.Children, pruneComponent(child, &req.Comps[i]))
+				break
+			}
+		}
+	}
+
+	return out
+}
+
+// encodeCalendarData writes an iCalendar object like ical.Encoder does, with
+// properties sorted by name, but folds long lines and doesn't check that
+// required properties are present. This allows calendars returned by
+// PruneCalendar and free-busy results to be encoded. Complete calendar
+// objects should be written with ical.Encoder.
+func encodeCalendarData(w io.Writer, cal *ical.Calendar) error {
+	return encodeComponent(w, cal.Component)
+}
+
+func encodeComponent(w io.Writer, comp *ical.Component) error {
+	if err := encodeProp(w, &ical.Prop{Name: "BEGIN", Value: comp.Name}); err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(comp.Props))
+	for name := range comp.Props {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for i := range comp.Props[name] {
+			if err := encodeProp(w, &comp.Props[name][i]); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, child := range comp.Children {
+		if err := encodeComponent(w, child); err != nil {
+			return err
+		}
+	}
+
+	return encodeProp(w, &ical.Prop{Name: "END", Value: comp.Name})
+}
+
+func encodeProp(w io.Writer, prop *ical.Prop) error {
+	var buf bytes.Buffer
+	buf.WriteString(prop.Name)
+
+	names := make([]string, 0, len(prop.Params))
+	for name := range prop.Params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		buf.WriteString(";" + name + "=")
+		for i, v := range prop.Params[name] {
+			if i > 0 {
+				buf.WriteString(",")
+			}
+			if strings.ContainsRune(v, '"') {
+				return fmt.Errorf("caldav: failed to encode param value: contains a double-quote")
+			}
+			if strings.ContainsAny(v, ";:,") {
+				buf.WriteString(`"` + v + `"`)
+			} else {
+				buf.WriteString(v)
+			}
+		}
+	}
+
+	if strings.ContainsAny(prop.Value, "\r\n") {
+		return fmt.Errorf("caldav: failed to encode property value: contains a CR or LF")
+	}
+	buf.WriteString(":" + prop.Value)
+
+	_, err := w.Write(foldLine(buf.Bytes()))
+	return err
+}
+
+// maxLineLength is the maximum length of a content line in octets, excluding
+// the line break, as defined in RFC 5545 section 3.1.
+const maxLineLength = 75
+
+// foldLine splits a content line into lines of at most maxLineLength octets,
+// as defined in RFC 5545 section 3.1, and appends a line break. UTF-8
+// sequences aren't split.
+func foldLine(line []byte) []byte {
+	var out bytes.Buffer
+	n := maxLineLength
+	for len(line) > n {
+		i := n
+		for i > 0 && !utf8.RuneStart(line[i]) {
+			i--
+		}
+		out.Write(line[:i])
+		out.WriteString("\r\n ")
+		line = line[i:]
+		// The leading space counts towards the line length
+		n = maxLineLength - 1
+	}
+	out.Write(line)
+	out.WriteString("\r\n")
+	return out.Bytes()
+}
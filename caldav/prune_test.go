@@ -0,0 +1,154 @@
+package caldav
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/emersion/go-ical"
+)
+
+var pruneCalendarData = `BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:-//Example Corp.//CalDAV Client//EN
+BEGIN:VTIMEZONE
+TZID:US/Eastern
+BEGIN:STANDARD
+DTSTART:20001026T020000
+TZOFFSETFROM:-0400
+TZOFFSETTO:-0500
+END:STANDARD
+END:VTIMEZONE
+BEGIN:VEVENT
+UID:abcd2
+DTSTAMP:20060206T001121Z
+DTSTART;TZID=US/Eastern:20060102T120000
+DURATION:PT1H
+SUMMARY:Event #2
+BEGIN:VALARM
+ACTION:DISPLAY
+TRIGGER:-PT15M
+END:VALARM
+END:VEVENT
+END:VCALENDAR
+`
+
+func TestPruneCalendar(t *testing.T) {
+	cal, err := ical.NewDecoder(strings.NewReader(strings.ReplaceAll(pruneCalendarData, "\n", "\r\n"))).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name     string
+		req      CalendarCompRequest
+		expected string
+	}{
+		{
+			name:     "all",
+			req:      CalendarCompRequest{Name: "VCALENDAR", AllProps: true, AllComps: true},
+			expected: pruneCalendarData,
+		},
+		{
+			// RFC 4791 section 7.8.1
+			name: "partial",
+			req: CalendarCompRequest{
+				Name:  "VCALENDAR",
+				Props: []string{"VERSION"},
+				Comps: []CalendarCompRequest{{
+					Name:  "VEVENT",
+					Props: []string{"SUMMARY", "UID", "DTSTART"},
+				}},
+			},
+			expected: `BEGIN:VCALENDAR
+VERSION:2.0
+BEGIN:VEVENT
+DTSTART;TZID=US/Eastern:20060102T120000
+SUMMARY:Event #2
+UID:abcd2
+END:VEVENT
+END:VCALENDAR
+`,
+		},
+		{
+			name: "nested",
+			req: CalendarCompRequest{
+				Name: "VCALENDAR",
+				Comps: []CalendarCompRequest{{
+					Name:  "VEVENT",
+					Props: []string{"uid"},
+					Comps: []CalendarCompRequest{{Name: "VALARM", AllProps: true}},
+				}},
+			},
+			expected: `BEGIN:VCALENDAR
+BEGIN:VEVENT
+UID:abcd2
+BEGIN:VALARM
+ACTION:DISPLAY
+TRIGGER:-PT15M
+END:VALARM
+END:VEVENT
+END:VCALENDAR
+`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			pruned := PruneCalendar(cal, &tc.req)
+
+			var buf bytes.Buffer
+			if err := encodeCalendarData(&buf, pruned); err != nil {
+				t.Fatalf("encodeCalendarData() = %v", err)
+			}
+
+			// Properties are sorted by the encoder
+			expected, err := ical.NewDecoder(strings.NewReader(strings.ReplaceAll(tc.expected, "\n", "\r\n"))).Decode()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var expectedBuf bytes.Buffer
+			if err := encodeCalendarData(&expectedBuf, expected); err != nil {
+				t.Fatal(err)
+			}
+
+			if buf.String() != expectedBuf.String() {
+				t.Errorf("PruneCalendar() = \n%v\nexpected:\n%v", buf.String(), expectedBuf.String())
+			}
+		})
+	}
+
+	if len(cal.Children) != 2 || len(cal.Props) != 2 {
+		t.Errorf("PruneCalendar() modified the original calendar")
+	}
+}
+
+func TestEncodeCalendarData_fold(t *testing.T) {
+	summary := strings.Repeat("Événement très long ", 10)
+
+	cal := ical.NewCalendar()
+	event := ical.NewComponent(ical.CompEvent)
+	event.Props.SetText(ical.PropSummary, summary)
+	cal.Children = append(cal.Children, event)
+
+	var buf bytes.Buffer
+	if err := encodeCalendarData(&buf, cal); err != nil {
+		t.Fatalf("encodeCalendarData() = %v", err)
+	}
+
+	for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\r\n"), "\r\n") {
+		if len(line) > 75 {
+			t.Errorf("line longer than 75 octets: %q", line)
+		}
+		if !utf8.ValidString(line) {
+			t.Errorf("line splits a UTF-8 sequence: %q", line)
+		}
+	}
+
+	decoded, err := ical.NewDecoder(&buf).Decode()
+	if err != nil {
+		t.Fatalf("failed to decode folded calendar: %v", err)
+	}
+	if got, _ := decoded.Children[0].Props.Text(ical.PropSummary); got != summary {
+		t.Errorf("decoded SUMMARY = %q, expected %q", got, summary)
+	}
+}
@@ -0,0 +1,593 @@
+package caldav
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-ical"
+	"github.com/teambition/rrule-go"
+)
+
+// recurrenceSet returns the recurrence set of a component, or nil if the
+// component isn't recurring. Unlike ical.Component.RecurrenceSet, it takes
+// RDATE properties into account and supports lists of dates in RDATE and
+// EXDATE properties.
+func recurrenceSet(comp *ical.Component, loc *time.Location) (*rrule.Set, error) {
+	rruleProp := comp.Props.Get(ical.PropRecurrenceRule)
+	if rruleProp == nil && comp.Props.Get(ical.PropRecurrenceDates) == nil {
+		return nil, nil
+	}
+
+	dtstart := comp.Props.Get(ical.PropDateTimeStart)
+	if dtstart == nil {
+		return nil, fmt.Errorf("caldav: recurring %v component without DTSTART", comp.Name)
+	}
+	start, err := dateTime(dtstart, loc)
+	if err != nil {
+		return nil, fmt.Errorf("caldav: failed to parse DTSTART: %v", err)
+	}
+
+	var set rrule.Set
+	set.DTStart(start)
+	// DTSTART is always the first instance, even if it doesn't match the
+	// recurrence rule
+	set.RDate(start)
+
+	if rruleProp != nil {
+		roption, err := rrule.StrToROptionInLocation(rruleProp.Value, start.Location())
+		if err != nil {
+			return nil, fmt.Errorf("caldav: failed to parse RRULE: %v", err)
+		}
+		roption.Dtstart = start
+		rule, err := rrule.NewRRule(*roption)
+		if err != nil {
+			return nil, fmt.Errorf("caldav: invalid RRULE: %v", err)
+		}
+		set.RRule(rule)
+	}
+
+	for _, prop := range comp.Props[ical.PropRecurrenceDates] {
+		l, err := dateTimeList(&prop, loc)
+		if err != nil {
+			return nil, fmt.Errorf("caldav: failed to parse RDATE: %v", err)
+		}
+		for _, t := range l {
+			set.RDate(t)
+		}
+	}
+	for _, prop := range comp.Props[ical.PropExceptionDates] {
+		l, err := dateTimeList(&prop, loc)
+		if err != nil {
+			return nil, fmt.Errorf("caldav: failed to parse EXDATE: %v", err)
+		}
+		for _, t := range l {
+			set.ExDate(t)
+		}
+	}
+
+	return &set, nil
+}
+
+// isDate reports whether a property holds a date without a time.
+func isDate(prop *ical.Prop) bool {
+	return prop.ValueType() == ical.ValueDate || len(prop.Value) == len("20060102")
+}
+
+// dateTime parses a DATE or DATE-TIME property value. Floating times and
+// dates are interpreted in loc.
+func dateTime(prop *ical.Prop, loc *time.Location) (time.Time, error) {
+	if isDate(prop) {
+		if loc == nil {
+			loc = time.UTC
+		}
+		return time.ParseInLocation("20060102", prop.Value, loc)
+	}
+	return prop.DateTime(loc)
+}
+
+// dateTimeList parses a property holding a list of dates, date-times or
+// periods. Only the start of periods is returned.
+func dateTimeList(prop *ical.Prop, loc *time.Location) ([]time.Time, error) {
+	period := prop.ValueType() == ical.ValuePeriod
+
+	var l []time.Time
+	for _, v := range strings.Split(prop.Value, ",") {
+		if period {
+			v = strings.SplitN(v, "/", 2)[0]
+		}
+		single := ical.Prop{Name: prop.Name, Params: make(ical.Params), Value: v}
+		if tzid := prop.Params.Get(ical.PropTimezoneID); tzid != "" {
+			single.Params.Set(ical.PropTimezoneID, tzid)
+		}
+		if !period {
+			single.SetValueType(prop.ValueType())
+		}
+		t, err := dateTime(&single, loc)
+		if err != nil {
+			return nil, err
+		}
+		l = append(l, t)
+	}
+	return l, nil
+}
+
+// componentDuration returns the duration of a component starting at start,
+// as defined in RFC 4791 section 9.9.
+func componentDuration(comp *ical.Component, start time.Time, loc *time.Location) (time.Duration, error) {
+	for _, name := range []string{ical.PropDateTimeEnd, ical.PropDue} {
+		if prop := comp.Props.Get(name); prop != nil {
+			end, err := dateTime(prop, loc)
+			if err != nil {
+				return 0, fmt.Errorf("caldav: failed to parse %v: %v", name, err)
+			}
+			return end.Sub(start), nil
+		}
+	}
+	if prop := comp.Props.Get(ical.PropDuration); prop != nil {
+		return prop.Duration()
+	}
+	if prop := comp.Props.Get(ical.PropDateTimeStart); prop != nil && isDate(prop) {
+		return 24 * time.Hour, nil
+	}
+	return 0, nil
+}
+
+// overlaps reports whether an instance starting at t and lasting dur overlaps
+// the time range [start, end). A zero start or end leaves the range unbounded.
+func overlaps(t time.Time, dur time.Duration, start, end time.Time) bool {
+	if !end.IsZero() && !t.Before(end) {
+		return false
+	}
+	if start.IsZero() {
+		return true
+	}
+	if dur <= 0 {
+		return !t.Before(start)
+	}
+	return t.Add(dur).After(start)
+}
+
+// componentOverlaps reports whether a component, ignoring recurrence,
+// overlaps the time range [start, end). Floating times are interpreted in loc.
+func componentOverlaps(comp *ical.Component, start, end time.Time, loc *time.Location) (bool, error) {
+	dtstart := comp.Props.Get(ical.PropDateTimeStart)
+	if dtstart == nil {
+		// Components without a start time can't be placed in time
+		return true, nil
+	}
+	t, err := dateTime(dtstart, loc)
+	if err != nil {
+		return false, fmt.Errorf("caldav: failed to parse DTSTART: %v", err)
+	}
+	dur, err := componentDuration(comp, t, loc)
+	if err != nil {
+		return false, err
+	}
+	return overlaps(t, dur, start, end), nil
+}
+
+// ExpandCalendar expands the recurring components of a calendar into
+// individual instances overlapping the time range [start, end), as defined in
+// RFC 4791 section 9.6.5.
+//
+// Each instance has a RECURRENCE-ID property, and overridden instances
+// replace the generated ones. Date-time values are converted to UTC, floating
+// times are interpreted as UTC. VTIMEZONE components are removed since they
+// are no longer referenced. The original calendar isn't modified.
+func ExpandCalendar(cal *ical.Calendar, start, end time.Time) (*ical.Calendar, error) {
+	return expandCalendar(cal, start, end, time.UTC)
+}
+
+// expandCalendar is like ExpandCalendar, but floating times are interpreted
+// in loc.
+func expandCalendar(cal *ical.Calendar, start, end time.Time, loc *time.Location) (*ical.Calendar, error) {
+	if start.IsZero() || end.IsZero() {
+		return nil, fmt.Errorf("caldav: expanding a calendar requires a bounded time range")
+	}
+
+	overrides := recurrenceOverrides(cal.Component)
+
+	out := &ical.Calendar{Component: &ical.Component{
+		Name:  cal.Name,
+		Props: cloneProps(cal.Props),
+	}}
+	for _, child := range cal.Children {
+		if child.Name == ical.CompTimezone {
+			continue
+		}
+
+		var r *recurrence
+		if child.Props.Get(ical.PropRecurrenceID) == nil {
+			uid, _ := child.Props.Text(ical.PropUID)
+			var err error
+			r, err = newRecurrence(child, overrides[uid], loc)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if r == nil {
+			// Non-recurring component or overridden instance
+			ok, err := componentOverlaps(child, start, end, loc)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				out.Children = append(out.Children, componentToUTC(child, loc))
+			}
+			continue
+		}
+
+		for _, inst := range r.between(start, end) {
+			ok, err := componentOverlaps(inst, start, end, loc)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				out.Children = append(out.Children, inst)
+			}
+		}
+	}
+
+	return out, nil
+}
+
+// LimitRecurrenceSet returns a copy of cal where overridden instances which
+// don't overlap the time range [start, end) are removed, as defined in RFC
+// 4791 section 9.6.6.
+func LimitRecurrenceSet(cal *ical.Calendar, start, end time.Time) (*ical.Calendar, error) {
+	out := &ical.Calendar{Component: &ical.Component{
+		Name:  cal.Name,
+		Props: cloneProps(cal.Props),
+	}}
+	for _, child := range cal.Children {
+		if child.Props.Get(ical.PropRecurrenceID) != nil {
+			ok, err := componentOverlaps(child, start, end, time.UTC)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				continue
+			}
+		}
+		out.Children = append(out.Children, child)
+	}
+	return out, nil
+}
+
+// recurrenceOverrides returns the overridden instances of a calendar,
+// indexed by UID.
+func recurrenceOverrides(cal *ical.Component) map[string][]*ical.Component {
+	overrides := make(map[string][]*ical.Component)
+	for _, child := range cal.Children {
+		if child.Props.Get(ical.PropRecurrenceID) == nil {
+			continue
+		}
+		uid, _ := child.Props.Text(ical.PropUID)
+		overrides[uid] = append(overrides[uid], child)
+	}
+	return overrides
+}
+
+// recurrence is a recurring component along with its overridden instances.
+type recurrence struct {
+	set    *rrule.Set
+	master *ical.Component
+	dur    time.Duration
+	loc    *time.Location
+
+	// Durations of the instances defined by RDATE periods, indexed by their
+	// start time in UTC
+	periods map[time.Time]time.Duration
+	// Overridden instances, indexed by RECURRENCE-ID in UTC
+	overridden map[time.Time]bool
+	// Overrides with RANGE=THISANDFUTURE, sorted by RECURRENCE-ID
+	future []futureOverride
+	// Maximum distance between the recurrence ID of an instance and the
+	// times it covers, including its alarms
+	slack time.Duration
+}
+
+// futureOverride is an overridden instance which also applies to the
+// following instances.
+type futureOverride struct {
+	comp         *ical.Component
+	recurrenceID time.Time
+	offset, dur  time.Duration
+}
+
+// newRecurrence returns the recurrence of a master component, or nil if it
+// isn't recurring. overrides contains the components sharing its UID with a
+// RECURRENCE-ID.
+func newRecurrence(master *ical.Component, overrides []*ical.Component, loc *time.Location) (*recurrence, error) {
+	set, err := recurrenceSet(master, loc)
+	if err != nil || set == nil {
+		return nil, err
+	}
+
+	dtstart, err := dateTime(master.Props.Get(ical.PropDateTimeStart), loc)
+	if err != nil {
+		return nil, err
+	}
+	dur, err := componentDuration(master, dtstart, loc)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &recurrence{
+		set:        set,
+		master:     master,
+		dur:        dur,
+		loc:        loc,
+		periods:    make(map[time.Time]time.Duration),
+		overridden: make(map[time.Time]bool),
+		slack:      dur,
+	}
+	grow := func(d time.Duration) {
+		if d < 0 {
+			d = -d
+		}
+		if d > r.slack {
+			r.slack = d
+		}
+	}
+
+	for _, prop := range master.Props[ical.PropRecurrenceDates] {
+		if prop.ValueType() != ical.ValuePeriod {
+			continue
+		}
+		for _, v := range strings.Split(prop.Value, ",") {
+			start, end, err := parsePeriod(v, prop.Params.Get(ical.PropTimezoneID), loc)
+			if err != nil {
+				return nil, fmt.Errorf("caldav: failed to parse RDATE: %v", err)
+			}
+			r.periods[start.UTC()] = end.Sub(start)
+			grow(end.Sub(start))
+		}
+	}
+
+	for _, comp := range overrides {
+		prop := comp.Props.Get(ical.PropRecurrenceID)
+		rid, err := dateTime(prop, loc)
+		if err != nil {
+			return nil, fmt.Errorf("caldav: failed to parse RECURRENCE-ID: %v", err)
+		}
+		r.overridden[rid.UTC()] = true
+		if !strings.EqualFold(prop.Params.Get(ical.ParamRange), "THISANDFUTURE") {
+			continue
+		}
+
+		start := rid
+		if prop := comp.Props.Get(ical.PropDateTimeStart); prop != nil {
+			if start, err = dateTime(prop, loc); err != nil {
+				return nil, fmt.Errorf("caldav: failed to parse DTSTART: %v", err)
+			}
+		}
+		dur, err := componentDuration(comp, start, loc)
+		if err != nil {
+			return nil, err
+		}
+		offset := start.Sub(rid)
+		r.future = append(r.future, futureOverride{comp, rid, offset, dur})
+		grow(offset)
+		grow(offset + dur)
+		grow(alarmSpan(comp) + dur)
+	}
+	sort.Slice(r.future, func(i, j int) bool {
+		return r.future[i].recurrenceID.Before(r.future[j].recurrenceID)
+	})
+
+	grow(alarmSpan(master) + dur)
+	return r, nil
+}
+
+// alarmSpan returns the maximum distance between the start of a component
+// and the times its alarms with a relative trigger go off.
+func alarmSpan(comp *ical.Component) time.Duration {
+	var span time.Duration
+	for _, alarm := range comp.Children {
+		trigger := alarm.Props.Get(ical.PropTrigger)
+		if alarm.Name != ical.CompAlarm || trigger == nil || trigger.ValueType() == ical.ValueDateTime {
+			continue
+		}
+		offset, err := trigger.Duration()
+		if err != nil {
+			continue
+		}
+		if offset < 0 {
+			offset = -offset
+		}
+		if prop := alarm.Props.Get(ical.PropRepeat); prop != nil {
+			repeat, _ := prop.Int()
+			if prop := alarm.Props.Get(ical.PropDuration); prop != nil {
+				interval, _ := prop.Duration()
+				offset += time.Duration(repeat) * interval
+			}
+		}
+		if offset > span {
+			span = offset
+		}
+	}
+	return span
+}
+
+// between returns the instances which may overlap the time range [start,
+// end), which still need to be checked against it. Overridden instances are
+// excluded. A zero start or end leaves the range unbounded.
+func (r *recurrence) between(start, end time.Time) []*ical.Component {
+	var times []time.Time
+	if !end.IsZero() {
+		times = r.set.Between(start.Add(-r.slack), end.Add(r.slack), true)
+	} else {
+		// Instances of an unbounded recurrence only differ by their dates,
+		// so the first ones are enough to evaluate the rest
+		from := start.Add(r.slack)
+		if !start.IsZero() {
+			times = r.set.Between(start.Add(-r.slack), from, true)
+		}
+		times = append(times, r.firstAfter(from)...)
+		for _, f := range r.future {
+			if f.recurrenceID.After(from) {
+				times = append(times, r.firstAfter(f.recurrenceID)...)
+			}
+		}
+	}
+	return r.instances(times)
+}
+
+// firstAfter returns the first two instances which aren't overridden after
+// t.
+func (r *recurrence) firstAfter(t time.Time) []time.Time {
+	var times []time.Time
+	for i := 0; len(times) < 2 && i < len(r.overridden)+2; i++ {
+		t = r.set.After(t, i == 0)
+		if t.IsZero() {
+			break
+		}
+		if !r.overridden[t.UTC()] {
+			times = append(times, t)
+		}
+	}
+	return times
+}
+
+// instances creates the instances with the provided recurrence IDs.
+func (r *recurrence) instances(times []time.Time) []*ical.Component {
+	var out []*ical.Component
+	for _, t := range times {
+		if r.overridden[t.UTC()] {
+			continue
+		}
+
+		base, start, dur := r.master, t, r.dur
+		if d, ok := r.periods[t.UTC()]; ok {
+			dur = d
+		}
+		for _, f := range r.future {
+			if !f.recurrenceID.Before(t) {
+				break
+			}
+			base, start, dur = f.comp, t.Add(f.offset), f.dur
+		}
+		out = append(out, newInstance(base, t, start, dur, r.loc))
+	}
+	return out
+}
+
+// newInstance creates the instance of a recurring component with the
+// provided recurrence ID, starting at start. Floating times are interpreted
+// in loc.
+func newInstance(base *ical.Component, recurrenceID, start time.Time, dur time.Duration, loc *time.Location) *ical.Component {
+	inst := componentToUTC(base, loc)
+	for _, name := range []string{ical.PropRecurrenceRule, ical.PropRecurrenceDates, ical.PropExceptionDates, "EXRULE"} {
+		inst.Props.Del(name)
+	}
+
+	allDay := isDate(base.Props.Get(ical.PropDateTimeStart))
+	setTime := func(name string, t time.Time) {
+		prop := ical.NewProp(name)
+		if allDay {
+			prop.SetDate(t)
+		} else {
+			prop.SetDateTime(t.UTC())
+		}
+		inst.Props.Set(prop)
+	}
+
+	setTime(ical.PropDateTimeStart, start)
+	setTime(ical.PropRecurrenceID, recurrenceID)
+	for _, name := range []string{ical.PropDateTimeEnd, ical.PropDue} {
+		if inst.Props.Get(name) != nil {
+			setTime(name, start.Add(dur))
+		}
+	}
+	if inst.Props.Get(ical.PropDuration) != nil {
+		inst.Props.Get(ical.PropDuration).SetDuration(dur)
+	}
+	return inst
+}
+
+// componentToUTC returns a copy of a component where date-time values with a
+// time zone are converted to UTC. Floating times are interpreted in loc.
+func componentToUTC(comp *ical.Component, loc *time.Location) *ical.Component {
+	out := &ical.Component{
+		Name:  comp.Name,
+		Props: cloneProps(comp.Props),
+	}
+	for name, props := range out.Props {
+		for i := range props {
+			prop := &props[i]
+			if prop.ValueType() != ical.ValueDateTime || isDate(prop) || strings.HasSuffix(prop.Value, "Z") {
+				continue
+			}
+			l, err := dateTimeList(prop, loc)
+			if err != nil {
+				// Leave values we can't parse alone
+				continue
+			}
+			values := make([]string, len(l))
+			for j, t := range l {
+				values[j] = t.UTC().Format("20060102T150405Z")
+			}
+			prop.Value = strings.Join(values, ",")
+			prop.Params.Del(ical.PropTimezoneID)
+		}
+		out.Props[name] = props
+	}
+	for _, child := range comp.Children {
+		out.Children = append(out.Children, componentToUTC(child, loc))
+	}
+	return out
+}
+
+// parsePeriod parses a PERIOD value, as defined in RFC 5545 section 3.3.9.
+func parsePeriod(s, tzid string, loc *time.Location) (start, end time.Time, err error) {
+	parts := strings.SplitN(s, "/", 2)
+	if len(parts) != 2 {
+		return time.Time{}, time.Time{}, fmt.Errorf("caldav: invalid period %q", s)
+	}
+
+	newProp := func(name, v string) *ical.Prop {
+		prop := &ical.Prop{Name: name, Params: make(ical.Params), Value: v}
+		if tzid != "" {
+			prop.Params.Set(ical.PropTimezoneID, tzid)
+		}
+		return prop
+	}
+
+	start, err = newProp(ical.PropDateTimeStart, parts[0]).DateTime(loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+
+	if v := strings.TrimLeft(parts[1], "+-"); strings.HasPrefix(v, "P") {
+		dur, err := newProp(ical.PropDuration, parts[1]).Duration()
+		if err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+		return start, start.Add(dur), nil
+	}
+
+	end, err = newProp(ical.PropDateTimeEnd, parts[1]).DateTime(loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	return start, end, nil
+}
+
+func cloneProps(props ical.Props) ical.Props {
+	out := make(ical.Props, len(props))
+	for name, l := range props {
+		cloned := make([]ical.Prop, len(l))
+		for i, prop := range l {
+			cloned[i] = prop
+			cloned[i].Params = make(ical.Params, len(prop.Params))
+			for k, v := range prop.Params {
+				cloned[i].Params[k] = append([]string(nil), v...)
+			}
+		}
+		out[name] = cloned
+	}
+	return out
+}
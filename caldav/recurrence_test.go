@@ -0,0 +1,119 @@
+package caldav
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-ical"
+)
+
+var recurringEvent = `BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:-//Example Corp.//CalDAV Client//EN
+BEGIN:VTIMEZONE
+TZID:US/Eastern
+BEGIN:STANDARD
+DTSTART:20001026T020000
+TZOFFSETFROM:-0400
+TZOFFSETTO:-0500
+END:STANDARD
+END:VTIMEZONE
+BEGIN:VEVENT
+UID:abcd3
+DTSTAMP:20060206T001121Z
+DTSTART;TZID=US/Eastern:20060102T120000
+DURATION:PT1H
+RRULE:FREQ=DAILY;COUNT=5
+EXDATE;TZID=US/Eastern:20060104T120000
+SUMMARY:Daily event
+END:VEVENT
+BEGIN:VEVENT
+UID:abcd3
+DTSTAMP:20060206T001121Z
+RECURRENCE-ID;TZID=US/Eastern:20060105T120000
+DTSTART;TZID=US/Eastern:20060105T140000
+DURATION:PT1H
+SUMMARY:Moved event
+END:VEVENT
+END:VCALENDAR
+`
+
+func parseRecurringEvent(t *testing.T) *ical.Calendar {
+	cal, err := ical.NewDecoder(strings.NewReader(strings.ReplaceAll(recurringEvent, "\n", "\r\n"))).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cal
+}
+
+func TestExpandCalendar(t *testing.T) {
+	cal := parseRecurringEvent(t)
+
+	expanded, err := ExpandCalendar(cal, toDate(t, "20060103T000000Z"), toDate(t, "20060106T000000Z"))
+	if err != nil {
+		t.Fatalf("ExpandCalendar() = %v", err)
+	}
+
+	type instance struct {
+		recurrenceID, start, summary string
+	}
+	expected := []instance{
+		{"20060103T170000Z", "20060103T170000Z", "Daily event"},
+		{"20060105T170000Z", "20060105T190000Z", "Moved event"},
+	}
+	var got []instance
+	for _, comp := range expanded.Children {
+		if comp.Name != ical.CompEvent {
+			t.Errorf("ExpandCalendar() returned a %v component", comp.Name)
+			continue
+		}
+		for _, name := range []string{ical.PropRecurrenceRule, ical.PropExceptionDates} {
+			if comp.Props.Get(name) != nil {
+				t.Errorf("ExpandCalendar() returned an instance with %v", name)
+			}
+		}
+		summary, _ := comp.Props.Text(ical.PropSummary)
+		got = append(got, instance{
+			recurrenceID: comp.Props.Get(ical.PropRecurrenceID).Value,
+			start:        comp.Props.Get(ical.PropDateTimeStart).Value,
+			summary:      summary,
+		})
+	}
+	if len(got) != len(expected) {
+		t.Fatalf("ExpandCalendar() returned instances %v, expected %v", got, expected)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("ExpandCalendar() instance #%v = %v, expected %v", i, got[i], expected[i])
+		}
+	}
+
+	if len(cal.Children) != 3 || cal.Children[1].Props.Get(ical.PropRecurrenceRule) == nil {
+		t.Errorf("ExpandCalendar() modified the original calendar")
+	}
+}
+
+func TestLimitRecurrenceSet(t *testing.T) {
+	cal := parseRecurringEvent(t)
+
+	limited, err := LimitRecurrenceSet(cal, toDate(t, "20060101T000000Z"), toDate(t, "20060103T000000Z"))
+	if err != nil {
+		t.Fatalf("LimitRecurrenceSet() = %v", err)
+	}
+	if len(limited.Children) != 2 || limited.Children[1].Props.Get(ical.PropRecurrenceRule) == nil {
+		t.Errorf("LimitRecurrenceSet() returned %v components, expected the time zone and the master event", len(limited.Children))
+	}
+
+	limited, err = LimitRecurrenceSet(cal, toDate(t, "20060105T000000Z"), toDate(t, "20060106T000000Z"))
+	if err != nil {
+		t.Fatalf("LimitRecurrenceSet() = %v", err)
+	}
+	if len(limited.Children) != 3 {
+		t.Errorf("LimitRecurrenceSet() returned %v components, expected the overridden instance to be kept", len(limited.Children))
+	}
+
+	limited.Props.SetText(ical.PropProductID, "-//Example Corp.//Limited//EN")
+	if v, _ := cal.Props.Text(ical.PropProductID); v == "-//Example Corp.//Limited//EN" {
+		t.Errorf("LimitRecurrenceSet() shares its properties with the original calendar")
+	}
+}
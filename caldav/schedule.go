@@ -0,0 +1,475 @@
+package caldav
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"path"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-ical"
+	"github.com/emersion/go-webdav/internal"
+)
+
+// ScheduleMethod is an iTIP method, as defined in RFC 5546 section 1.4.
+type ScheduleMethod string
+
+const (
+	ScheduleRequest ScheduleMethod = "REQUEST"
+	ScheduleReply   ScheduleMethod = "REPLY"
+	ScheduleCancel  ScheduleMethod = "CANCEL"
+)
+
+// Scheduling parameters, as defined in RFC 6638 section 7.
+const (
+	paramScheduleAgent     = "SCHEDULE-AGENT"
+	paramScheduleStatus    = "SCHEDULE-STATUS"
+	paramScheduleForceSend = "SCHEDULE-FORCE-SEND"
+)
+
+// Request statuses, as defined in RFC 5546 section 3.6.
+const (
+	requestStatusSuccess             = "2.0;Success"
+	requestStatusInvalidCalendarUser = "3.7;Invalid calendar user"
+	requestStatusServiceUnavailable  = "5.1;Service unavailable"
+)
+
+func containsAddress(addrs []string, addr string) bool {
+	for _, a := range addrs {
+		if strings.EqualFold(a, addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// calendarUserHref converts a calendar user address to an href.
+func calendarUserHref(addr string) internal.Href {
+	u, err := url.Parse(addr)
+	if err != nil {
+		return internal.Href{Path: addr}
+	}
+	return internal.Href(*u)
+}
+
+// schedulingComponents returns the components of a calendar object which
+// take part in scheduling, i.e. everything but time zones.
+func schedulingComponents(cal *ical.Calendar) []*ical.Component {
+	var l []*ical.Component
+	for _, child := range cal.Children {
+		if child.Name != ical.CompTimezone {
+			l = append(l, child)
+		}
+	}
+	return l
+}
+
+// organizerAddress returns the address of the organizer of a calendar
+// object, or an empty string if it isn't a scheduling object.
+func organizerAddress(cal *ical.Calendar) string {
+	for _, comp := range schedulingComponents(cal) {
+		if prop := comp.Props.Get(ical.PropOrganizer); prop != nil {
+			return prop.Value
+		}
+	}
+	return ""
+}
+
+// scheduledByServer reports whether the server is responsible for
+// scheduling the calendar user of an ORGANIZER or ATTENDEE property.
+func scheduledByServer(prop *ical.Prop) bool {
+	agent := prop.Params.Get(paramScheduleAgent)
+	return agent == "" || strings.EqualFold(agent, "SERVER")
+}
+
+func findAttendee(comp *ical.Component, addr string) *ical.Prop {
+	props := comp.Props[ical.PropAttendee]
+	for i := range props {
+		if strings.EqualFold(props[i].Value, addr) {
+			return &props[i]
+		}
+	}
+	return nil
+}
+
+// attendeeAddresses returns the addresses of the attendees of a calendar
+// object which are scheduled by the server, excluding the organizer.
+func attendeeAddresses(cal *ical.Calendar, organizer string) []string {
+	if cal == nil {
+		return nil
+	}
+	var l []string
+	for _, comp := range schedulingComponents(cal) {
+		for _, prop := range comp.Props[ical.PropAttendee] {
+			if strings.EqualFold(prop.Value, organizer) || !scheduledByServer(&prop) || containsAddress(l, prop.Value) {
+				continue
+			}
+			l = append(l, prop.Value)
+		}
+	}
+	return l
+}
+
+// participationStatus returns the participation status of an attendee in
+// each component of a calendar object, indexed by RECURRENCE-ID.
+func participationStatus(cal *ical.Calendar, attendee string) map[string]string {
+	m := make(map[string]string)
+	if cal == nil {
+		return m
+	}
+	for _, comp := range schedulingComponents(cal) {
+		prop := findAttendee(comp, attendee)
+		if prop == nil {
+			continue
+		}
+		var recurrenceID string
+		if prop := comp.Props.Get(ical.PropRecurrenceID); prop != nil {
+			recurrenceID = prop.Value
+		}
+		partStat := strings.ToUpper(prop.Params.Get(ical.ParamParticipationStatus))
+		if partStat == "" {
+			partStat = "NEEDS-ACTION"
+		}
+		m[recurrenceID] = partStat
+	}
+	return m
+}
+
+func newScheduleMessage(method ScheduleMethod) *ical.Calendar {
+	msg := ical.NewCalendar()
+	msg.Props.SetText(ical.PropVersion, "2.0")
+	msg.Props.SetText(ical.PropProductID, prodID)
+	msg.Props.SetText(ical.PropMethod, string(method))
+	return msg
+}
+
+func cloneComponent(comp *ical.Component) *ical.Component {
+	out := &ical.Component{
+		Name:  comp.Name,
+		Props: cloneProps(comp.Props),
+	}
+	for _, child := range comp.Children {
+		out.Children = append(out.Children, cloneComponent(child))
+	}
+	return out
+}
+
+// scheduleMessageFromObject creates an iTIP message from a calendar object. If
+// attendee isn't empty, the message only contains the components this
+// attendee takes part in, without the other attendees and without
+// sub-components. Scheduling parameters are removed.
+func scheduleMessageFromObject(method ScheduleMethod, cal *ical.Calendar, attendee string) *ical.Calendar {
+	msg := newScheduleMessage(method)
+	for _, child := range cal.Children {
+		if child.Name == ical.CompTimezone {
+			msg.Children = append(msg.Children, cloneComponent(child))
+			continue
+		}
+		if attendee != "" && findAttendee(child, attendee) == nil {
+			continue
+		}
+
+		comp := cloneComponent(child)
+		if attendee != "" {
+			comp.Children = nil
+		}
+		for _, name := range []string{ical.PropOrganizer, ical.PropAttendee} {
+			var props []ical.Prop
+			for _, prop := range comp.Props[name] {
+				if name == ical.PropAttendee && attendee != "" && !strings.EqualFold(prop.Value, attendee) {
+					continue
+				}
+				for _, param := range []string{paramScheduleAgent, paramScheduleStatus, paramScheduleForceSend} {
+					prop.Params.Del(param)
+				}
+				props = append(props, prop)
+			}
+			if len(props) > 0 {
+				comp.Props[name] = props
+			}
+		}
+		comp.Props.SetDateTime(ical.PropDateTimeStamp, time.Now().UTC())
+		msg.Children = append(msg.Children, comp)
+	}
+	return msg
+}
+
+// newCancelMessage creates an iTIP CANCEL message for an attendee removed
+// from a calendar object.
+func newCancelMessage(cal *ical.Calendar, attendee string) *ical.Calendar {
+	msg := scheduleMessageFromObject(ScheduleCancel, cal, attendee)
+	for _, comp := range schedulingComponents(msg) {
+		comp.Props.SetText(ical.PropStatus, "CANCELLED")
+	}
+	return msg
+}
+
+// newReplyMessage creates an iTIP REPLY message for an attendee. If
+// partStat isn't empty, it overrides the participation status of the
+// attendee.
+func newReplyMessage(cal *ical.Calendar, attendee, partStat string) *ical.Calendar {
+	msg := scheduleMessageFromObject(ScheduleReply, cal, attendee)
+	if partStat != "" {
+		for _, comp := range schedulingComponents(msg) {
+			findAttendee(comp, attendee).Params.Set(ical.ParamParticipationStatus, partStat)
+		}
+	}
+	return msg
+}
+
+// scheduleObjectData returns the calendar object stored at p before it's
+// modified, if implicit scheduling is enabled. It returns nil if there is no
+// such object.
+func (b *backend) scheduleObjectData(ctx context.Context, p string) (*ical.Calendar, error) {
+	if _, ok := b.Backend.(SchedulingBackend); !ok {
+		return nil, nil
+	}
+	co, err := b.Backend.GetCalendarObject(ctx, p, &CalendarCompRequest{AllProps: true, AllComps: true})
+	if internal.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return co.Data, nil
+}
+
+// Schedule statuses, as defined in RFC 6638 section 3.2.9.
+const (
+	scheduleStatusSent                = "1.1"
+	scheduleStatusDelivered           = "1.2"
+	scheduleStatusInvalidCalendarUser = "3.7"
+	scheduleStatusDeliveryFailed      = "5.1"
+)
+
+// significantProps are the properties whose changes are significant for
+// attendees, as described in RFC 6638 section 3.2.8.
+var significantProps = []string{
+	ical.PropDateTimeStart,
+	ical.PropDateTimeEnd,
+	ical.PropDuration,
+	ical.PropDue,
+	ical.PropRecurrenceRule,
+	ical.PropRecurrenceDates,
+	ical.PropExceptionDates,
+	ical.PropStatus,
+	ical.PropSequence,
+}
+
+func recurrenceID(comp *ical.Component) string {
+	if prop := comp.Props.Get(ical.PropRecurrenceID); prop != nil {
+		return prop.Value
+	}
+	return ""
+}
+
+func propsEqual(a, b []ical.Prop) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Value != b[i].Value || !reflect.DeepEqual(a[i].Params, b[i].Params) {
+			return false
+		}
+	}
+	return true
+}
+
+// significantChange reports whether a calendar object has been changed in a
+// way which requires attendees to be sent a new REQUEST: a change in the
+// time or recurrence of a component, in its status or sequence number, in
+// the set of components or in the set of attendees.
+func significantChange(old, cur *ical.Calendar) bool {
+	oldComps := make(map[string]*ical.Component)
+	for _, comp := range schedulingComponents(old) {
+		oldComps[recurrenceID(comp)] = comp
+	}
+	curComps := schedulingComponents(cur)
+	if len(curComps) != len(oldComps) {
+		return true
+	}
+
+	for _, comp := range curComps {
+		oldComp, ok := oldComps[recurrenceID(comp)]
+		if !ok || comp.Name != oldComp.Name {
+			return true
+		}
+		for _, name := range significantProps {
+			if !propsEqual(comp.Props[name], oldComp.Props[name]) {
+				return true
+			}
+		}
+
+		attendees, oldAttendees := comp.Props[ical.PropAttendee], oldComp.Props[ical.PropAttendee]
+		if len(attendees) != len(oldAttendees) {
+			return true
+		}
+		for _, prop := range attendees {
+			if findAttendee(oldComp, prop.Value) == nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// forceSendRequest reports whether the organizer asked for a REQUEST to be
+// sent to an attendee with the SCHEDULE-FORCE-SEND parameter.
+func forceSendRequest(cal *ical.Calendar, attendee string) bool {
+	for _, comp := range schedulingComponents(cal) {
+		prop := findAttendee(comp, attendee)
+		if prop != nil && strings.EqualFold(prop.Params.Get(paramScheduleForceSend), string(ScheduleRequest)) {
+			return true
+		}
+	}
+	return false
+}
+
+// setScheduleStatus sets the SCHEDULE-STATUS parameter of the ORGANIZER and
+// ATTENDEE properties of a calendar object, from a map of schedule statuses
+// indexed by calendar user address. It reports whether the object has been
+// modified.
+func setScheduleStatus(cal *ical.Calendar, statuses map[string]string) bool {
+	modified := false
+	for _, comp := range schedulingComponents(cal) {
+		for _, name := range []string{ical.PropOrganizer, ical.PropAttendee} {
+			props := comp.Props[name]
+			for i := range props {
+				for addr, status := range statuses {
+					if !strings.EqualFold(props[i].Value, addr) || props[i].Params.Get(paramScheduleStatus) == status {
+						continue
+					}
+					props[i].Params.Set(paramScheduleStatus, status)
+					modified = true
+				}
+			}
+		}
+	}
+	return modified
+}
+
+// scheduleChange performs implicit scheduling, as defined in RFC 6638
+// section 3.2, after the calendar object at p has been created or updated
+// (old is nil if it didn't exist before), or deleted (cur is nil).
+//
+// If the current user is the organizer, REQUEST messages are sent to the
+// attendees when the object changes significantly, and CANCEL messages to
+// the removed attendees. If the current user is an attendee, a REPLY message
+// is sent to the organizer when the participation status changes.
+//
+// The schedule status of each recipient is returned, indexed by calendar
+// user address. The returned error is the first delivery failure, if any.
+func (b *backend) scheduleChange(ctx context.Context, p string, old, cur *ical.Calendar) (map[string]string, error) {
+	sb, ok := b.Backend.(SchedulingBackend)
+	if !ok {
+		return nil, nil
+	}
+
+	// Messages in the inbox aren't scheduling objects
+	inboxPath, err := sb.ScheduleInboxPath(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if path.Dir(path.Clean(p)) == path.Clean(inboxPath) {
+		return nil, nil
+	}
+
+	cal := cur
+	if cal == nil {
+		cal = old
+	}
+	if cal == nil {
+		return nil, nil
+	}
+	organizer := organizerAddress(cal)
+	if organizer == "" {
+		return nil, nil
+	}
+
+	addrs, err := sb.CalendarUserAddressSet(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make(map[string]string)
+	var firstErr error
+	deliver := func(originator, recipient string, msg *ical.Calendar) {
+		status, err := b.deliverScheduleMessage(ctx, sb, originator, recipient, msg)
+		if err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("caldav: failed to deliver scheduling message to %v: %v", recipient, err)
+		}
+		statuses[recipient] = status
+	}
+
+	if containsAddress(addrs, organizer) {
+		attendees := attendeeAddresses(cur, organizer)
+		oldAttendees := attendeeAddresses(old, organizer)
+		significant := old == nil || cur != nil && significantChange(old, cur)
+		for _, attendee := range attendees {
+			if significant || !containsAddress(oldAttendees, attendee) || forceSendRequest(cur, attendee) {
+				deliver(organizer, attendee, scheduleMessageFromObject(ScheduleRequest, cur, ""))
+			}
+		}
+		for _, attendee := range oldAttendees {
+			if !containsAddress(attendees, attendee) {
+				deliver(organizer, attendee, newCancelMessage(old, attendee))
+			}
+		}
+		return statuses, firstErr
+	}
+
+	for _, comp := range schedulingComponents(cal) {
+		if prop := comp.Props.Get(ical.PropOrganizer); prop != nil && !scheduledByServer(prop) {
+			return nil, nil
+		}
+	}
+
+	var attendee string
+	for _, addr := range addrs {
+		if len(participationStatus(cal, addr)) > 0 {
+			attendee = addr
+			break
+		}
+	}
+	if attendee == "" {
+		return nil, nil
+	}
+
+	if cur == nil {
+		deliver(attendee, organizer, newReplyMessage(old, attendee, "DECLINED"))
+		return statuses, firstErr
+	}
+
+	oldPartStat := participationStatus(old, attendee)
+	changed := false
+	for recurrenceID, partStat := range participationStatus(cur, attendee) {
+		prev, ok := oldPartStat[recurrenceID]
+		if ok && prev != partStat || !ok && partStat != "NEEDS-ACTION" {
+			changed = true
+		}
+	}
+	if changed {
+		deliver(attendee, organizer, newReplyMessage(cur, attendee, ""))
+	}
+	return statuses, firstErr
+}
+
+// deliverScheduleMessage delivers an iTIP message to the inbox of a local
+// calendar user, or with the ScheduleSender if the recipient isn't local. It
+// returns the resulting schedule status.
+func (b *backend) deliverScheduleMessage(ctx context.Context, sb SchedulingBackend, originator, recipient string, msg *ical.Calendar) (string, error) {
+	err := sb.DeliverScheduleMessage(ctx, originator, recipient, msg)
+	if err == nil {
+		return scheduleStatusDelivered, nil
+	} else if !internal.IsNotFound(err) {
+		return scheduleStatusDeliveryFailed, err
+	}
+	if b.ScheduleSender == nil {
+		return scheduleStatusInvalidCalendarUser, nil
+	}
+	if err := b.ScheduleSender.SendScheduleMessage(ctx, originator, recipient, msg); err != nil {
+		return scheduleStatusDeliveryFailed, err
+	}
+	return scheduleStatusSent, nil
+}
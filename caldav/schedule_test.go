@@ -0,0 +1,379 @@
+package caldav
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-ical"
+	"github.com/emersion/go-webdav/internal"
+)
+
+type testScheduleMessage struct {
+	originator, recipient string
+	msg                   *ical.Calendar
+}
+
+type testScheduleBackend struct {
+	testBackend
+	objects   map[string]*ical.Calendar
+	delivered *[]testScheduleMessage
+}
+
+func (t testScheduleBackend) GetCalendarObject(ctx context.Context, path string, req *CalendarCompRequest) (*CalendarObject, error) {
+	cal, ok := t.objects[path]
+	if !ok {
+		return nil, internal.HTTPErrorf(http.StatusNotFound, "calendar object not found")
+	}
+	return &CalendarObject{Path: path, Data: cal}, nil
+}
+
+func (t testScheduleBackend) PutCalendarObject(ctx context.Context, path string, calendar *ical.Calendar, opts *PutCalendarObjectOptions) (*PutCalendarObjectResult, error) {
+	_, exists := t.objects[path]
+	t.objects[path] = calendar
+	return &PutCalendarObjectResult{CalendarObject: CalendarObject{Path: path, Data: calendar}, Created: !exists}, nil
+}
+
+func (t testScheduleBackend) DeleteCalendarObject(ctx context.Context, path string) error {
+	delete(t.objects, path)
+	return nil
+}
+
+func (t testScheduleBackend) CalendarUserAddressSet(ctx context.Context) ([]string, error) {
+	return []string{"mailto:alice@example.org"}, nil
+}
+
+func (t testScheduleBackend) ScheduleInboxPath(ctx context.Context) (string, error) {
+	return "/user/calendars/inbox/", nil
+}
+
+func (t testScheduleBackend) ScheduleOutboxPath(ctx context.Context) (string, error) {
+	return "/user/calendars/outbox/", nil
+}
+
+func (t testScheduleBackend) DeliverScheduleMessage(ctx context.Context, originator, recipient string, msg *ical.Calendar) error {
+	if strings.EqualFold(recipient, "mailto:erin@example.org") {
+		return fmt.Errorf("inbox full")
+	}
+	if !strings.EqualFold(recipient, "mailto:bob@example.org") {
+		return internal.HTTPErrorf(http.StatusNotFound, "unknown calendar user")
+	}
+	*t.delivered = append(*t.delivered, testScheduleMessage{originator, recipient, msg})
+	return nil
+}
+
+func (t testScheduleBackend) CalendarUserFreeBusy(ctx context.Context, recipient string, start, end time.Time) (*ical.Component, error) {
+	if !strings.EqualFold(recipient, "mailto:bob@example.org") {
+		return nil, internal.HTTPErrorf(http.StatusNotFound, "unknown calendar user")
+	}
+	return FreeBusy(nil, start, end, nil)
+}
+
+type testScheduleSender struct {
+	sent *[]testScheduleMessage
+}
+
+func (t testScheduleSender) SendScheduleMessage(ctx context.Context, originator, recipient string, msg *ical.Calendar) error {
+	*t.sent = append(*t.sent, testScheduleMessage{originator, recipient, msg})
+	return nil
+}
+
+var scheduleEvent = `BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:-//Example Corp.//CalDAV Client//EN
+BEGIN:VEVENT
+UID:meeting
+DTSTAMP:20060206T001121Z
+DTSTART:20060104T140000Z
+DURATION:PT1H
+SUMMARY:Meeting
+ORGANIZER:%s
+%sEND:VEVENT
+END:VCALENDAR
+`
+
+func newScheduleEvent(organizer string, attendees ...string) string {
+	var props string
+	for _, attendee := range attendees {
+		props += "ATTENDEE;" + attendee + "\n"
+	}
+	return strings.ReplaceAll(fmt.Sprintf(scheduleEvent, organizer, props), "\n", "\r\n")
+}
+
+func newScheduleHandler(delivered, sent *[]testScheduleMessage) (*Handler, testScheduleBackend) {
+	backend := testScheduleBackend{
+		testBackend: testBackend{calendars: []Calendar{{Path: "/user/calendars/a/"}}},
+		objects:     make(map[string]*ical.Calendar),
+		delivered:   delivered,
+	}
+	return &Handler{Backend: backend, ScheduleSender: testScheduleSender{sent}}, backend
+}
+
+func serveScheduleRequest(t *testing.T, handler *Handler, method, path, body string) (*http.Response, string) {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if strings.HasPrefix(body, "BEGIN:VCALENDAR") {
+		req.Header.Set("Content-Type", ical.MIMEType)
+	} else if body != "" {
+		req.Header.Set("Content-Type", "application/xml")
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	res := w.Result()
+	defer res.Body.Close()
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res, string(data)
+}
+
+func checkScheduleMessages(t *testing.T, got []testScheduleMessage, expected ...string) {
+	t.Helper()
+	var l []string
+	for _, m := range got {
+		method, _ := m.msg.Props.Text(ical.PropMethod)
+		s := method + " " + m.recipient
+		if method == string(ScheduleReply) {
+			for _, comp := range schedulingComponents(m.msg) {
+				s += " " + comp.Props.Get(ical.PropAttendee).Params.Get(ical.ParamParticipationStatus)
+			}
+		}
+		l = append(l, s)
+	}
+	if strings.Join(l, ", ") != strings.Join(expected, ", ") {
+		t.Errorf("got scheduling messages %v, expected %v", l, expected)
+	}
+}
+
+var propFindScheduling = `
+<?xml version="1.0" encoding="UTF-8"?>
+<A:propfind xmlns:A="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">
+  <A:prop>
+    <A:resourcetype/>
+    <C:schedule-inbox-URL/>
+    <C:schedule-outbox-URL/>
+    <C:calendar-user-address-set/>
+  </A:prop>
+</A:propfind>
+`
+
+func TestSchedulingPropFind(t *testing.T) {
+	var delivered, sent []testScheduleMessage
+	handler, _ := newScheduleHandler(&delivered, &sent)
+
+	_, resp := serveScheduleRequest(t, handler, "PROPFIND", "/user/", propFindScheduling)
+	for _, s := range []string{
+		`<schedule-inbox-URL xmlns="urn:ietf:params:xml:ns:caldav"><href xmlns="DAV:">/user/calendars/inbox/</href></schedule-inbox-URL>`,
+		`<schedule-outbox-URL xmlns="urn:ietf:params:xml:ns:caldav"><href xmlns="DAV:">/user/calendars/outbox/</href></schedule-outbox-URL>`,
+		`<href xmlns="DAV:">mailto:alice@example.org</href>`,
+	} {
+		if !strings.Contains(resp, s) {
+			t.Errorf("PROPFIND on the principal doesn't contain %v:\n%v", s, resp)
+		}
+	}
+
+	_, resp = serveScheduleRequest(t, handler, "PROPFIND", "/user/calendars/inbox/", propFindScheduling)
+	if !strings.Contains(resp, `<schedule-inbox xmlns="urn:ietf:params:xml:ns:caldav"></schedule-inbox>`) {
+		t.Errorf("PROPFIND on the inbox doesn't return its resource type:\n%v", resp)
+	}
+
+	res, _ := serveScheduleRequest(t, handler, "OPTIONS", "/user/calendars/outbox/", "")
+	if !strings.Contains(res.Header.Get("DAV"), "calendar-auto-schedule") {
+		t.Errorf("OPTIONS returned DAV header %q, expected calendar-auto-schedule", res.Header.Get("DAV"))
+	}
+	if !strings.Contains(res.Header.Get("Allow"), "POST") {
+		t.Errorf("OPTIONS on the outbox returned Allow header %q, expected POST", res.Header.Get("Allow"))
+	}
+}
+
+func TestImplicitScheduling_organizer(t *testing.T) {
+	var delivered, sent []testScheduleMessage
+	handler, _ := newScheduleHandler(&delivered, &sent)
+	p := "/user/calendars/a/meeting.ics"
+
+	body := newScheduleEvent("mailto:alice@example.org",
+		"PARTSTAT=ACCEPTED:mailto:alice@example.org",
+		"PARTSTAT=NEEDS-ACTION:mailto:bob@example.org",
+		"PARTSTAT=NEEDS-ACTION:mailto:carol@example.com",
+		"SCHEDULE-AGENT=CLIENT:mailto:dave@example.com")
+	if res, data := serveScheduleRequest(t, handler, "PUT", p, body); res.StatusCode != http.StatusCreated {
+		t.Fatalf("PUT returned status %v:\n%v", res.StatusCode, data)
+	}
+	checkScheduleMessages(t, delivered, "REQUEST mailto:bob@example.org")
+	checkScheduleMessages(t, sent, "REQUEST mailto:carol@example.com")
+	if attendees := delivered[0].msg.Children[0].Props[ical.PropAttendee]; len(attendees) != 4 || attendees[3].Params.Get(paramScheduleAgent) != "" {
+		t.Errorf("REQUEST contains attendees %v, expected all of them without scheduling parameters", attendees)
+	}
+
+	// Remove an attendee
+	delivered, sent = nil, nil
+	body = newScheduleEvent("mailto:alice@example.org",
+		"PARTSTAT=ACCEPTED:mailto:alice@example.org",
+		"PARTSTAT=NEEDS-ACTION:mailto:bob@example.org")
+	serveScheduleRequest(t, handler, "PUT", p, body)
+	checkScheduleMessages(t, delivered, "REQUEST mailto:bob@example.org")
+	checkScheduleMessages(t, sent, "CANCEL mailto:carol@example.com")
+	if status, _ := sent[0].msg.Children[0].Props.Text(ical.PropStatus); status != "CANCELLED" {
+		t.Errorf("CANCEL has status %q", status)
+	}
+
+	delivered, sent = nil, nil
+	serveScheduleRequest(t, handler, "DELETE", p, "")
+	checkScheduleMessages(t, delivered, "CANCEL mailto:bob@example.org")
+	checkScheduleMessages(t, sent)
+}
+
+func scheduleStatus(cal *ical.Calendar, attendee string) string {
+	prop := findAttendee(cal.Children[0], attendee)
+	if prop == nil {
+		return ""
+	}
+	return prop.Params.Get(paramScheduleStatus)
+}
+
+func TestImplicitScheduling_significantChanges(t *testing.T) {
+	var delivered, sent []testScheduleMessage
+	handler, backend := newScheduleHandler(&delivered, &sent)
+	var logBuf bytes.Buffer
+	handler.ErrorLog = log.New(&logBuf, "", 0)
+	p := "/user/calendars/a/meeting.ics"
+
+	body := newScheduleEvent("mailto:alice@example.org",
+		"PARTSTAT=ACCEPTED:mailto:alice@example.org",
+		"PARTSTAT=NEEDS-ACTION:mailto:bob@example.org",
+		"PARTSTAT=NEEDS-ACTION:mailto:carol@example.com",
+		"PARTSTAT=NEEDS-ACTION:mailto:erin@example.org")
+	res, data := serveScheduleRequest(t, handler, "PUT", p, body)
+	if res.StatusCode != http.StatusCreated {
+		t.Fatalf("PUT returned status %v:\n%v", res.StatusCode, data)
+	}
+	if res.Header.Get("ETag") != "" {
+		t.Errorf("PUT returned an ETag, but the stored object has schedule statuses")
+	}
+
+	// The delivery status of each attendee is recorded
+	for attendee, status := range map[string]string{
+		"mailto:alice@example.org": "",
+		"mailto:bob@example.org":   "1.2",
+		"mailto:carol@example.com": "1.1",
+		"mailto:erin@example.org":  "5.1",
+	} {
+		if got := scheduleStatus(backend.objects[p], attendee); got != status {
+			t.Errorf("%v has schedule status %q, expected %q", attendee, got, status)
+		}
+	}
+	if !strings.Contains(logBuf.String(), "inbox full") {
+		t.Errorf("delivery failure wasn't logged: %q", logBuf.String())
+	}
+
+	for _, tc := range []struct {
+		name     string
+		body     string
+		expected []string
+	}{
+		{"same", body, nil},
+		{"description", strings.Replace(body, "SUMMARY:Meeting\r\n", "SUMMARY:Meeting\r\nDESCRIPTION:Agenda\r\n", 1), nil},
+		{"partstat", strings.Replace(body, "PARTSTAT=NEEDS-ACTION:mailto:bob", "PARTSTAT=ACCEPTED:mailto:bob", 1), nil},
+		{"sequence", strings.Replace(body, "SUMMARY:Meeting\r\n", "SUMMARY:Meeting\r\nSEQUENCE:1\r\n", 1), []string{"REQUEST mailto:bob@example.org"}},
+		{"dtstart", strings.Replace(body, "DTSTART:20060104T140000Z", "DTSTART:20060104T150000Z", 1), []string{"REQUEST mailto:bob@example.org"}},
+		{"force-send", strings.Replace(body, "PARTSTAT=NEEDS-ACTION:mailto:bob", "SCHEDULE-FORCE-SEND=REQUEST;PARTSTAT=NEEDS-ACTION:mailto:bob", 1), []string{"REQUEST mailto:bob@example.org"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			delete(backend.objects, p)
+			serveScheduleRequest(t, handler, "PUT", p, body)
+			delivered = nil
+			serveScheduleRequest(t, handler, "PUT", p, tc.body)
+			checkScheduleMessages(t, delivered, tc.expected...)
+		})
+	}
+}
+
+func TestImplicitScheduling_attendee(t *testing.T) {
+	var delivered, sent []testScheduleMessage
+	handler, backend := newScheduleHandler(&delivered, &sent)
+	p := "/user/calendars/a/meeting.ics"
+
+	invitation, err := ical.NewDecoder(strings.NewReader(newScheduleEvent("mailto:bob@example.org",
+		"PARTSTAT=NEEDS-ACTION:mailto:alice@example.org",
+		"PARTSTAT=NEEDS-ACTION:mailto:carol@example.com"))).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend.objects[p] = invitation
+
+	// Changing something else than the participation status doesn't send a
+	// reply
+	serveScheduleRequest(t, handler, "PUT", p, newScheduleEvent("mailto:bob@example.org",
+		"PARTSTAT=NEEDS-ACTION:mailto:alice@example.org",
+		"PARTSTAT=NEEDS-ACTION:mailto:carol@example.com"))
+	checkScheduleMessages(t, delivered)
+
+	serveScheduleRequest(t, handler, "PUT", p, newScheduleEvent("mailto:bob@example.org",
+		"PARTSTAT=ACCEPTED:mailto:alice@example.org",
+		"PARTSTAT=NEEDS-ACTION:mailto:carol@example.com"))
+	checkScheduleMessages(t, delivered, "REPLY mailto:bob@example.org ACCEPTED")
+	if attendees := delivered[0].msg.Children[0].Props[ical.PropAttendee]; len(attendees) != 1 {
+		t.Errorf("REPLY contains attendees %v, expected only the replying one", attendees)
+	}
+
+	delivered = nil
+	serveScheduleRequest(t, handler, "DELETE", p, "")
+	checkScheduleMessages(t, delivered, "REPLY mailto:bob@example.org DECLINED")
+	checkScheduleMessages(t, sent)
+}
+
+var scheduleFreeBusyRequest = `BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:-//Example Corp.//CalDAV Client//EN
+METHOD:REQUEST
+BEGIN:VFREEBUSY
+UID:4FD3AD926350
+DTSTAMP:20090602T190420Z
+DTSTART:20090602T000000Z
+DTEND:20090604T000000Z
+ORGANIZER:%s
+ATTENDEE:mailto:bob@example.org
+ATTENDEE:mailto:dave@example.com
+END:VFREEBUSY
+END:VCALENDAR
+`
+
+func TestScheduleOutboxFreeBusy(t *testing.T) {
+	var delivered, sent []testScheduleMessage
+	handler, _ := newScheduleHandler(&delivered, &sent)
+
+	body := strings.ReplaceAll(fmt.Sprintf(scheduleFreeBusyRequest, "mailto:alice@example.org"), "\n", "\r\n")
+	res, resp := serveScheduleRequest(t, handler, "POST", "/user/calendars/outbox/", body)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("POST returned status %v:\n%v", res.StatusCode, resp)
+	}
+	for _, s := range []string{
+		`<href xmlns="DAV:">mailto:bob@example.org</href></recipient><request-status>2.0;Success</request-status>`,
+		"METHOD:REPLY",
+		"BEGIN:VFREEBUSY",
+		`<href xmlns="DAV:">mailto:dave@example.com</href></recipient><request-status>3.7;Invalid calendar user</request-status>`,
+	} {
+		if !strings.Contains(resp, s) {
+			t.Errorf("schedule-response doesn't contain %v:\n%v", s, resp)
+		}
+	}
+
+	body = strings.ReplaceAll(fmt.Sprintf(scheduleFreeBusyRequest, "mailto:bob@example.org"), "\n", "\r\n")
+	res, resp = serveScheduleRequest(t, handler, "POST", "/user/calendars/outbox/", body)
+	if res.StatusCode != http.StatusConflict || !strings.Contains(resp, string(PreconditionOrganizerAllowed)) {
+		t.Errorf("POST with another organizer returned status %v:\n%v", res.StatusCode, resp)
+	}
+
+	res, _ = serveScheduleRequest(t, handler, "POST", "/user/calendars/a/", body)
+	if res.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("POST outside of the outbox returned status %v", res.StatusCode)
+	}
+}
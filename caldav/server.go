@@ -4,7 +4,9 @@ import (
 	"bytes"
 	"context"
 	"encoding/xml"
+	"errors"
 	"fmt"
+	"log"
 	"mime"
 	"net/http"
 	"path"
@@ -27,6 +29,18 @@ type PutCalendarObjectOptions struct {
 	IfMatch webdav.ConditionalMatch
 }
 
+// PutCalendarObjectResult is returned by Backend.PutCalendarObject.
+type PutCalendarObjectResult struct {
+	CalendarObject
+	// Created is true if the calendar object didn't exist before.
+	Created bool
+	// Modified is true if the backend altered the calendar object before storing
+	// it, for instance to normalize it. The ETag isn't returned to the client
+	// in that case, so that it fetches the stored version. The handler already
+	// withholds the ETag if the request body isn't in canonical encoding.
+	Modified bool
+}
+
 // Backend is a CalDAV server backend.
 type Backend interface {
 	CalendarHomeSetPath(ctx context.Context) (string, error)
@@ -38,17 +52,93 @@ type Backend interface {
 	GetCalendarObject(ctx context.Context, path string, req *CalendarCompRequest) (*CalendarObject, error)
 	ListCalendarObjects(ctx context.Context, path string, req *CalendarCompRequest) ([]CalendarObject, error)
 	QueryCalendarObjects(ctx context.Context, path string, query *CalendarQuery) ([]CalendarObject, error)
-	PutCalendarObject(ctx context.Context, path string, calendar *ical.Calendar, opts *PutCalendarObjectOptions) (*CalendarObject, error)
+	PutCalendarObject(ctx context.Context, path string, calendar *ical.Calendar, opts *PutCalendarObjectOptions) (*PutCalendarObjectResult, error)
 	DeleteCalendarObject(ctx context.Context, path string) error
 
 	webdav.UserPrincipalBackend
 }
 
+// SyncBackend is an optional interface which can be implemented by a Backend
+// to support collection synchronization, as defined in RFC 6578.
+//
+// If the sync token is invalid or too old, SyncCalendarObjects should return
+// an error created with NewInvalidSyncTokenError. Calendars should populate
+// their SyncToken field.
+type SyncBackend interface {
+	SyncCalendarObjects(ctx context.Context, path string, query *SyncQuery) (*SyncResponse, error)
+}
+
+// UpdateBackend is an optional interface which can be implemented by a
+// Backend to allow clients to update calendar properties with PROPPATCH.
+//
+// UpdateCalendar is called with the calendar returned by GetCalendar, with
+// the requested changes applied.
+type UpdateBackend interface {
+	UpdateCalendar(ctx context.Context, calendar *Calendar) error
+}
+
+// DeleteBackend is an optional interface which can be implemented by a
+// Backend to allow clients to delete calendars with DELETE.
+type DeleteBackend interface {
+	DeleteCalendar(ctx context.Context, path string) error
+}
+
+// FreeBusyBackend is an optional interface which can be implemented by a
+// Backend to compute free-busy information natively. Otherwise, the events
+// in the time range are fetched with QueryCalendarObjects and passed to
+// FreeBusy.
+//
+// QueryFreeBusy returns a VFREEBUSY component for the calendar at path.
+type FreeBusyBackend interface {
+	QueryFreeBusy(ctx context.Context, path string, start, end time.Time) (*ical.Component, error)
+}
+
+// SchedulingBackend is an optional interface which can be implemented by a
+// Backend to support scheduling, as defined in RFC 6638.
+//
+// The schedule inbox and outbox of the current user must be located in the
+// calendar home set, and shouldn't be returned by ListCalendars. Messages
+// delivered to the inbox are listed, fetched and deleted with the calendar
+// object methods of the Backend.
+//
+// Calendar user addresses are URIs, such as "mailto:alice@example.org".
+// DeliverScheduleMessage and CalendarUserFreeBusy should return a not found
+// error if the recipient isn't a local calendar user.
+type SchedulingBackend interface {
+	CalendarUserAddressSet(ctx context.Context) ([]string, error)
+	ScheduleInboxPath(ctx context.Context) (string, error)
+	ScheduleOutboxPath(ctx context.Context) (string, error)
+
+	// DeliverScheduleMessage stores an iTIP message in the schedule inbox of
+	// a local calendar user.
+	DeliverScheduleMessage(ctx context.Context, originator, recipient string, msg *ical.Calendar) error
+	// CalendarUserFreeBusy returns a VFREEBUSY component for a local
+	// calendar user. FreeBusy can be used to compute it.
+	CalendarUserFreeBusy(ctx context.Context, recipient string, start, end time.Time) (*ical.Component, error)
+}
+
+// ScheduleSender delivers iTIP messages to calendar users which aren't local,
+// for instance by email with iMIP (RFC 6047).
+type ScheduleSender interface {
+	SendScheduleMessage(ctx context.Context, originator, recipient string, msg *ical.Calendar) error
+}
+
 // Handler handles CalDAV HTTP requests. It can be used to create a CalDAV
 // server.
 type Handler struct {
 	Backend Backend
 	Prefix  string
+
+	// ScheduleSender is used to deliver scheduling messages to external
+	// calendar users if the Backend implements SchedulingBackend. If nil,
+	// these messages are dropped.
+	ScheduleSender ScheduleSender
+
+	// ErrorLog specifies an optional logger for errors which can't be
+	// reported to the client, such as failures to deliver scheduling
+	// messages after a calendar object has been stored. If nil, the log
+	// package's standard logger is used.
+	ErrorLog *log.Logger
 }
 
 // ServeHTTP implements http.Handler.
@@ -73,11 +163,28 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case "REPORT":
 		err = h.handleReport(w, r)
-	default:
+	case "MKCALENDAR":
+		b := backend{
+			Backend: h.Backend,
+			Prefix:  strings.TrimSuffix(h.Prefix, "/"),
+		}
+		err = b.Mkcol(r)
+		if err == nil {
+			w.WriteHeader(http.StatusCreated)
+		}
+	case http.MethodPost:
 		b := backend{
 			Backend: h.Backend,
 			Prefix:  strings.TrimSuffix(h.Prefix, "/"),
 		}
+		err = b.Post(w, r)
+	default:
+		b := backend{
+			Backend:        h.Backend,
+			Prefix:         strings.TrimSuffix(h.Prefix, "/"),
+			ScheduleSender: h.ScheduleSender,
+			ErrorLog:       h.ErrorLog,
+		}
 		hh := internal.Handler{Backend: &b}
 		hh.ServeHTTP(w, r)
 	}
@@ -97,8 +204,23 @@ func (h *Handler) handleReport(w http.ResponseWriter, r *http.Request) error {
 		return h.handleQuery(r, w, report.Query)
 	} else if report.Multiget != nil {
 		return h.handleMultiget(r.Context(), w, report.Multiget)
+	} else if report.SyncCollection != nil {
+		return h.handleSyncCollection(r, w, report.SyncCollection)
+	} else if report.FreeBusyQuery != nil {
+		return h.handleFreeBusyQuery(r, w, report.FreeBusyQuery)
 	}
-	return internal.HTTPErrorf(http.StatusBadRequest, "caldav: expected calendar-query or calendar-multiget element in REPORT request")
+	return internal.HTTPErrorf(http.StatusBadRequest, "caldav: expected calendar-query, calendar-multiget, sync-collection or free-busy-query element in REPORT request")
+}
+
+func decodeTextMatch(el *textMatch) (*TextMatch, error) {
+	if !internal.IsSupportedCollation(el.Collation) {
+		return nil, NewPreconditionError(PreconditionSupportedCollation)
+	}
+	return &TextMatch{
+		Text:            el.Text,
+		NegateCondition: bool(el.NegateCondition),
+		Collation:       el.Collation,
+	}, nil
 }
 
 func decodeParamFilter(el *paramFilter) (*ParamFilter, error) {
@@ -110,7 +232,11 @@ func decodeParamFilter(el *paramFilter) (*ParamFilter, error) {
 		pf.IsNotDefined = true
 	}
 	if el.TextMatch != nil {
-		pf.TextMatch = &TextMatch{Text: el.TextMatch.Text}
+		tm, err := decodeTextMatch(el.TextMatch)
+		if err != nil {
+			return nil, err
+		}
+		pf.TextMatch = tm
 	}
 	return pf, nil
 }
@@ -124,7 +250,11 @@ func decodePropFilter(el *propFilter) (*PropFilter, error) {
 		pf.IsNotDefined = true
 	}
 	if el.TextMatch != nil {
-		pf.TextMatch = &TextMatch{Text: el.TextMatch.Text}
+		tm, err := decodeTextMatch(el.TextMatch)
+		if err != nil {
+			return nil, err
+		}
+		pf.TextMatch = tm
 	}
 	if el.TimeRange != nil {
 		pf.Start = time.Time(el.TimeRange.Start)
@@ -181,6 +311,7 @@ func decodeComp(comp *comp) (*CalendarCompRequest, error) {
 	}
 
 	req := &CalendarCompRequest{
+		Name:     comp.Name,
 		AllProps: comp.Allprop != nil,
 		AllComps: comp.Allcomp != nil,
 	}
@@ -198,24 +329,76 @@ func decodeComp(comp *comp) (*CalendarCompRequest, error) {
 }
 
 func decodeCalendarDataReq(calendarData *calendarDataReq) (*CalendarCompRequest, error) {
-	if calendarData.Comp == nil {
-		return &CalendarCompRequest{
-			AllProps: true,
-			AllComps: true,
-		}, nil
+	req := &CalendarCompRequest{
+		AllProps: true,
+		AllComps: true,
+	}
+	if calendarData.Comp != nil {
+		var err error
+		req, err = decodeComp(calendarData.Comp)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if calendarData.Expand != nil && calendarData.LimitRecurrenceSet != nil {
+		return nil, internal.HTTPErrorf(http.StatusBadRequest, "caldav: only one of expand or limit-recurrence-set can be specified in calendar-data")
+	}
+	if el := calendarData.Expand; el != nil {
+		tr, err := decodeDataTimeRange(time.Time(el.Start), time.Time(el.End))
+		if err != nil {
+			return nil, err
+		}
+		req.Expand = tr
 	}
-	return decodeComp(calendarData.Comp)
+	if el := calendarData.LimitRecurrenceSet; el != nil {
+		tr, err := decodeDataTimeRange(time.Time(el.Start), time.Time(el.End))
+		if err != nil {
+			return nil, err
+		}
+		req.LimitRecurrenceSet = tr
+	}
+	return req, nil
+}
+
+func decodeDataTimeRange(start, end time.Time) (*TimeRange, error) {
+	if start.IsZero() || end.IsZero() || !start.Before(end) {
+		return nil, internal.HTTPErrorf(http.StatusBadRequest, "caldav: invalid time range in calendar-data")
+	}
+	return &TimeRange{Start: start, End: end}, nil
 }
 
 func (h *Handler) handleQuery(r *http.Request, w http.ResponseWriter, query *calendarQuery) error {
 	var q CalendarQuery
-	// TODO: calendar-data in query.Prop
+	if query.Prop != nil {
+		var calendarData calendarDataReq
+		if err := query.Prop.Decode(&calendarData); err != nil && !internal.IsNotFound(err) {
+			return err
+		} else if err == nil {
+			decoded, err := decodeCalendarDataReq(&calendarData)
+			if err != nil {
+				return err
+			}
+			q.CompRequest = *decoded
+		}
+	}
 	cf, err := decodeCompFilter(&query.Filter.CompFilter)
 	if err != nil {
 		return err
 	}
 	q.CompFilter = *cf
 
+	if query.Timezone != nil {
+		if err := validateCalendarTimezone(query.Timezone.Timezone); err != nil {
+			return NewPreconditionError(PreconditionValidCalendarData)
+		}
+		q.Timezone = query.Timezone.Timezone
+	} else if cal, err := h.Backend.GetCalendar(r.Context(), r.URL.Path); err == nil {
+		// Floating times default to the time zone of the calendar. Errors
+		// are reported by QueryCalendarObjects.
+		q.Timezone = cal.Timezone
+	}
+
 	cos, err := h.Backend.QueryCalendarObjects(r.Context(), r.URL.Path, &q)
 	if err != nil {
 		return err
@@ -287,9 +470,132 @@ func (h *Handler) handleMultiget(ctx context.Context, w http.ResponseWriter, mul
 	return internal.ServeMultiStatus(w, ms)
 }
 
+func (h *Handler) handleFreeBusyQuery(r *http.Request, w http.ResponseWriter, query *freeBusyQuery) error {
+	start, end := time.Time(query.TimeRange.Start), time.Time(query.TimeRange.End)
+	if start.IsZero() || end.IsZero() || !start.Before(end) {
+		return internal.HTTPErrorf(http.StatusBadRequest, "caldav: invalid time range in free-busy-query")
+	}
+
+	var fb *ical.Component
+	var err error
+	if fbBackend, ok := h.Backend.(FreeBusyBackend); ok {
+		fb, err = fbBackend.QueryFreeBusy(r.Context(), r.URL.Path, start, end)
+	} else {
+		fb, err = h.queryFreeBusy(r.Context(), r.URL.Path, start, end)
+	}
+	if err != nil {
+		return err
+	}
+
+	cal := ical.NewCalendar()
+	cal.Props.SetText(ical.PropVersion, "2.0")
+	cal.Props.SetText(ical.PropProductID, prodID)
+	cal.Children = append(cal.Children, fb)
+
+	var buf bytes.Buffer
+	if err := encodeCalendarData(&buf, cal); err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", ical.MIMEType)
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+func (h *Handler) queryFreeBusy(ctx context.Context, path string, start, end time.Time) (*ical.Component, error) {
+	cal, err := h.Backend.GetCalendar(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	// Floating times are interpreted in the time zone of the calendar
+	loc, err := timezoneLocation(cal.Timezone)
+	if err != nil {
+		return nil, err
+	}
+
+	// Both events and VFREEBUSY components contribute to free-busy
+	// information, and sibling comp-filters would need to match together
+	var cals []*ical.Calendar
+	for _, compName := range []string{ical.CompEvent, ical.CompFreeBusy} {
+		cos, err := h.Backend.QueryCalendarObjects(ctx, path, &CalendarQuery{
+			CompRequest: CalendarCompRequest{AllProps: true, AllComps: true},
+			CompFilter: CompFilter{
+				Name:  ical.CompCalendar,
+				Comps: []CompFilter{{Name: compName, Start: start, End: end}},
+			},
+			Timezone: cal.Timezone,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, co := range cos {
+			cals = append(cals, co.Data)
+		}
+	}
+	return FreeBusy(cals, start, end, loc)
+}
+
+func (h *Handler) handleSyncCollection(r *http.Request, w http.ResponseWriter, sync *internal.SyncCollectionQuery) error {
+	syncBackend, ok := h.Backend.(SyncBackend)
+	if !ok {
+		return internal.NewConditionError(http.StatusForbidden, internal.SupportedReportName)
+	}
+
+	limit, err := internal.ParseSyncCollection(sync)
+	if err != nil {
+		return err
+	}
+
+	q := SyncQuery{SyncToken: sync.SyncToken, Limit: limit}
+	if sync.Prop != nil {
+		var calendarData calendarDataReq
+		if err := sync.Prop.Decode(&calendarData); err != nil && !internal.IsNotFound(err) {
+			return err
+		} else if err == nil {
+			decoded, err := decodeCalendarDataReq(&calendarData)
+			if err != nil {
+				return err
+			}
+			q.CompRequest = *decoded
+		}
+	}
+
+	sr, err := syncBackend.SyncCalendarObjects(r.Context(), r.URL.Path, &q)
+	if err != nil {
+		return err
+	}
+
+	b := backend{
+		Backend: h.Backend,
+		Prefix:  strings.TrimSuffix(h.Prefix, "/"),
+	}
+	propfind := internal.PropFind{Prop: sync.Prop}
+
+	var resps []internal.Response
+	for _, co := range sr.Updated {
+		resp, err := b.propFindCalendarObject(r.Context(), &propfind, &co)
+		if err != nil {
+			return err
+		}
+		resps = append(resps, *resp)
+	}
+
+	ms := internal.NewSyncCollectionMultiStatus(r.URL.Path, sr.SyncToken, resps, sr.Deleted, sr.Truncated)
+	return internal.ServeMultiStatus(w, ms)
+}
+
 type backend struct {
-	Backend Backend
-	Prefix  string
+	Backend        Backend
+	Prefix         string
+	ScheduleSender ScheduleSender
+	ErrorLog       *log.Logger
+}
+
+func (b *backend) logf(format string, v ...interface{}) {
+	if b.ErrorLog != nil {
+		b.ErrorLog.Printf(format, v...)
+	} else {
+		log.Printf(format, v...)
+	}
 }
 
 type resourceType int
@@ -315,10 +621,21 @@ func (b *backend) resourceTypeAtPath(reqPath string) resourceType {
 }
 
 func (b *backend) Options(r *http.Request) (caps []string, allow []string, err error) {
-	caps = []string{"calendar-access"}
+	caps = []string{"calendar-access", "extended-mkcol"}
+	if _, ok := b.Backend.(SchedulingBackend); ok {
+		caps = append(caps, "calendar-auto-schedule")
+	}
 
 	if b.resourceTypeAtPath(r.URL.Path) != resourceTypeCalendarObject {
-		return caps, []string{http.MethodOptions, "PROPFIND", "REPORT", "DELETE", "MKCOL"}, nil
+		allow = []string{http.MethodOptions, "PROPFIND", "REPORT", "DELETE", "MKCOL", "MKCALENDAR"}
+		kind, err := b.scheduleCollectionAtPath(r.Context(), r.URL.Path)
+		if err != nil {
+			return nil, nil, err
+		}
+		if kind == scheduleCollectionOutbox {
+			allow = append(allow, http.MethodPost)
+		}
+		return caps, allow, nil
 	}
 
 	var dataReq CalendarCompRequest
@@ -336,6 +653,8 @@ func (b *backend) Options(r *http.Request) (caps []string, allow []string, err e
 		http.MethodPut,
 		http.MethodDelete,
 		"PROPFIND",
+		"COPY",
+		"MOVE",
 	}, nil
 }
 
@@ -426,6 +745,19 @@ func (b *backend) PropFind(r *http.Request, propfind *internal.PropFind, depth i
 			}
 		}
 	case resourceTypeCalendar:
+		kind, err := b.scheduleCollectionAtPath(r.Context(), r.URL.Path)
+		if err != nil {
+			return nil, err
+		}
+		if kind != scheduleCollectionNone {
+			resps_, err := b.propFindScheduleCollection(r.Context(), propfind, r.URL.Path, kind, depth != internal.DepthZero)
+			if err != nil {
+				return nil, err
+			}
+			resps = append(resps, resps_...)
+			break
+		}
+
 		ab, err := b.Backend.GetCalendar(r.Context(), r.URL.Path)
 		if err != nil {
 			return nil, err
@@ -472,6 +804,36 @@ func (b *backend) propFindRoot(ctx context.Context, propfind *internal.PropFind)
 			return internal.NewResourceType(internal.CollectionName), nil
 		},
 	}
+
+	if sb, ok := b.Backend.(SchedulingBackend); ok {
+		inboxPath, err := sb.ScheduleInboxPath(ctx)
+		if err != nil {
+			return nil, err
+		}
+		outboxPath, err := sb.ScheduleOutboxPath(ctx)
+		if err != nil {
+			return nil, err
+		}
+		addrs, err := sb.CalendarUserAddressSet(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		props[scheduleInboxURLName] = func(*internal.RawXMLValue) (interface{}, error) {
+			return &scheduleInboxURL{Href: internal.Href{Path: inboxPath}}, nil
+		}
+		props[scheduleOutboxURLName] = func(*internal.RawXMLValue) (interface{}, error) {
+			return &scheduleOutboxURL{Href: internal.Href{Path: outboxPath}}, nil
+		}
+		props[calendarUserAddressSetName] = func(*internal.RawXMLValue) (interface{}, error) {
+			set := &calendarUserAddressSet{}
+			for _, addr := range addrs {
+				set.Hrefs = append(set.Hrefs, calendarUserHref(addr))
+			}
+			return set, nil
+		}
+	}
+
 	return internal.NewPropFindResponse(principalPath, propfind, props)
 }
 
@@ -496,6 +858,36 @@ func (b *backend) propFindUserPrincipal(ctx context.Context, propfind *internal.
 			return internal.NewResourceType(internal.CollectionName), nil
 		},
 	}
+
+	if sb, ok := b.Backend.(SchedulingBackend); ok {
+		inboxPath, err := sb.ScheduleInboxPath(ctx)
+		if err != nil {
+			return nil, err
+		}
+		outboxPath, err := sb.ScheduleOutboxPath(ctx)
+		if err != nil {
+			return nil, err
+		}
+		addrs, err := sb.CalendarUserAddressSet(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		props[scheduleInboxURLName] = func(*internal.RawXMLValue) (interface{}, error) {
+			return &scheduleInboxURL{Href: internal.Href{Path: inboxPath}}, nil
+		}
+		props[scheduleOutboxURLName] = func(*internal.RawXMLValue) (interface{}, error) {
+			return &scheduleOutboxURL{Href: internal.Href{Path: outboxPath}}, nil
+		}
+		props[calendarUserAddressSetName] = func(*internal.RawXMLValue) (interface{}, error) {
+			set := &calendarUserAddressSet{}
+			for _, addr := range addrs {
+				set.Hrefs = append(set.Hrefs, calendarUserHref(addr))
+			}
+			return set, nil
+		}
+	}
+
 	return internal.NewPropFindResponse(principalPath, propfind, props)
 }
 
@@ -543,14 +935,17 @@ func (b *backend) propFindCalendar(ctx context.Context, propfind *internal.PropF
 				},
 			}, nil
 		},
+		internal.SupportedReportSetName: func(*internal.RawXMLValue) (interface{}, error) {
+			reports := []xml.Name{calendarQueryName, calendarMultigetName, freeBusyQueryName}
+			if _, ok := b.Backend.(SyncBackend); ok {
+				reports = append(reports, internal.SyncCollectionName)
+			}
+			return internal.NewSupportedReportSet(reports...), nil
+		},
 		supportedCalendarComponentSetName: func(*internal.RawXMLValue) (interface{}, error) {
 			components := []comp{}
-			if cal.SupportedComponentSet != nil {
-				for _, name := range cal.SupportedComponentSet {
-					components = append(components, comp{Name: name})
-				}
-			} else {
-				components = append(components, comp{Name: ical.CompEvent})
+			for _, name := range supportedComponentSet(cal) {
+				components = append(components, comp{Name: name})
 			}
 			return &supportedCalendarComponentSet{
 				Comp: components,
@@ -573,8 +968,37 @@ func (b *backend) propFindCalendar(ctx context.Context, propfind *internal.PropF
 			return &maxResourceSize{Size: cal.MaxResourceSize}, nil
 		}
 	}
+	if cal.Timezone != "" {
+		props[calendarTimezoneName] = func(*internal.RawXMLValue) (interface{}, error) {
+			return &calendarTimezone{Timezone: cal.Timezone}, nil
+		}
+	}
+	if cal.Color != "" {
+		props[calendarColorName] = func(*internal.RawXMLValue) (interface{}, error) {
+			return &calendarColor{Color: cal.Color}, nil
+		}
+	}
+	if cal.Order != 0 {
+		props[calendarOrderName] = func(*internal.RawXMLValue) (interface{}, error) {
+			return &calendarOrder{Order: strconv.Itoa(cal.Order)}, nil
+		}
+	}
+	for _, prop := range cal.DeadProps {
+		var raw internal.RawXMLValue
+		if err := xml.Unmarshal(prop.Raw, &raw); err != nil {
+			return nil, err
+		}
+		props[prop.XMLName] = func(*internal.RawXMLValue) (interface{}, error) {
+			return &raw, nil
+		}
+	}
+	if cal.SyncToken != "" {
+		props[internal.SyncTokenName] = func(*internal.RawXMLValue) (interface{}, error) {
+			return &internal.SyncToken{Token: cal.SyncToken}, nil
+		}
+	}
 
-	// TODO: CALDAV:calendar-timezone, CALDAV:supported-calendar-component-set, CALDAV:min-date-time, CALDAV:max-date-time, CALDAV:max-instances, CALDAV:max-attendees-per-instance
+	// TODO: CALDAV:min-date-time, CALDAV:max-date-time, CALDAV:max-instances, CALDAV:max-attendees-per-instance
 
 	return internal.NewPropFindResponse(cal.Path, propfind, props)
 }
@@ -600,6 +1024,13 @@ func (b *backend) propFindAllCalendars(ctx context.Context, propfind *internal.P
 			resps = append(resps, resps_...)
 		}
 	}
+
+	resps_, err := b.propFindScheduleCollections(ctx, propfind, recurse)
+	if err != nil {
+		return nil, err
+	}
+	resps = append(resps, resps_...)
+
 	return resps, nil
 }
 
@@ -616,9 +1047,36 @@ func (b *backend) propFindCalendarObject(ctx context.Context, propfind *internal
 			return &internal.GetContentType{Type: ical.MIMEType}, nil
 		},
 		// TODO: calendar-data can only be used in REPORT requests
-		calendarDataName: func(*internal.RawXMLValue) (interface{}, error) {
+		calendarDataName: func(raw *internal.RawXMLValue) (interface{}, error) {
+			var calendarData calendarDataReq
+			if err := raw.Decode(&calendarData); err != nil {
+				return nil, internal.HTTPErrorf(http.StatusBadRequest, "caldav: malformed calendar-data: %v", err)
+			}
+			dataReq, err := decodeCalendarDataReq(&calendarData)
+			if err != nil {
+				return nil, err
+			}
+
+			// Backends may return more data than requested
+			data := co.Data
+			if tr := dataReq.Expand; tr != nil {
+				if data, err = ExpandCalendar(data, tr.Start, tr.End); err != nil {
+					return nil, err
+				}
+			} else if tr := dataReq.LimitRecurrenceSet; tr != nil {
+				if data, err = LimitRecurrenceSet(data, tr.Start, tr.End); err != nil {
+					return nil, err
+				}
+			}
 			var buf bytes.Buffer
-			if err := ical.NewEncoder(&buf).Encode(co.Data); err != nil {
+			if dataReq.Name != "" && (!dataReq.AllProps || !dataReq.AllComps) {
+				// The pruned calendar may lack required properties
+				data = PruneCalendar(data, dataReq)
+				err = encodeCalendarData(&buf, data)
+			} else {
+				err = ical.NewEncoder(&buf).Encode(data)
+			}
+			if err != nil {
 				return nil, err
 			}
 
@@ -664,8 +1122,178 @@ func (b *backend) propFindAllCalendarObjects(ctx context.Context, propfind *inte
 	return resps, nil
 }
 
+type scheduleCollection int
+
+const (
+	scheduleCollectionNone scheduleCollection = iota
+	scheduleCollectionInbox
+	scheduleCollectionOutbox
+)
+
+// scheduleCollectionAtPath returns the kind of scheduling collection located
+// at p, if any.
+func (b *backend) scheduleCollectionAtPath(ctx context.Context, p string) (scheduleCollection, error) {
+	sb, ok := b.Backend.(SchedulingBackend)
+	if !ok {
+		return scheduleCollectionNone, nil
+	}
+
+	inboxPath, err := sb.ScheduleInboxPath(ctx)
+	if err != nil {
+		return scheduleCollectionNone, err
+	}
+	outboxPath, err := sb.ScheduleOutboxPath(ctx)
+	if err != nil {
+		return scheduleCollectionNone, err
+	}
+
+	switch path.Clean(p) {
+	case path.Clean(inboxPath):
+		return scheduleCollectionInbox, nil
+	case path.Clean(outboxPath):
+		return scheduleCollectionOutbox, nil
+	}
+	return scheduleCollectionNone, nil
+}
+
+func (b *backend) propFindScheduleCollection(ctx context.Context, propfind *internal.PropFind, p string, kind scheduleCollection, recurse bool) ([]internal.Response, error) {
+	resType := scheduleInboxName
+	if kind == scheduleCollectionOutbox {
+		resType = scheduleOutboxName
+	}
+	props := map[xml.Name]internal.PropFindFunc{
+		internal.ResourceTypeName: func(*internal.RawXMLValue) (interface{}, error) {
+			return internal.NewResourceType(internal.CollectionName, resType), nil
+		},
+	}
+	resp, err := internal.NewPropFindResponse(p, propfind, props)
+	if err != nil {
+		return nil, err
+	}
+	resps := []internal.Response{*resp}
+
+	// The outbox is always empty
+	if recurse && kind == scheduleCollectionInbox {
+		resps_, err := b.propFindAllCalendarObjects(ctx, propfind, &Calendar{Path: p})
+		if err != nil {
+			return nil, err
+		}
+		resps = append(resps, resps_...)
+	}
+	return resps, nil
+}
+
+func (b *backend) propFindScheduleCollections(ctx context.Context, propfind *internal.PropFind, recurse bool) ([]internal.Response, error) {
+	sb, ok := b.Backend.(SchedulingBackend)
+	if !ok {
+		return nil, nil
+	}
+
+	inboxPath, err := sb.ScheduleInboxPath(ctx)
+	if err != nil {
+		return nil, err
+	}
+	outboxPath, err := sb.ScheduleOutboxPath(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resps, err := b.propFindScheduleCollection(ctx, propfind, inboxPath, scheduleCollectionInbox, recurse)
+	if err != nil {
+		return nil, err
+	}
+	resps_, err := b.propFindScheduleCollection(ctx, propfind, outboxPath, scheduleCollectionOutbox, recurse)
+	if err != nil {
+		return nil, err
+	}
+	return append(resps, resps_...), nil
+}
+
 func (b *backend) PropPatch(r *http.Request, update *internal.PropertyUpdate) (*internal.Response, error) {
-	return nil, internal.HTTPErrorf(http.StatusNotImplemented, "caldav: PropPatch not implemented")
+	updateBackend, ok := b.Backend.(UpdateBackend)
+	if !ok || b.resourceTypeAtPath(r.URL.Path) != resourceTypeCalendar {
+		forbidden := func(*internal.RawXMLValue, bool) error {
+			return internal.HTTPErrorf(http.StatusForbidden, "caldav: properties can't be updated on this resource")
+		}
+		return internal.NewPropPatchResponse(r.URL.Path, update, forbidden, nil)
+	}
+
+	cal, err := b.Backend.GetCalendar(r.Context(), r.URL.Path)
+	if err != nil {
+		return nil, err
+	}
+	// The backend may return a pointer to its own data
+	updated := *cal
+
+	patch := func(raw *internal.RawXMLValue, remove bool) error {
+		return patchCalendarProp(&updated, raw, remove)
+	}
+	commit := func() error {
+		return updateBackend.UpdateCalendar(r.Context(), &updated)
+	}
+	return internal.NewPropPatchResponse(r.URL.Path, update, patch, commit)
+}
+
+// patchCalendarProp sets or removes a calendar property which can be
+// modified after the calendar has been created.
+func patchCalendarProp(cal *Calendar, raw *internal.RawXMLValue, remove bool) error {
+	name, _ := raw.XMLName()
+	switch name {
+	case internal.DisplayNameName:
+		var dn internal.DisplayName
+		if !remove {
+			if err := raw.Decode(&dn); err != nil {
+				return err
+			}
+		}
+		cal.Name = dn.Name
+	case calendarDescriptionName:
+		var desc calendarDescription
+		if !remove {
+			if err := raw.Decode(&desc); err != nil {
+				return err
+			}
+		}
+		cal.Description = desc.Description
+	case calendarTimezoneName:
+		var tz calendarTimezone
+		if !remove {
+			if err := raw.Decode(&tz); err != nil {
+				return err
+			}
+			if err := validateCalendarTimezone(tz.Timezone); err != nil {
+				return err
+			}
+		}
+		cal.Timezone = tz.Timezone
+	case calendarColorName:
+		var color calendarColor
+		if !remove {
+			if err := raw.Decode(&color); err != nil {
+				return err
+			}
+		}
+		cal.Color = strings.TrimSpace(color.Color)
+	case calendarOrderName:
+		var order calendarOrder
+		cal.Order = 0
+		if !remove {
+			if err := raw.Decode(&order); err != nil {
+				return err
+			}
+			n, err := strconv.Atoi(strings.TrimSpace(order.Order))
+			if err != nil {
+				return fmt.Errorf("caldav: invalid calendar-order: %v", err)
+			}
+			cal.Order = n
+		}
+	default:
+		if name.Space == internal.Namespace || name.Space == namespace {
+			return internal.HTTPErrorf(http.StatusForbidden, "caldav: property %q %q is protected", name.Space, name.Local)
+		}
+		return internal.PatchDeadProp(&cal.DeadProps, raw, remove)
+	}
+	return nil
 }
 
 func (b *backend) Put(w http.ResponseWriter, r *http.Request) error {
@@ -677,45 +1305,167 @@ func (b *backend) Put(w http.ResponseWriter, r *http.Request) error {
 		IfMatch:     ifMatch,
 	}
 
-	t, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if b.resourceTypeAtPath(r.URL.Path) != resourceTypeCalendarObject {
+		return internal.HTTPErrorf(http.StatusForbidden, "caldav: calendar objects can only be created inside a calendar")
+	}
+	calPath := path.Dir(path.Clean(r.URL.Path)) + "/"
+	calendar, err := b.Backend.GetCalendar(r.Context(), calPath)
+	if internal.IsNotFound(err) {
+		return internal.HTTPErrorf(http.StatusConflict, "caldav: calendar %q doesn't exist", calPath)
+	} else if err != nil {
+		return err
+	}
+
+	if err := checkSupportedCalendarData(r.Header.Get("Content-Type")); err != nil {
+		return err
+	}
+
+	data, err := internal.ReadRequestBody(r, calendar.MaxResourceSize)
+	if err == internal.ErrBodyTooLarge {
+		return NewPreconditionError(PreconditionMaxResourceSize)
+	} else if err != nil {
+		return err
+	}
+
+	cal, err := ical.NewDecoder(bytes.NewReader(data)).Decode()
 	if err != nil {
-		return internal.HTTPErrorf(http.StatusBadRequest, "caldav: malformed Content-Type: %v", err)
+		return NewPreconditionError(PreconditionValidCalendarData)
 	}
-	if t != ical.MIMEType {
-		// TODO: send CALDAV:supported-calendar-data error
-		return internal.HTTPErrorf(http.StatusBadRequest, "caldav: unsupported Content-Type %q", t)
+	// Backends store the parsed object, which is encoded in canonical form
+	var canonical bytes.Buffer
+	modified := ical.NewEncoder(&canonical).Encode(cal) != nil || !bytes.Equal(canonical.Bytes(), data)
+
+	if err := checkCalendarObjectResource(calendar, cal); err != nil {
+		return err
 	}
 
-	// TODO: check CALDAV:max-resource-size precondition
-	cal, err := ical.NewDecoder(r.Body).Decode()
+	old, err := b.scheduleObjectData(r.Context(), r.URL.Path)
 	if err != nil {
-		// TODO: send CALDAV:valid-calendar-data error
-		return internal.HTTPErrorf(http.StatusBadRequest, "caldav: failed to parse iCalendar: %v", err)
+		return err
 	}
 
-	co, err := b.Backend.PutCalendarObject(r.Context(), r.URL.Path, cal, &opts)
+	res, err := b.Backend.PutCalendarObject(r.Context(), r.URL.Path, cal, &opts)
 	if err != nil {
 		return err
 	}
 
-	if co.ETag != "" {
-		w.Header().Set("ETag", internal.ETag(co.ETag).String())
+	// The object has been stored at this point, so delivery failures are
+	// only reported to the client with the SCHEDULE-STATUS parameters
+	statuses, err := b.scheduleChange(r.Context(), r.URL.Path, old, cal)
+	if err != nil {
+		b.logf("caldav: implicit scheduling failed for %v: %v", r.URL.Path, err)
 	}
-	if !co.ModTime.IsZero() {
-		w.Header().Set("Last-Modified", co.ModTime.UTC().Format(http.TimeFormat))
+	if setScheduleStatus(cal, statuses) {
+		created := res.Created
+		opts := PutCalendarObjectOptions{IfMatch: webdav.ConditionalMatch(internal.ETag(res.ETag).String())}
+		if res.ETag == "" {
+			opts.IfMatch = "*"
+		}
+		statusRes, err := b.Backend.PutCalendarObject(r.Context(), r.URL.Path, cal, &opts)
+		if err != nil {
+			b.logf("caldav: failed to store schedule status for %v: %v", r.URL.Path, err)
+		} else {
+			res = statusRes
+			res.Created = created
+		}
+		// The stored object isn't the one sent by the client anymore
+		modified = true
+	}
+
+	// RFC 4791 section 5.3.4: the ETag must not be returned if the stored
+	// object isn't the one sent by the client. Backends only get the parsed
+	// object, so they can't tell whether the request body was encoded
+	// differently.
+	if res.ETag != "" && !res.Modified && !modified {
+		w.Header().Set("ETag", internal.ETag(res.ETag).String())
+	}
+	if !res.ModTime.IsZero() {
+		w.Header().Set("Last-Modified", res.ModTime.UTC().Format(http.TimeFormat))
 	}
-	if co.Path != "" {
-		w.Header().Set("Location", co.Path)
+	if res.Path != "" {
+		w.Header().Set("Location", res.Path)
 	}
 
-	// TODO: http.StatusNoContent if the resource already existed
-	w.WriteHeader(http.StatusCreated)
+	if res.Created {
+		w.WriteHeader(http.StatusCreated)
+	} else {
+		w.WriteHeader(http.StatusNoContent)
+	}
 
 	return nil
 }
 
+// checkSupportedCalendarData checks that calendar object resources of the
+// specified media type can be stored, as required by the
+// CALDAV:supported-calendar-data precondition.
+func checkSupportedCalendarData(contentType string) error {
+	t, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return internal.HTTPErrorf(http.StatusBadRequest, "caldav: malformed Content-Type: %v", err)
+	}
+	if t != ical.MIMEType {
+		return NewPreconditionError(PreconditionSupportedCalendarData)
+	}
+	if v, ok := params["version"]; ok && v != "2.0" {
+		return NewPreconditionError(PreconditionSupportedCalendarData)
+	}
+	return nil
+}
+
+// checkCalendarObjectResource checks that an iCalendar object is a valid
+// calendar object resource whose component type is supported by a calendar.
+func checkCalendarObjectResource(calendar *Calendar, cal *ical.Calendar) error {
+	compType, _, err := ValidateCalendarObject(cal)
+	if err != nil || compType == "" {
+		return NewPreconditionError(PreconditionValidCalendarObjectResource)
+	}
+	if !supportsComponent(calendar, compType) {
+		return NewPreconditionError(PreconditionSupportedCalendarComponent)
+	}
+	return nil
+}
+
+// supportedComponentSet returns the component types which can be stored in a
+// calendar. Calendars without an explicit set only support events.
+func supportedComponentSet(cal *Calendar) []string {
+	if cal.SupportedComponentSet != nil {
+		return cal.SupportedComponentSet
+	}
+	return []string{ical.CompEvent}
+}
+
+func supportsComponent(cal *Calendar, name string) bool {
+	for _, s := range supportedComponentSet(cal) {
+		if strings.EqualFold(s, name) {
+			return true
+		}
+	}
+	return false
+}
+
 func (b *backend) Delete(r *http.Request) error {
-	return b.Backend.DeleteCalendarObject(r.Context(), r.URL.Path)
+	switch b.resourceTypeAtPath(r.URL.Path) {
+	case resourceTypeCalendar:
+		deleteBackend, ok := b.Backend.(DeleteBackend)
+		if !ok {
+			return internal.HTTPErrorf(http.StatusForbidden, "caldav: calendars can't be deleted")
+		}
+		return deleteBackend.DeleteCalendar(r.Context(), r.URL.Path)
+	case resourceTypeCalendarObject:
+		old, err := b.scheduleObjectData(r.Context(), r.URL.Path)
+		if err != nil {
+			return err
+		}
+		if err := b.Backend.DeleteCalendarObject(r.Context(), r.URL.Path); err != nil {
+			return err
+		}
+		// The object is gone, so failures can only be logged
+		if _, err := b.scheduleChange(r.Context(), r.URL.Path, old, nil); err != nil {
+			b.logf("caldav: implicit scheduling failed for %v: %v", r.URL.Path, err)
+		}
+		return nil
+	}
+	return internal.HTTPErrorf(http.StatusForbidden, "caldav: cannot delete resource at given location")
 }
 
 func (b *backend) Mkcol(r *http.Request) error {
@@ -728,27 +1478,404 @@ func (b *backend) Mkcol(r *http.Request) error {
 	}
 
 	if !internal.IsRequestBodyEmpty(r) {
-		var m mkcolReq
+		var m internal.Mkcol
 		if err := internal.DecodeXMLRequest(r, &m); err != nil {
-			return internal.HTTPErrorf(http.StatusBadRequest, "carddav: error parsing mkcol request: %s", err.Error())
+			return internal.HTTPErrorf(http.StatusBadRequest, "caldav: error parsing %v request: %s", r.Method, err.Error())
+		}
+
+		rootName, respName := internal.MkcolName, internal.MkcolResponseName
+		if r.Method == "MKCALENDAR" {
+			rootName, respName = mkcalendarName, mkcalendarResponseName
+		}
+		if m.XMLName != rootName {
+			return internal.HTTPErrorf(http.StatusBadRequest, "caldav: unexpected root element %q %q in %v request", m.XMLName.Space, m.XMLName.Local, r.Method)
+		}
+
+		// All properties are rejected if one of them can't be set, see RFC
+		// 5689 section 3
+		var ok, failed []internal.RawXMLValue
+		for _, set := range m.Set {
+			for i := range set.Prop.Raw {
+				raw := &set.Prop.Raw[i]
+				name, _ := raw.XMLName()
+				emptyVal := internal.NewRawXMLElement(name, nil, nil)
+				if err := setCalendarProp(&cal, raw, r.Method == "MKCALENDAR"); err != nil {
+					failed = append(failed, *emptyVal)
+				} else {
+					ok = append(ok, *emptyVal)
+				}
+			}
 		}
 
-		if !m.ResourceType.Is(internal.CollectionName) || !m.ResourceType.Is(calendarName) {
-			return internal.HTTPErrorf(http.StatusBadRequest, "carddav: unexpected resource type")
+		if len(failed) > 0 {
+			resp := internal.MkcolResponse{XMLName: respName}
+			resp.PropStats = append(resp.PropStats, internal.PropStat{
+				Prop:   internal.Prop{Raw: failed},
+				Status: internal.Status{Code: http.StatusForbidden},
+			})
+			if len(ok) > 0 {
+				resp.PropStats = append(resp.PropStats, internal.PropStat{
+					Prop:   internal.Prop{Raw: ok},
+					Status: internal.Status{Code: http.StatusFailedDependency},
+				})
+			}
+			return &internal.HTTPError{Code: http.StatusForbidden, Err: &resp}
 		}
-		cal.Name = m.DisplayName
-		// TODO ...
 	}
 
 	return b.Backend.CreateCalendar(r.Context(), &cal)
 }
 
+// Post handles free-busy requests sent to the schedule outbox, as defined in
+// RFC 6638 section 5. Other scheduling messages are sent implicitly when
+// calendar objects are stored.
+func (b *backend) Post(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	kind, err := b.scheduleCollectionAtPath(ctx, r.URL.Path)
+	if err != nil {
+		return err
+	}
+	if kind != scheduleCollectionOutbox {
+		return internal.HTTPErrorf(http.StatusMethodNotAllowed, "caldav: POST is only supported on the schedule outbox")
+	}
+	sb := b.Backend.(SchedulingBackend)
+
+	t, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return internal.HTTPErrorf(http.StatusBadRequest, "caldav: malformed Content-Type: %v", err)
+	}
+	if t != ical.MIMEType {
+		return NewPreconditionError(PreconditionSupportedCalendarData)
+	}
+	cal, err := ical.NewDecoder(r.Body).Decode()
+	if err != nil {
+		return NewPreconditionError(PreconditionValidCalendarData)
+	}
+
+	var req *ical.Component
+	for _, child := range cal.Children {
+		if child.Name == ical.CompFreeBusy {
+			req = child
+			break
+		}
+	}
+	method, _ := cal.Props.Text(ical.PropMethod)
+	if req == nil || !strings.EqualFold(method, string(ScheduleRequest)) || len(req.Props[ical.PropAttendee]) == 0 {
+		return NewPreconditionError(PreconditionValidSchedulingMessage)
+	}
+
+	start, end, err := freeBusyRequestRange(req)
+	if err != nil {
+		return NewPreconditionError(PreconditionValidSchedulingMessage)
+	}
+
+	addrs, err := sb.CalendarUserAddressSet(ctx)
+	if err != nil {
+		return err
+	}
+	organizer := req.Props.Get(ical.PropOrganizer)
+	if organizer == nil || !containsAddress(addrs, organizer.Value) {
+		return NewPreconditionError(PreconditionOrganizerAllowed)
+	}
+
+	var resp scheduleResponse
+	for _, attendee := range req.Props[ical.PropAttendee] {
+		resp.Responses = append(resp.Responses, scheduleFreeBusyReply(ctx, sb, req, &attendee, start, end))
+	}
+	return internal.ServeXML(w).Encode(&resp)
+}
+
+func freeBusyRequestRange(req *ical.Component) (start, end time.Time, err error) {
+	dtstart := req.Props.Get(ical.PropDateTimeStart)
+	dtend := req.Props.Get(ical.PropDateTimeEnd)
+	if dtstart == nil || dtend == nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("caldav: free-busy request without DTSTART or DTEND")
+	}
+	if start, err = dateTime(dtstart, time.UTC); err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if end, err = dateTime(dtend, time.UTC); err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if !start.Before(end) {
+		return time.Time{}, time.Time{}, fmt.Errorf("caldav: invalid free-busy request time range")
+	}
+	return start, end, nil
+}
+
+func scheduleFreeBusyReply(ctx context.Context, sb SchedulingBackend, req *ical.Component, attendee *ical.Prop, start, end time.Time) scheduleRecipientResponse {
+	resp := scheduleRecipientResponse{
+		Recipient: scheduleRecipient{Href: calendarUserHref(attendee.Value)},
+	}
+
+	fb, err := sb.CalendarUserFreeBusy(ctx, attendee.Value, start, end)
+	if internal.IsNotFound(err) {
+		resp.RequestStatus = requestStatusInvalidCalendarUser
+		return resp
+	} else if err != nil {
+		resp.RequestStatus = requestStatusServiceUnavailable
+		return resp
+	}
+
+	fb.Props.Set(req.Props.Get(ical.PropOrganizer))
+	fb.Props.Set(attendee)
+	if uid := req.Props.Get(ical.PropUID); uid != nil {
+		fb.Props.Set(uid)
+	}
+	msg := newScheduleMessage(ScheduleReply)
+	msg.Children = append(msg.Children, fb)
+
+	var buf bytes.Buffer
+	if err := encodeCalendarData(&buf, msg); err != nil {
+		resp.RequestStatus = requestStatusServiceUnavailable
+		return resp
+	}
+	resp.RequestStatus = requestStatusSuccess
+	resp.CalendarData = &calendarDataResp{Data: buf.Bytes()}
+	return resp
+}
+
+// setCalendarProp sets a calendar property from an MKCOL or MKCALENDAR
+// request.
+func setCalendarProp(cal *Calendar, raw *internal.RawXMLValue, mkcalendar bool) error {
+	name, _ := raw.XMLName()
+	switch name {
+	case internal.ResourceTypeName:
+		// MKCALENDAR implies the resource type
+		if mkcalendar {
+			return fmt.Errorf("caldav: resourcetype can't be set with MKCALENDAR")
+		}
+		var rt internal.ResourceType
+		if err := raw.Decode(&rt); err != nil {
+			return err
+		}
+		if !rt.Is(internal.CollectionName) || !rt.Is(calendarName) {
+			return fmt.Errorf("caldav: unexpected resource type")
+		}
+	case supportedCalendarComponentSetName:
+		var set supportedCalendarComponentSet
+		if err := raw.Decode(&set); err != nil {
+			return err
+		}
+		cal.SupportedComponentSet = nil
+		for _, c := range set.Comp {
+			cal.SupportedComponentSet = append(cal.SupportedComponentSet, c.Name)
+		}
+	case maxResourceSizeName:
+		var size maxResourceSize
+		if err := raw.Decode(&size); err != nil {
+			return err
+		}
+		if size.Size <= 0 {
+			return fmt.Errorf("caldav: invalid max-resource-size")
+		}
+		cal.MaxResourceSize = size.Size
+	default:
+		return patchCalendarProp(cal, raw, false)
+	}
+	return nil
+}
+
+// validateCalendarTimezone checks that a CALDAV:calendar-timezone value is an
+// iCalendar object containing exactly one VTIMEZONE component, as required by
+// RFC 4791 section 5.2.2.
+func validateCalendarTimezone(s string) error {
+	cal, err := ical.NewDecoder(strings.NewReader(s)).Decode()
+	if err != nil {
+		return fmt.Errorf("caldav: invalid calendar-timezone: %v", err)
+	}
+	var n int
+	for _, child := range cal.Children {
+		if child.Name != ical.CompTimezone {
+			return fmt.Errorf("caldav: unexpected %v component in calendar-timezone", child.Name)
+		}
+		n++
+	}
+	if n != 1 {
+		return fmt.Errorf("caldav: calendar-timezone must contain exactly one VTIMEZONE component")
+	}
+	return nil
+}
+
+// checkCopyMove checks that a calendar object can be copied or moved from the
+// request URI to dest, and returns the source object. created is true if dest
+// doesn't exist yet.
+func (b *backend) checkCopyMove(r *http.Request, dest string, overwrite, move bool) (co *CalendarObject, created bool, err error) {
+	ctx := r.Context()
+	src := r.URL.Path
+	if b.resourceTypeAtPath(src) != resourceTypeCalendarObject {
+		return nil, false, internal.HTTPErrorf(http.StatusForbidden, "caldav: only calendar objects can be copied or moved")
+	}
+	if b.resourceTypeAtPath(dest) != resourceTypeCalendarObject {
+		return nil, false, internal.HTTPErrorf(http.StatusForbidden, "caldav: destination must be a calendar object")
+	}
+	if path.Clean(src) == path.Clean(dest) {
+		return nil, false, internal.HTTPErrorf(http.StatusForbidden, "caldav: source and destination are the same")
+	}
+
+	co, err = b.Backend.GetCalendarObject(ctx, src, &CalendarCompRequest{AllProps: true, AllComps: true})
+	if err != nil {
+		return nil, false, err
+	}
+	if ifMatch := webdav.ConditionalMatch(r.Header.Get("If-Match")); ifMatch.IsSet() && !ifMatch.IsWildcard() {
+		etag, err := ifMatch.ETag()
+		if err != nil {
+			return nil, false, internal.HTTPErrorf(http.StatusBadRequest, "caldav: malformed If-Match header: %v", err)
+		}
+		if etag != co.ETag {
+			return nil, false, internal.HTTPErrorf(http.StatusPreconditionFailed, "caldav: If-Match condition failed")
+		}
+	}
+
+	// The destination calendar needs to accept the object, like for PUT
+	destCalPath := path.Dir(path.Clean(dest)) + "/"
+	calendar, err := b.Backend.GetCalendar(ctx, destCalPath)
+	if internal.IsNotFound(err) {
+		return nil, false, internal.HTTPErrorf(http.StatusConflict, "caldav: calendar %q doesn't exist", destCalPath)
+	} else if err != nil {
+		return nil, false, err
+	}
+	version, _ := co.Data.Props.Text(ical.PropVersion)
+	if err := checkSupportedCalendarData(mime.FormatMediaType(ical.MIMEType, map[string]string{"version": version})); err != nil {
+		return nil, false, err
+	}
+	if calendar.MaxResourceSize > 0 {
+		var buf bytes.Buffer
+		if err := encodeCalendarData(&buf, co.Data); err != nil {
+			return nil, false, err
+		}
+		if int64(buf.Len()) > calendar.MaxResourceSize {
+			return nil, false, NewPreconditionError(PreconditionMaxResourceSize)
+		}
+	}
+	if err := checkCalendarObjectResource(calendar, co.Data); err != nil {
+		return nil, false, err
+	}
+
+	_, err = b.Backend.GetCalendarObject(ctx, dest, &CalendarCompRequest{})
+	if internal.IsNotFound(err) {
+		created = true
+	} else if err != nil {
+		return nil, false, err
+	} else if !overwrite {
+		return nil, false, internal.HTTPErrorf(http.StatusPreconditionFailed, "caldav: destination %q already exists", dest)
+	}
+
+	// The object being overwritten and the object being moved don't count
+	// as conflicts
+	ignore := []string{dest}
+	if move {
+		ignore = append(ignore, src)
+	}
+	if _, uid, err := ValidateCalendarObject(co.Data); err == nil && uid != "" {
+		err := b.checkUIDConflict(ctx, destCalPath, uid, ignore...)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	return co, created, nil
+}
+
+// checkUIDConflict returns a CALDAV:no-uid-conflict error if a calendar
+// object other than the ones in ignore has the specified UID in a calendar.
+//
+// UIDs must be unique in a calendar regardless of the component type, and a
+// calendar-query property filter only applies to a single component type, so
+// all the calendar objects are checked.
+func (b *backend) checkUIDConflict(ctx context.Context, calPath, uid string, ignore ...string) error {
+	l, err := b.Backend.QueryCalendarObjects(ctx, calPath, &CalendarQuery{
+		CompFilter: CompFilter{Name: ical.CompCalendar},
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, co := range l {
+		ignored := false
+		for _, p := range ignore {
+			if path.Clean(co.Path) == path.Clean(p) {
+				ignored = true
+				break
+			}
+		}
+		if !ignored && calendarObjectHasUID(co.Data, uid) {
+			return NewUIDConflictError(co.Path)
+		}
+	}
+	return nil
+}
+
+func calendarObjectHasUID(cal *ical.Calendar, uid string) bool {
+	for _, child := range cal.Children {
+		if v, _ := child.Props.Text(ical.PropUID); v == uid {
+			return true
+		}
+	}
+	return false
+}
+
+// isUIDConflictWith reports whether err is a CALDAV:no-uid-conflict error
+// caused by the calendar object at href.
+func isUIDConflictWith(err error, href string) bool {
+	var httpErr *internal.HTTPError
+	if !IsUIDConflict(err) || !errors.As(err, &httpErr) {
+		return false
+	}
+	return httpErr.Href != "" && path.Clean(httpErr.Href) == path.Clean(href)
+}
+
+// putCopy stores a copy of a calendar object at dest. If overwrite is false,
+// the backend is asked not to replace an object created concurrently.
+func (b *backend) putCopy(ctx context.Context, dest string, co *CalendarObject, overwrite bool) error {
+	var opts PutCalendarObjectOptions
+	if !overwrite {
+		opts.IfNoneMatch = "*"
+	}
+	_, err := b.Backend.PutCalendarObject(ctx, dest, co.Data, &opts)
+	return err
+}
+
 func (b *backend) Copy(r *http.Request, dest *internal.Href, recursive, overwrite bool) (created bool, err error) {
-	return false, internal.HTTPErrorf(http.StatusNotImplemented, "caldav: Copy not implemented")
+	co, created, err := b.checkCopyMove(r, dest.Path, overwrite, false)
+	if err != nil {
+		return false, err
+	}
+	if err := b.putCopy(r.Context(), dest.Path, co, overwrite); err != nil {
+		return false, err
+	}
+	return created, nil
 }
 
 func (b *backend) Move(r *http.Request, dest *internal.Href, overwrite bool) (created bool, err error) {
-	return false, internal.HTTPErrorf(http.StatusNotImplemented, "caldav: Move not implemented")
+	ctx := r.Context()
+	co, created, err := b.checkCopyMove(r, dest.Path, overwrite, true)
+	if err != nil {
+		return false, err
+	}
+
+	// The destination is stored first, so that the source object is left
+	// untouched on failure
+	err = b.putCopy(ctx, dest.Path, co, overwrite)
+	if err == nil {
+		return created, b.Backend.DeleteCalendarObject(ctx, r.URL.Path)
+	} else if !isUIDConflictWith(err, r.URL.Path) {
+		return false, err
+	}
+
+	// Within a calendar, backends enforcing UID uniqueness report a conflict
+	// with the source object, which needs to be removed first
+	if err := b.Backend.DeleteCalendarObject(ctx, r.URL.Path); err != nil {
+		return false, err
+	}
+	if err := b.putCopy(ctx, dest.Path, co, overwrite); err != nil {
+		_, restoreErr := b.Backend.PutCalendarObject(ctx, r.URL.Path, co.Data, &PutCalendarObjectOptions{IfNoneMatch: "*"})
+		if restoreErr != nil {
+			return false, fmt.Errorf("caldav: failed to move calendar object (%v) and to restore the source object: %v", err, restoreErr)
+		}
+		return false, err
+	}
+	return created, nil
 }
 
 // https://datatracker.ietf.org/doc/html/rfc4791#section-5.3.2.1
@@ -766,15 +1893,34 @@ const (
 	PreconditionMaxDateTime                  PreconditionType = "max-date-time"
 	PreconditionMaxInstances                 PreconditionType = "max-instances"
 	PreconditionMaxAttendeesPerInstance      PreconditionType = "max-attendees-per-instance"
+	PreconditionSupportedCollation           PreconditionType = "supported-collation"
+
+	// https://datatracker.ietf.org/doc/html/rfc6638#section-3.2.10
+	PreconditionValidSchedulingMessage PreconditionType = "valid-scheduling-message"
+	PreconditionOrganizerAllowed       PreconditionType = "organizer-allowed"
 )
 
+// NewInvalidSyncTokenError returns an error indicating that the sync token
+// passed to SyncBackend.SyncCalendarObjects is invalid or has expired.
+func NewInvalidSyncTokenError() error {
+	return internal.NewConditionError(http.StatusForbidden, internal.ValidSyncTokenName)
+}
+
 func NewPreconditionError(err PreconditionType) error {
 	name := xml.Name{Space: "urn:ietf:params:xml:ns:caldav", Local: string(err)}
 	elem := internal.NewRawXMLElement(name, nil, nil)
 	return &internal.HTTPError{
-		Code: 409,
+		Code:       409,
+		Conditions: []xml.Name{name},
 		Err: &internal.Error{
 			Raw: []internal.RawXMLValue{*elem},
 		},
 	}
 }
+
+// NewUIDConflictError returns a CALDAV:no-uid-conflict precondition error
+// referencing the calendar object resource which already uses the UID.
+func NewUIDConflictError(href string) error {
+	name := xml.Name{Space: namespace, Local: string(PreconditionNoUIDConflict)}
+	return internal.NewHrefConditionError(http.StatusConflict, name, href)
+}
@@ -5,12 +5,15 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/emersion/go-ical"
+	"github.com/emersion/go-webdav/internal"
 )
 
 var propFindSupportedCalendarComponentRequest = `
@@ -177,6 +180,74 @@ func TestMultiCalendarBackend(t *testing.T) {
 	}
 }
 
+// https://datatracker.ietf.org/doc/html/rfc4791#section-7.8.3
+var reportCalendarQueryExpand = `
+<?xml version="1.0" encoding="utf-8" ?>
+<C:calendar-query xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">
+  <D:prop>
+    <C:calendar-data>
+      <C:expand start="20060103T000000Z" end="20060105T000000Z"/>
+      <C:comp name="VCALENDAR">
+        <C:prop name="VERSION"/>
+        <C:comp name="VEVENT">
+          <C:prop name="SUMMARY"/>
+          <C:prop name="UID"/>
+          <C:prop name="DTSTART"/>
+          <C:prop name="DTEND"/>
+          <C:prop name="DURATION"/>
+          <C:prop name="RECURRENCE-ID"/>
+        </C:comp>
+      </C:comp>
+    </C:calendar-data>
+  </D:prop>
+  <C:filter>
+    <C:comp-filter name="VCALENDAR">
+      <C:comp-filter name="VEVENT">
+        <C:time-range start="20060103T000000Z" end="20060105T000000Z"/>
+      </C:comp-filter>
+    </C:comp-filter>
+  </C:filter>
+</C:calendar-query>
+`
+
+func TestCalendarQueryExpand(t *testing.T) {
+	calendar := Calendar{Path: "/user/calendars/a"}
+	object := CalendarObject{
+		Path: "/user/calendars/a/event.ics",
+		Data: parseRecurringEvent(t),
+	}
+	handler := Handler{Backend: testBackend{
+		calendars: []Calendar{calendar},
+		objectMap: map[string][]CalendarObject{calendar.Path: {object}},
+	}}
+
+	req := httptest.NewRequest("REPORT", calendar.Path, strings.NewReader(reportCalendarQueryExpand))
+	req.Header.Set("Content-Type", "application/xml")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	res := w.Result()
+	defer res.Body.Close()
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp := string(data)
+	for _, s := range []string{
+		"RECURRENCE-ID:20060103T170000Z",
+		"DTSTART:20060103T170000Z",
+	} {
+		if !strings.Contains(resp, s) {
+			t.Errorf("Expected %q in response:\n%v", s, resp)
+		}
+	}
+	for _, s := range []string{"RRULE", "DTSTAMP", "VTIMEZONE"} {
+		if strings.Contains(resp, s) {
+			t.Errorf("Unexpected %q in response:\n%v", s, resp)
+		}
+	}
+}
+
 type testBackend struct {
 	calendars []Calendar
 	objectMap map[string][]CalendarObject
@@ -222,7 +293,7 @@ func (t testBackend) GetCalendarObject(ctx context.Context, path string, req *Ca
 	return nil, fmt.Errorf("Couldn't find calendar object at: %s", path)
 }
 
-func (t testBackend) PutCalendarObject(ctx context.Context, path string, calendar *ical.Calendar, opts *PutCalendarObjectOptions) (*CalendarObject, error) {
+func (t testBackend) PutCalendarObject(ctx context.Context, path string, calendar *ical.Calendar, opts *PutCalendarObjectOptions) (*PutCalendarObjectResult, error) {
 	return nil, nil
 }
 
@@ -231,5 +302,527 @@ func (t testBackend) ListCalendarObjects(ctx context.Context, path string, req *
 }
 
 func (t testBackend) QueryCalendarObjects(ctx context.Context, path string, query *CalendarQuery) ([]CalendarObject, error) {
-	return nil, nil
+	return Filter(query, t.objectMap[path])
+}
+
+var reportSyncCollection = `
+<?xml version="1.0" encoding="UTF-8"?>
+<d:sync-collection xmlns:d="DAV:">
+  <d:sync-token>%s</d:sync-token>
+  <d:sync-level>1</d:sync-level>
+  <d:limit><d:nresults>1</d:nresults></d:limit>
+  <d:prop>
+    <d:getetag/>
+  </d:prop>
+</d:sync-collection>
+`
+
+type testSyncBackend struct {
+	testBackend
+	resp *SyncResponse
+}
+
+func (t testSyncBackend) SyncCalendarObjects(ctx context.Context, path string, query *SyncQuery) (*SyncResponse, error) {
+	if query.SyncToken != "http://example.org/sync/1" {
+		return nil, NewInvalidSyncTokenError()
+	}
+	if query.Limit != 1 {
+		return nil, fmt.Errorf("unexpected limit %v", query.Limit)
+	}
+	return t.resp, nil
+}
+
+func TestSyncCollection(t *testing.T) {
+	calendar := Calendar{Path: "/user/calendars/a/", SyncToken: "http://example.org/sync/2"}
+	handler := Handler{Backend: testSyncBackend{
+		testBackend: testBackend{calendars: []Calendar{calendar}},
+		resp: &SyncResponse{
+			SyncToken: "http://example.org/sync/2",
+			Updated:   []CalendarObject{{Path: "/user/calendars/a/1.ics", ETag: "abc"}},
+			Deleted:   []string{"/user/calendars/a/2.ics"},
+			Truncated: true,
+		},
+	}}
+
+	req := httptest.NewRequest("REPORT", calendar.Path, strings.NewReader(fmt.Sprintf(reportSyncCollection, "http://example.org/sync/1")))
+	req.Header.Set("Content-Type", "application/xml")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	res := w.Result()
+	defer res.Body.Close()
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp := string(data)
+	if res.StatusCode != 207 {
+		t.Fatalf("Expected status 207, got %v:\n%v", res.StatusCode, resp)
+	}
+	for _, s := range []string{
+		`<sync-token>http://example.org/sync/2</sync-token>`,
+		`&#34;abc&#34;</getetag>`,
+		`<href>/user/calendars/a/2.ics</href><status>HTTP/1.1 404 Not Found</status>`,
+		`<href>/user/calendars/a/</href><status>HTTP/1.1 507 Insufficient Storage</status>`,
+	} {
+		if !strings.Contains(resp, s) {
+			t.Errorf("Expected %v in response:\n%v", s, resp)
+		}
+	}
+
+	// An invalid token should be rejected
+	req = httptest.NewRequest("REPORT", calendar.Path, strings.NewReader(fmt.Sprintf(reportSyncCollection, "http://example.org/sync/0")))
+	req.Header.Set("Content-Type", "application/xml")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	res = w.Result()
+	defer res.Body.Close()
+	data, err = ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != 403 || !strings.Contains(string(data), "valid-sync-token") {
+		t.Errorf("Expected valid-sync-token error, got %v:\n%v", res.StatusCode, string(data))
+	}
+
+	// The sync-token property should be exposed along with the report
+	req = httptest.NewRequest("PROPFIND", calendar.Path, strings.NewReader(`<d:propfind xmlns:d="DAV:"><d:prop><d:sync-token/><d:supported-report-set/></d:prop></d:propfind>`))
+	req.Header.Set("Content-Type", "application/xml")
+	req.Header.Set("Depth", "0")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	res = w.Result()
+	defer res.Body.Close()
+	data, err = ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp = string(data)
+	if !strings.Contains(resp, "http://example.org/sync/2") || !strings.Contains(resp, "sync-collection") {
+		t.Errorf("Expected sync-token and sync-collection report in response:\n%v", resp)
+	}
+}
+
+var mkcalendarRequest = `<?xml version="1.0" encoding="utf-8" ?>
+<C:mkcalendar xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav" xmlns:A="http://apple.com/ns/ical/">
+  <D:set>
+    <D:prop>
+      <D:displayname>Lisa's Events</D:displayname>
+      <C:calendar-description xml:lang="en">Calendar restricted to events.</C:calendar-description>
+      <C:supported-calendar-component-set>
+        <C:comp name="VEVENT"/>
+      </C:supported-calendar-component-set>
+      <C:calendar-timezone><![CDATA[BEGIN:VCALENDAR
+PRODID:-//Example Corp.//CalDAV Client//EN
+VERSION:2.0
+BEGIN:VTIMEZONE
+TZID:US-Eastern
+BEGIN:STANDARD
+DTSTART:19671029T020000
+TZOFFSETFROM:-0400
+TZOFFSETTO:-0500
+TZNAME:Eastern Standard Time (US & Canada)
+END:STANDARD
+END:VTIMEZONE
+END:VCALENDAR
+]]></C:calendar-timezone>
+      <A:calendar-color>#FF0000</A:calendar-color>
+      <C:max-resource-size>1024</C:max-resource-size>
+    </D:prop>
+  </D:set>
+</C:mkcalendar>
+`
+
+var mkcolRequest = `<?xml version="1.0" encoding="utf-8" ?>
+<D:mkcol xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">
+  <D:set>
+    <D:prop>
+      <D:resourcetype><D:collection/><C:calendar/></D:resourcetype>
+      <D:displayname>Work</D:displayname>
+      <D:unknown-property>value</D:unknown-property>
+    </D:prop>
+  </D:set>
+</D:mkcol>
+`
+
+type testMkcolBackend struct {
+	testBackend
+	created *[]Calendar
+}
+
+func (t testMkcolBackend) CreateCalendar(ctx context.Context, calendar *Calendar) error {
+	*t.created = append(*t.created, *calendar)
+	return nil
+}
+
+func TestMkcalendar(t *testing.T) {
+	var created []Calendar
+	handler := Handler{Backend: testMkcolBackend{created: &created}}
+
+	req := httptest.NewRequest("MKCALENDAR", "/user/calendars/events/", strings.NewReader(mkcalendarRequest))
+	req.Header.Set("Content-Type", "application/xml")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	res := w.Result()
+	defer res.Body.Close()
+	if res.StatusCode != 201 {
+		data, _ := ioutil.ReadAll(res.Body)
+		t.Fatalf("Expected status 201, got %v:\n%s", res.StatusCode, data)
+	}
+	if len(created) != 1 {
+		t.Fatalf("Expected one calendar to be created, got %v", len(created))
+	}
+	cal := created[0]
+	if cal.Name != "Lisa's Events" || cal.Description != "Calendar restricted to events." || cal.Color != "#FF0000" || cal.MaxResourceSize != 1024 {
+		t.Errorf("Unexpected calendar: %+v", cal)
+	}
+	if len(cal.SupportedComponentSet) != 1 || cal.SupportedComponentSet[0] != "VEVENT" {
+		t.Errorf("Unexpected supported component set: %v", cal.SupportedComponentSet)
+	}
+	if !strings.Contains(cal.Timezone, "TZID:US-Eastern") {
+		t.Errorf("Unexpected timezone: %v", cal.Timezone)
+	}
+
+	// Extended MKCOL with an unsupported property should fail
+	req = httptest.NewRequest("MKCOL", "/user/calendars/work/", strings.NewReader(mkcolRequest))
+	req.Header.Set("Content-Type", "application/xml")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	res = w.Result()
+	defer res.Body.Close()
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp := string(data)
+	if res.StatusCode != 403 {
+		t.Fatalf("Expected status 403, got %v:\n%v", res.StatusCode, resp)
+	}
+	if len(created) != 1 {
+		t.Errorf("Calendar created despite failed MKCOL")
+	}
+	for _, s := range []string{"mkcol-response", "HTTP/1.1 403 Forbidden", "HTTP/1.1 424 Failed Dependency", "unknown-property"} {
+		if !strings.Contains(resp, s) {
+			t.Errorf("Expected %v in response:\n%v", s, resp)
+		}
+	}
+}
+
+var putEvent = `BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:-//Example Corp.//CalDAV Client//EN
+%sBEGIN:%s
+UID:put-test
+DTSTAMP:20060206T001121Z
+DTSTART:20060102T100000Z
+END:%s
+END:VCALENDAR
+`
+
+type testPutBackend struct {
+	testBackend
+	put *[]CalendarObject
+}
+
+func (t testPutBackend) PutCalendarObject(ctx context.Context, path string, calendar *ical.Calendar, opts *PutCalendarObjectOptions) (*PutCalendarObjectResult, error) {
+	co := CalendarObject{Path: path, Data: calendar}
+	*t.put = append(*t.put, co)
+	return &PutCalendarObjectResult{CalendarObject: co, Created: true}, nil
+}
+
+func TestPutPreconditions(t *testing.T) {
+	event := strings.ReplaceAll(fmt.Sprintf(putEvent, "", "VEVENT", "VEVENT"), "\n", "\r\n")
+	todo := strings.ReplaceAll(fmt.Sprintf(putEvent, "", "VTODO", "VTODO"), "\n", "\r\n")
+	scheduling := strings.ReplaceAll(fmt.Sprintf(putEvent, "METHOD:REQUEST\n", "VEVENT", "VEVENT"), "\n", "\r\n")
+
+	for _, tc := range []struct {
+		name         string
+		contentType  string
+		body         string
+		precondition PreconditionType
+	}{
+		{"valid", "text/calendar", event, ""},
+		{"unsupported-type", "text/plain", event, PreconditionSupportedCalendarData},
+		{"unsupported-version", "text/calendar; version=1.0", event, PreconditionSupportedCalendarData},
+		{"malformed", "text/calendar", "BEGIN:VCALENDAR\r\n", PreconditionValidCalendarData},
+		{"method", "text/calendar", scheduling, PreconditionValidCalendarObjectResource},
+		{"unsupported-component", "text/calendar", todo, PreconditionSupportedCalendarComponent},
+		{"too-large", "text/calendar", event + strings.Repeat(" ", 1024), PreconditionMaxResourceSize},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var put []CalendarObject
+			calendar := Calendar{Path: "/user/calendars/a/", MaxResourceSize: 1024}
+			handler := Handler{Backend: testPutBackend{
+				testBackend: testBackend{calendars: []Calendar{calendar}},
+				put:         &put,
+			}}
+
+			req := httptest.NewRequest("PUT", "/user/calendars/a/event.ics", strings.NewReader(tc.body))
+			req.Header.Set("Content-Type", tc.contentType)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			res := w.Result()
+			defer res.Body.Close()
+			data, err := ioutil.ReadAll(res.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tc.precondition == "" {
+				if res.StatusCode != 201 || len(put) != 1 {
+					t.Errorf("PUT returned status %v, expected 201 and a stored object:\n%s", res.StatusCode, data)
+				}
+				return
+			}
+			if res.StatusCode != 409 || len(put) != 0 {
+				t.Errorf("PUT returned status %v, expected 409 and no stored object", res.StatusCode)
+			}
+			if !strings.Contains(string(data), string(tc.precondition)) {
+				t.Errorf("PUT response doesn't contain the %v precondition:\n%s", tc.precondition, data)
+			}
+		})
+	}
+}
+
+type testCopyBackend struct {
+	testBackend
+	put     *[]string
+	deleted *[]string
+	// failPut contains the paths where PutCalendarObject fails
+	failPut map[string]bool
+	// conflicts maps paths to the object they have a UID conflict with, as
+	// long as it isn't deleted
+	conflicts map[string]string
+}
+
+func (t testCopyBackend) GetCalendarObject(ctx context.Context, path string, req *CalendarCompRequest) (*CalendarObject, error) {
+	co, err := t.testBackend.GetCalendarObject(ctx, path, req)
+	if err != nil {
+		return nil, internal.HTTPErrorf(http.StatusNotFound, "%v", err)
+	}
+	return co, nil
+}
+
+func (t testCopyBackend) PutCalendarObject(ctx context.Context, path string, calendar *ical.Calendar, opts *PutCalendarObjectOptions) (*PutCalendarObjectResult, error) {
+	if conflict, ok := t.conflicts[path]; ok && !containsString(*t.deleted, conflict) {
+		return nil, NewUIDConflictError(conflict)
+	}
+	if t.failPut[path] {
+		return nil, fmt.Errorf("failed to store %v", path)
+	}
+	*t.put = append(*t.put, path)
+	return &PutCalendarObjectResult{CalendarObject: CalendarObject{Path: path}, Created: true}, nil
+}
+
+func (t testCopyBackend) DeleteCalendarObject(ctx context.Context, path string) error {
+	*t.deleted = append(*t.deleted, path)
+	return nil
+}
+
+func containsString(l []string, s string) bool {
+	for _, v := range l {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func TestCopyMove(t *testing.T) {
+	newComponent := func(path, compType, uid string) CalendarObject {
+		event := strings.Replace(fmt.Sprintf(putEvent, "", compType, compType), "put-test", uid, 1)
+		cal, err := ical.NewDecoder(strings.NewReader(event)).Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return CalendarObject{Path: path, ETag: uid, Data: cal}
+	}
+	newObject := func(path, uid string) CalendarObject {
+		return newComponent(path, ical.CompEvent, uid)
+	}
+	objectMap := map[string][]CalendarObject{
+		"/user/calendars/a/": {
+			newObject("/user/calendars/a/a.ics", "a"),
+			newObject("/user/calendars/a/b.ics", "b"),
+		},
+		"/user/calendars/b/": {
+			newObject("/user/calendars/b/a.ics", "a-copy"),
+			// Only differs by case from the UID of a.ics
+			newObject("/user/calendars/b/c.ics", "A"),
+			// UIDs are unique across component types
+			newComponent("/user/calendars/b/todo.ics", ical.CompToDo, "b"),
+		},
+	}
+	calendars := []Calendar{
+		{Path: "/user/calendars/a/"},
+		{Path: "/user/calendars/b/"},
+		{Path: "/user/calendars/todo/", SupportedComponentSet: []string{ical.CompToDo}},
+		{Path: "/user/calendars/small/", MaxResourceSize: 10},
+	}
+
+	for _, tc := range []struct {
+		name         string
+		method       string
+		src          string
+		dest         string
+		header       map[string]string
+		failPut      map[string]bool
+		conflicts    map[string]string
+		code         int
+		precondition PreconditionType
+		put          []string
+		deleted      []string
+	}{{
+		name:   "copy-uid-conflict",
+		method: "COPY",
+		src:    "/user/calendars/a/a.ics",
+		dest:   "/user/calendars/a/c.ics",
+		code:   http.StatusConflict,
+	}, {
+		name:         "copy-uid-conflict-other-component",
+		method:       "COPY",
+		src:          "/user/calendars/a/b.ics",
+		dest:         "/user/calendars/b/d.ics",
+		code:         http.StatusConflict,
+		precondition: PreconditionNoUIDConflict,
+	}, {
+		name:   "copy",
+		method: "COPY",
+		src:    "/user/calendars/a/a.ics",
+		dest:   "/user/calendars/b/d.ics",
+		header: map[string]string{"If-Match": `"a"`},
+		code:   http.StatusCreated,
+		put:    []string{"/user/calendars/b/d.ics"},
+	}, {
+		name:         "copy-unsupported-component",
+		method:       "COPY",
+		src:          "/user/calendars/a/a.ics",
+		dest:         "/user/calendars/todo/a.ics",
+		code:         http.StatusConflict,
+		precondition: PreconditionSupportedCalendarComponent,
+	}, {
+		name:         "copy-too-large",
+		method:       "COPY",
+		src:          "/user/calendars/a/a.ics",
+		dest:         "/user/calendars/small/a.ics",
+		code:         http.StatusConflict,
+		precondition: PreconditionMaxResourceSize,
+	}, {
+		name:   "copy-if-match",
+		method: "COPY",
+		src:    "/user/calendars/a/a.ics",
+		dest:   "/user/calendars/b/d.ics",
+		header: map[string]string{"If-Match": `"b"`},
+		code:   http.StatusPreconditionFailed,
+	}, {
+		name:   "copy-overwrite",
+		method: "COPY",
+		src:    "/user/calendars/a/b.ics",
+		dest:   "/user/calendars/a/a.ics",
+		code:   http.StatusConflict,
+	}, {
+		name:    "move",
+		method:  "MOVE",
+		src:     "/user/calendars/a/a.ics",
+		dest:    "/user/calendars/a/c.ics",
+		code:    http.StatusCreated,
+		put:     []string{"/user/calendars/a/c.ics"},
+		deleted: []string{"/user/calendars/a/a.ics"},
+	}, {
+		// The source object is left untouched
+		name:    "move-failed",
+		method:  "MOVE",
+		src:     "/user/calendars/a/a.ics",
+		dest:    "/user/calendars/b/d.ics",
+		failPut: map[string]bool{"/user/calendars/b/d.ics": true},
+		code:    http.StatusInternalServerError,
+	}, {
+		name:         "move-uid-conflict",
+		method:       "MOVE",
+		src:          "/user/calendars/a/a.ics",
+		dest:         "/user/calendars/b/d.ics",
+		conflicts:    map[string]string{"/user/calendars/b/d.ics": "/user/calendars/b/e.ics"},
+		code:         http.StatusConflict,
+		precondition: PreconditionNoUIDConflict,
+	}, {
+		// The backend considers that the object conflicts with itself
+		name:      "move-self-conflict",
+		method:    "MOVE",
+		src:       "/user/calendars/a/a.ics",
+		dest:      "/user/calendars/a/c.ics",
+		conflicts: map[string]string{"/user/calendars/a/c.ics": "/user/calendars/a/a.ics"},
+		code:      http.StatusCreated,
+		put:       []string{"/user/calendars/a/c.ics"},
+		deleted:   []string{"/user/calendars/a/a.ics"},
+	}, {
+		name:      "move-restore",
+		method:    "MOVE",
+		src:       "/user/calendars/a/a.ics",
+		dest:      "/user/calendars/a/c.ics",
+		conflicts: map[string]string{"/user/calendars/a/c.ics": "/user/calendars/a/a.ics"},
+		failPut:   map[string]bool{"/user/calendars/a/c.ics": true},
+		code:      http.StatusInternalServerError,
+		put:       []string{"/user/calendars/a/a.ics"},
+		deleted:   []string{"/user/calendars/a/a.ics"},
+	}, {
+		name:      "move-restore-failed",
+		method:    "MOVE",
+		src:       "/user/calendars/a/a.ics",
+		dest:      "/user/calendars/a/c.ics",
+		conflicts: map[string]string{"/user/calendars/a/c.ics": "/user/calendars/a/a.ics"},
+		failPut:   map[string]bool{"/user/calendars/a/a.ics": true, "/user/calendars/a/c.ics": true},
+		code:      http.StatusInternalServerError,
+		deleted:   []string{"/user/calendars/a/a.ics"},
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			var put, deleted []string
+			handler := Handler{Backend: testCopyBackend{
+				testBackend: testBackend{calendars: calendars, objectMap: objectMap},
+				put:         &put,
+				deleted:     &deleted,
+				failPut:     tc.failPut,
+				conflicts:   tc.conflicts,
+			}}
+
+			req := httptest.NewRequest(tc.method, tc.src, nil)
+			req.Header.Set("Destination", "http://example.com"+tc.dest)
+			for k, v := range tc.header {
+				req.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tc.code {
+				t.Errorf("%v returned status %v, expected %v:\n%s", tc.method, w.Code, tc.code, w.Body)
+			}
+			if tc.precondition != "" && !strings.Contains(w.Body.String(), string(tc.precondition)) {
+				t.Errorf("%v response doesn't contain the %v precondition:\n%s", tc.method, tc.precondition, w.Body)
+			}
+			if !reflect.DeepEqual(put, tc.put) {
+				t.Errorf("stored objects %v, expected %v", put, tc.put)
+			}
+			if !reflect.DeepEqual(deleted, tc.deleted) {
+				t.Errorf("deleted objects %v, expected %v", deleted, tc.deleted)
+			}
+			if tc.name == "move-restore-failed" && !strings.Contains(w.Body.String(), "restore") {
+				t.Errorf("restore failure not reported:\n%s", w.Body)
+			}
+		})
+	}
+}
+
+func TestDeleteCalendar(t *testing.T) {
+	// testBackend doesn't implement DeleteBackend
+	handler := Handler{Backend: testBackend{}}
+	req := httptest.NewRequest("DELETE", "/user/calendars/a/", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("DELETE returned status %v, expected %v", w.Code, http.StatusForbidden)
+	}
 }
@@ -0,0 +1,347 @@
+// Package storage provides a CalDAV backend storing calendars on the local
+// filesystem.
+//
+// Each calendar is stored in its own directory, with its metadata in a JSON
+// sidecar file. Each calendar object is stored in its own iCalendar file.
+// Changes are recorded in a per-calendar change log to support collection
+// synchronization.
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/emersion/go-ical"
+	"github.com/emersion/go-webdav"
+	"github.com/emersion/go-webdav/caldav"
+	"github.com/emersion/go-webdav/internal/filestore"
+)
+
+// metadataFilename is the name of the JSON sidecar file holding calendar
+// metadata. Since it starts with a dot, it can't clash with object names.
+const metadataFilename = ".calendar.json"
+
+// calendarMetadata is the JSON representation of a calendar's metadata.
+type calendarMetadata struct {
+	Name                  string                   `json:"name,omitempty"`
+	Description           string                   `json:"description,omitempty"`
+	MaxResourceSize       int64                    `json:"max_resource_size,omitempty"`
+	SupportedComponentSet []string                 `json:"supported_component_set,omitempty"`
+	Timezone              string                   `json:"timezone,omitempty"`
+	Color                 string                   `json:"color,omitempty"`
+	Order                 int                      `json:"order,omitempty"`
+	DeadProps             []filestore.DeadProperty `json:"dead_props,omitempty"`
+}
+
+// Backend is a caldav.Backend storing calendars in a local directory.
+type Backend struct {
+	store         *filestore.Store
+	principalPath string
+
+	mu sync.RWMutex
+}
+
+var (
+	_ caldav.Backend       = (*Backend)(nil)
+	_ caldav.UpdateBackend = (*Backend)(nil)
+	_ caldav.DeleteBackend = (*Backend)(nil)
+)
+
+// New creates a new backend storing calendars in dir. The directory is
+// created if it doesn't exist.
+//
+// principalPath is the path of the current user principal and homeSetPath
+// the path of the calendar home set, e.g. "/user/" and "/user/calendars/".
+// Calendars are exposed as direct children of the home set.
+func New(dir, principalPath, homeSetPath string) (*Backend, error) {
+	if !strings.HasPrefix(homeSetPath, "/") || !strings.HasPrefix(principalPath, "/") {
+		return nil, fmt.Errorf("storage: principal and home set paths must be absolute")
+	}
+	store, err := filestore.New(dir, homeSetPath, metadataFilename, parseUID)
+	if err != nil {
+		return nil, err
+	}
+	return &Backend{store: store, principalPath: principalPath}, nil
+}
+
+// parseUID returns the UID of a stored calendar object.
+func parseUID(data []byte) (string, error) {
+	cal, err := ical.NewDecoder(bytes.NewReader(data)).Decode()
+	if err != nil {
+		return "", err
+	}
+	_, uid, err := caldav.ValidateCalendarObject(cal)
+	return uid, err
+}
+
+// calendarName returns the name of the calendar at the specified path.
+func (b *Backend) calendarName(p string) (string, error) {
+	calName, objName, err := b.store.SplitPath(p)
+	if err != nil {
+		return "", err
+	}
+	if objName != "" {
+		return "", webdav.NewHTTPError(http.StatusNotFound, fmt.Errorf("storage: %q is not a calendar", p))
+	}
+	return calName, nil
+}
+
+func (b *Backend) CalendarHomeSetPath(ctx context.Context) (string, error) {
+	return b.store.HomeSetPath(), nil
+}
+
+func (b *Backend) CurrentUserPrincipal(ctx context.Context) (string, error) {
+	return b.principalPath, nil
+}
+
+func (b *Backend) readCalendar(calName string) (*caldav.Calendar, error) {
+	var meta calendarMetadata
+	if err := b.store.ReadMetadata(calName, &meta); err != nil {
+		return nil, err
+	}
+
+	syncToken, err := b.store.SyncToken(calName)
+	if err != nil {
+		return nil, err
+	}
+
+	return &caldav.Calendar{
+		Path:                  b.store.CollectionPath(calName),
+		Name:                  meta.Name,
+		Description:           meta.Description,
+		MaxResourceSize:       meta.MaxResourceSize,
+		SupportedComponentSet: meta.SupportedComponentSet,
+		Timezone:              meta.Timezone,
+		Color:                 meta.Color,
+		Order:                 meta.Order,
+		SyncToken:             syncToken,
+		DeadProps:             filestore.DecodeDeadProps(meta.DeadProps),
+	}, nil
+}
+
+func newCalendarMetadata(cal *caldav.Calendar) *calendarMetadata {
+	return &calendarMetadata{
+		Name:                  cal.Name,
+		Description:           cal.Description,
+		MaxResourceSize:       cal.MaxResourceSize,
+		SupportedComponentSet: cal.SupportedComponentSet,
+		Timezone:              cal.Timezone,
+		Color:                 cal.Color,
+		Order:                 cal.Order,
+		DeadProps:             filestore.EncodeDeadProps(cal.DeadProps),
+	}
+}
+
+func (b *Backend) CreateCalendar(ctx context.Context, calendar *caldav.Calendar) error {
+	calName, err := b.calendarName(calendar.Path)
+	if err != nil {
+		return webdav.NewHTTPError(http.StatusForbidden, err)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.store.CreateCollection(calName, newCalendarMetadata(calendar))
+}
+
+func (b *Backend) UpdateCalendar(ctx context.Context, calendar *caldav.Calendar) error {
+	calName, err := b.calendarName(calendar.Path)
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, err := b.readCalendar(calName); err != nil {
+		return err
+	}
+	return b.store.WriteMetadata(calName, newCalendarMetadata(calendar))
+}
+
+func (b *Backend) DeleteCalendar(ctx context.Context, path string) error {
+	calName, err := b.calendarName(path)
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, err := b.readCalendar(calName); err != nil {
+		return err
+	}
+	return b.store.DeleteCollection(calName)
+}
+
+func (b *Backend) ListCalendars(ctx context.Context) ([]caldav.Calendar, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	names, err := b.store.ListCollections()
+	if err != nil {
+		return nil, err
+	}
+
+	var l []caldav.Calendar
+	for _, name := range names {
+		cal, err := b.readCalendar(name)
+		if caldav.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		l = append(l, *cal)
+	}
+	return l, nil
+}
+
+func (b *Backend) GetCalendar(ctx context.Context, path string) (*caldav.Calendar, error) {
+	calName, err := b.calendarName(path)
+	if err != nil {
+		return nil, err
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.readCalendar(calName)
+}
+
+// newCalendarObject parses a calendar object read from disk.
+func (b *Backend) newCalendarObject(calName string, obj *filestore.Object) (*caldav.CalendarObject, error) {
+	cal, err := ical.NewDecoder(bytes.NewReader(obj.Data)).Decode()
+	if err != nil {
+		return nil, fmt.Errorf("storage: failed to parse calendar object %q: %v", b.store.ObjectPath(calName, obj.Name), err)
+	}
+
+	return &caldav.CalendarObject{
+		Path:          b.store.ObjectPath(calName, obj.Name),
+		ModTime:       obj.ModTime,
+		ContentLength: int64(len(obj.Data)),
+		ETag:          obj.ETag,
+		Data:          cal,
+	}, nil
+}
+
+func (b *Backend) GetCalendarObject(ctx context.Context, path string, req *caldav.CalendarCompRequest) (*caldav.CalendarObject, error) {
+	calName, objName, err := b.store.SplitPath(path)
+	if err != nil {
+		return nil, err
+	}
+	if objName == "" {
+		return nil, webdav.NewHTTPError(http.StatusNotFound, fmt.Errorf("storage: %q is not a calendar object", path))
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	obj, err := b.store.ReadObject(calName, objName)
+	if err != nil {
+		return nil, err
+	}
+	return b.newCalendarObject(calName, obj)
+}
+
+func (b *Backend) ListCalendarObjects(ctx context.Context, path string, req *caldav.CalendarCompRequest) ([]caldav.CalendarObject, error) {
+	calName, err := b.calendarName(path)
+	if err != nil {
+		return nil, err
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if _, err := b.readCalendar(calName); err != nil {
+		return nil, err
+	}
+	objs, err := b.store.ListObjects(calName)
+	if err != nil {
+		return nil, err
+	}
+
+	l := make([]caldav.CalendarObject, 0, len(objs))
+	for i := range objs {
+		co, err := b.newCalendarObject(calName, &objs[i])
+		if err != nil {
+			return nil, err
+		}
+		l = append(l, *co)
+	}
+	return l, nil
+}
+
+func (b *Backend) QueryCalendarObjects(ctx context.Context, path string, query *caldav.CalendarQuery) ([]caldav.CalendarObject, error) {
+	l, err := b.ListCalendarObjects(ctx, path, &query.CompRequest)
+	if err != nil {
+		return nil, err
+	}
+	return caldav.Filter(query, l)
+}
+
+func (b *Backend) PutCalendarObject(ctx context.Context, path string, calendar *ical.Calendar, opts *caldav.PutCalendarObjectOptions) (*caldav.PutCalendarObjectResult, error) {
+	calName, objName, err := b.store.SplitPath(path)
+	if err != nil {
+		return nil, err
+	}
+	if objName == "" {
+		return nil, webdav.NewHTTPError(http.StatusMethodNotAllowed, fmt.Errorf("storage: %q is not a calendar object", path))
+	}
+	if opts == nil {
+		opts = new(caldav.PutCalendarObjectOptions)
+	}
+
+	_, uid, err := caldav.ValidateCalendarObject(calendar)
+	if err != nil {
+		return nil, caldav.NewPreconditionError(caldav.PreconditionValidCalendarObjectResource)
+	}
+
+	var buf bytes.Buffer
+	if err := ical.NewEncoder(&buf).Encode(calendar); err != nil {
+		return nil, caldav.NewPreconditionError(caldav.PreconditionValidCalendarData)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, err := b.readCalendar(calName); err != nil {
+		if caldav.IsNotFound(err) {
+			return nil, webdav.NewHTTPError(http.StatusConflict, fmt.Errorf("storage: calendar %q doesn't exist", calName))
+		}
+		return nil, err
+	}
+
+	obj, created, err := b.store.PutObject(calName, objName, buf.Bytes(), uid, opts.IfMatch, opts.IfNoneMatch)
+	var conflict *filestore.UIDConflictError
+	if errors.As(err, &conflict) {
+		return nil, caldav.NewUIDConflictError(b.store.ObjectPath(calName, conflict.Name))
+	} else if err != nil {
+		return nil, err
+	}
+
+	co, err := b.newCalendarObject(calName, obj)
+	if err != nil {
+		return nil, err
+	}
+	return &caldav.PutCalendarObjectResult{CalendarObject: *co, Created: created}, nil
+}
+
+func (b *Backend) DeleteCalendarObject(ctx context.Context, path string) error {
+	calName, objName, err := b.store.SplitPath(path)
+	if err != nil {
+		return err
+	}
+	if objName == "" {
+		return webdav.NewHTTPError(http.StatusMethodNotAllowed, fmt.Errorf("storage: %q is not a calendar object", path))
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.store.DeleteObject(calName, objName)
+}
@@ -0,0 +1,573 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-ical"
+	"github.com/emersion/go-webdav"
+	"github.com/emersion/go-webdav/caldav"
+)
+
+const testEvent = `BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:-//Example Corp.//CalDAV Client//EN
+BEGIN:VEVENT
+UID:%s
+DTSTAMP:20060206T001121Z
+DTSTART:20060102T100000Z
+DURATION:PT1H
+SUMMARY:Event
+END:VEVENT
+END:VCALENDAR
+`
+
+func parseEvent(t *testing.T, uid string) *ical.Calendar {
+	t.Helper()
+	s := strings.ReplaceAll(strings.Replace(testEvent, "%s", uid, 1), "\n", "\r\n")
+	cal, err := ical.NewDecoder(strings.NewReader(s)).Decode()
+	if err != nil {
+		t.Fatalf("failed to parse event: %v", err)
+	}
+	return cal
+}
+
+func newTestBackend(t *testing.T) *Backend {
+	t.Helper()
+	b, err := New(t.TempDir(), "/user/", "/user/calendars/")
+	if err != nil {
+		t.Fatalf("New() = %v", err)
+	}
+	err = b.CreateCalendar(context.Background(), &caldav.Calendar{
+		Path:                  "/user/calendars/work/",
+		Name:                  "Work",
+		SupportedComponentSet: []string{"VEVENT"},
+	})
+	if err != nil {
+		t.Fatalf("CreateCalendar() = %v", err)
+	}
+	return b
+}
+
+func TestBackend_calendars(t *testing.T) {
+	ctx := context.Background()
+	b := newTestBackend(t)
+
+	err := b.CreateCalendar(ctx, &caldav.Calendar{Path: "/user/calendars/work/"})
+	if err == nil {
+		t.Errorf("CreateCalendar() with an existing calendar succeeded")
+	}
+
+	l, err := b.ListCalendars(ctx)
+	if err != nil {
+		t.Fatalf("ListCalendars() = %v", err)
+	}
+	if len(l) != 1 || l[0].Path != "/user/calendars/work/" || l[0].Name != "Work" {
+		t.Errorf("ListCalendars() = %+v", l)
+	}
+
+	if _, err := b.GetCalendar(ctx, "/user/calendars/missing/"); !caldav.IsNotFound(err) {
+		t.Errorf("GetCalendar() with a missing calendar = %v, expected not found", err)
+	}
+}
+
+func TestBackend_objects(t *testing.T) {
+	ctx := context.Background()
+	b := newTestBackend(t)
+
+	co, err := b.PutCalendarObject(ctx, "/user/calendars/work/a.ics", parseEvent(t, "a"), nil)
+	if err != nil {
+		t.Fatalf("PutCalendarObject() = %v", err)
+	}
+	if co.ETag == "" {
+		t.Errorf("PutCalendarObject() returned an empty ETag")
+	}
+
+	got, err := b.GetCalendarObject(ctx, co.Path, nil)
+	if err != nil {
+		t.Fatalf("GetCalendarObject() = %v", err)
+	}
+	if got.ETag != co.ETag {
+		t.Errorf("GetCalendarObject() ETag = %q, expected %q", got.ETag, co.ETag)
+	}
+
+	_, err = b.PutCalendarObject(ctx, "/user/calendars/work/b.ics", parseEvent(t, "a"), nil)
+	var httpErr *webdav.HTTPError
+	if !caldav.IsUIDConflict(err) {
+		t.Errorf("PutCalendarObject() with a duplicate UID = %v, expected a UID conflict", err)
+	} else if !errors.As(err, &httpErr) || httpErr.Href != co.Path {
+		t.Errorf("PutCalendarObject() with a duplicate UID = %v, expected a conflict with %q", err, co.Path)
+	}
+
+	_, err = b.PutCalendarObject(ctx, co.Path, parseEvent(t, "a"), &caldav.PutCalendarObjectOptions{IfNoneMatch: "*"})
+	if !caldav.IsPreconditionFailed(err) {
+		t.Errorf("PutCalendarObject() with If-None-Match = %v, expected precondition failed", err)
+	}
+
+	_, err = b.PutCalendarObject(ctx, co.Path, parseEvent(t, "a"), &caldav.PutCalendarObjectOptions{IfMatch: `"wrong"`})
+	if !caldav.IsPreconditionFailed(err) {
+		t.Errorf("PutCalendarObject() with a mismatching If-Match = %v, expected precondition failed", err)
+	}
+
+	_, err = b.PutCalendarObject(ctx, co.Path, parseEvent(t, "a"), &caldav.PutCalendarObjectOptions{IfMatch: webdav.ConditionalMatch(`"` + co.ETag + `"`)})
+	if err != nil {
+		t.Errorf("PutCalendarObject() with a matching If-Match = %v", err)
+	}
+
+	l, err := b.QueryCalendarObjects(ctx, "/user/calendars/work/", &caldav.CalendarQuery{
+		CompFilter: caldav.CompFilter{
+			Name:  "VCALENDAR",
+			Comps: []caldav.CompFilter{{Name: "VEVENT"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("QueryCalendarObjects() = %v", err)
+	}
+	if len(l) != 1 {
+		t.Errorf("QueryCalendarObjects() returned %v objects, expected 1", len(l))
+	}
+
+	if err := b.DeleteCalendarObject(ctx, co.Path); err != nil {
+		t.Fatalf("DeleteCalendarObject() = %v", err)
+	}
+	if _, err := b.GetCalendarObject(ctx, co.Path, nil); !caldav.IsNotFound(err) {
+		t.Errorf("GetCalendarObject() after delete = %v, expected not found", err)
+	}
+}
+
+func TestBackend_sync(t *testing.T) {
+	ctx := context.Background()
+	b := newTestBackend(t)
+	const calPath = "/user/calendars/work/"
+
+	for _, name := range []string{"a", "b", "c"} {
+		if _, err := b.PutCalendarObject(ctx, calPath+name+".ics", parseEvent(t, name), nil); err != nil {
+			t.Fatalf("PutCalendarObject() = %v", err)
+		}
+	}
+
+	resp, err := b.SyncCalendarObjects(ctx, calPath, &caldav.SyncQuery{})
+	if err != nil {
+		t.Fatalf("SyncCalendarObjects() = %v", err)
+	}
+	if len(resp.Updated) != 3 || len(resp.Deleted) != 0 || resp.Truncated {
+		t.Errorf("initial SyncCalendarObjects() = %+v, expected 3 updated objects", resp)
+	}
+	cal, err := b.GetCalendar(ctx, calPath)
+	if err != nil {
+		t.Fatalf("GetCalendar() = %v", err)
+	}
+	if cal.SyncToken != resp.SyncToken {
+		t.Errorf("GetCalendar() sync token = %q, expected %q", cal.SyncToken, resp.SyncToken)
+	}
+
+	if err := b.DeleteCalendarObject(ctx, calPath+"a.ics"); err != nil {
+		t.Fatalf("DeleteCalendarObject() = %v", err)
+	}
+	if _, err := b.PutCalendarObject(ctx, calPath+"b.ics", parseEvent(t, "b"), nil); err != nil {
+		t.Fatalf("PutCalendarObject() = %v", err)
+	}
+
+	// Fetch the changes one at a time
+	token := resp.SyncToken
+	resp, err = b.SyncCalendarObjects(ctx, calPath, &caldav.SyncQuery{SyncToken: token, Limit: 1})
+	if err != nil {
+		t.Fatalf("SyncCalendarObjects() = %v", err)
+	}
+	if !resp.Truncated || len(resp.Deleted) != 1 || resp.Deleted[0] != calPath+"a.ics" {
+		t.Errorf("SyncCalendarObjects() = %+v, expected a truncated response with a.ics deleted", resp)
+	}
+
+	resp, err = b.SyncCalendarObjects(ctx, calPath, &caldav.SyncQuery{SyncToken: resp.SyncToken})
+	if err != nil {
+		t.Fatalf("SyncCalendarObjects() = %v", err)
+	}
+	if resp.Truncated || len(resp.Updated) != 1 || resp.Updated[0].Path != calPath+"b.ics" {
+		t.Errorf("SyncCalendarObjects() = %+v, expected b.ics updated", resp)
+	}
+
+	_, err = b.SyncCalendarObjects(ctx, calPath, &caldav.SyncQuery{SyncToken: "urn:x-go-webdav:sync:invalid:1"})
+	if err == nil {
+		t.Errorf("SyncCalendarObjects() with an invalid token succeeded")
+	}
+}
+
+func TestBackend_propPatch(t *testing.T) {
+	ctx := context.Background()
+	b := newTestBackend(t)
+	const calPath = "/user/calendars/work/"
+
+	srv := httptest.NewServer(&caldav.Handler{Backend: b})
+	defer srv.Close()
+	c, err := webdav.NewClient(nil, srv.URL)
+	if err != nil {
+		t.Fatalf("NewClient() = %v", err)
+	}
+
+	colorName := xml.Name{Space: "http://apple.com/ns/ical/", Local: "calendar-color"}
+	customName := xml.Name{Space: "http://example.org/ns", Local: "custom"}
+	set := []webdav.Property{
+		webdav.NewTextProperty(xml.Name{Space: "DAV:", Local: "displayname"}, "Office"),
+		webdav.NewTextProperty(colorName, "#00FF00"),
+		webdav.NewTextProperty(customName, "hello"),
+	}
+	resp, err := c.PropPatch(ctx, calPath, set, nil)
+	if err != nil {
+		t.Fatalf("PropPatch() = %v", err)
+	}
+	for name, prop := range resp.Props {
+		if err := prop.Err(); err != nil {
+			t.Errorf("PropPatch() property %v: %v", name, err)
+		}
+	}
+
+	cal, err := b.GetCalendar(ctx, calPath)
+	if err != nil {
+		t.Fatalf("GetCalendar() = %v", err)
+	}
+	if cal.Name != "Office" || cal.Color != "#00FF00" || len(cal.DeadProps) != 1 {
+		t.Errorf("GetCalendar() = %+v after PropPatch()", cal)
+	}
+
+	l, err := c.PropFind(ctx, calPath, webdav.DepthZero, customName)
+	if err != nil {
+		t.Fatalf("PropFind() = %v", err)
+	}
+	if len(l) != 1 {
+		t.Fatalf("PropFind() returned %v responses", len(l))
+	}
+	prop := l[0].Props[customName]
+	if s, err := prop.Text(); err != nil || s != "hello" {
+		t.Errorf("PropFind() dead property = %q, %v", s, err)
+	}
+
+	// Protected properties can't be set, and the update is atomic
+	set = []webdav.Property{
+		webdav.NewTextProperty(xml.Name{Space: "DAV:", Local: "displayname"}, "Home"),
+		webdav.NewTextProperty(xml.Name{Space: "DAV:", Local: "getetag"}, "abc"),
+	}
+	resp, err = c.PropPatch(ctx, calPath, set, []xml.Name{customName})
+	if err != nil {
+		t.Fatalf("PropPatch() = %v", err)
+	}
+	if prop := resp.Props[xml.Name{Space: "DAV:", Local: "getetag"}]; prop.Status != http.StatusForbidden {
+		t.Errorf("PropPatch() getetag status = %v, expected 403", prop.Status)
+	}
+	if prop := resp.Props[customName]; prop.Status != http.StatusFailedDependency {
+		t.Errorf("PropPatch() dead property status = %v, expected 424", prop.Status)
+	}
+	cal, err = b.GetCalendar(ctx, calPath)
+	if err != nil {
+		t.Fatalf("GetCalendar() = %v", err)
+	}
+	if cal.Name != "Office" || len(cal.DeadProps) != 1 {
+		t.Errorf("GetCalendar() = %+v after failed PropPatch()", cal)
+	}
+}
+
+// Dead properties may contain elements in other namespaces, which need to
+// survive being stored and sent back to the client.
+func TestBackend_deadPropNamespaces(t *testing.T) {
+	ctx := context.Background()
+	b := newTestBackend(t)
+	const calPath = "/user/calendars/work/"
+
+	srv := httptest.NewServer(&caldav.Handler{Backend: b})
+	defer srv.Close()
+	c, err := webdav.NewClient(nil, srv.URL)
+	if err != nil {
+		t.Fatalf("NewClient() = %v", err)
+	}
+
+	name := xml.Name{Space: "http://example.org/ns", Local: "links"}
+	prop := webdav.Property{
+		XMLName: name,
+		Raw: []byte(`<x:links xmlns:x="http://example.org/ns" xmlns="urn:example:other" xmlns:d="DAV:">` +
+			`<x:link rel="self"><d:href>/a</d:href></x:link><link><d:href>/b</d:href></link>` +
+			`</x:links>`),
+	}
+	resp, err := c.PropPatch(ctx, calPath, []webdav.Property{prop}, nil)
+	if err != nil {
+		t.Fatalf("PropPatch() = %v", err)
+	}
+	if got := resp.Props[name]; got.Err() != nil {
+		t.Fatalf("PropPatch() property: %v", got.Err())
+	}
+
+	type link struct {
+		Rel  string `xml:"rel,attr"`
+		Href string `xml:"DAV: href"`
+	}
+	// Fetch the property twice, to make sure the stored value is stable
+	for i := 0; i < 2; i++ {
+		var v struct {
+			XMLName xml.Name `xml:"http://example.org/ns links"`
+			Links   []link   `xml:"http://example.org/ns link"`
+			Other   []link   `xml:"urn:example:other link"`
+		}
+		l, err := c.PropFind(ctx, calPath, webdav.DepthZero, name)
+		if err != nil {
+			t.Fatalf("PropFind() = %v", err)
+		}
+		if len(l) != 1 {
+			t.Fatalf("PropFind() returned %v responses", len(l))
+		}
+		got := l[0].Props[name]
+		if err := got.Decode(&v); err != nil {
+			t.Fatalf("PropFind() property Decode() = %v, raw:\n%s", err, got.Raw)
+		}
+		if len(v.Links) != 1 || v.Links[0] != (link{"self", "/a"}) || len(v.Other) != 1 || v.Other[0].Href != "/b" {
+			t.Errorf("PropFind() property = %+v, raw:\n%s", v, got.Raw)
+		}
+
+		// Store the value as returned by the server again
+		if _, err := c.PropPatch(ctx, calPath, []webdav.Property{got}, nil); err != nil {
+			t.Fatalf("PropPatch() = %v", err)
+		}
+	}
+}
+
+func TestBackend_copyMove(t *testing.T) {
+	ctx := context.Background()
+	b := newTestBackend(t)
+	err := b.CreateCalendar(ctx, &caldav.Calendar{Path: "/user/calendars/home/"})
+	if err != nil {
+		t.Fatalf("CreateCalendar() = %v", err)
+	}
+
+	srv := httptest.NewServer(&caldav.Handler{Backend: b})
+	defer srv.Close()
+	c, err := webdav.NewClient(nil, srv.URL)
+	if err != nil {
+		t.Fatalf("NewClient() = %v", err)
+	}
+
+	for _, name := range []string{"a", "b"} {
+		if _, err := b.PutCalendarObject(ctx, "/user/calendars/work/"+name+".ics", parseEvent(t, name), nil); err != nil {
+			t.Fatalf("PutCalendarObject() = %v", err)
+		}
+	}
+
+	// Copying within a calendar duplicates the UID
+	err = c.Copy(ctx, "/user/calendars/work/a.ics", "/user/calendars/work/c.ics", nil)
+	if !caldav.HasPrecondition(err, caldav.PreconditionNoUIDConflict) {
+		t.Errorf("Copy() within a calendar = %v, expected a UID conflict", err)
+	}
+
+	if err := c.Copy(ctx, "/user/calendars/work/a.ics", "/user/calendars/home/a.ics", nil); err != nil {
+		t.Fatalf("Copy() = %v", err)
+	}
+	if _, err := b.GetCalendarObject(ctx, "/user/calendars/home/a.ics", nil); err != nil {
+		t.Errorf("GetCalendarObject() after Copy() = %v", err)
+	}
+
+	err = c.Move(ctx, "/user/calendars/work/b.ics", "/user/calendars/home/a.ics", &webdav.MoveOptions{NoOverwrite: true})
+	if !caldav.IsPreconditionFailed(err) {
+		t.Errorf("Move() without overwrite = %v, expected precondition failed", err)
+	}
+
+	if err := c.Move(ctx, "/user/calendars/work/b.ics", "/user/calendars/work/d.ics", nil); err != nil {
+		t.Fatalf("Move() within a calendar = %v", err)
+	}
+	if err := c.Move(ctx, "/user/calendars/work/d.ics", "/user/calendars/home/b.ics", nil); err != nil {
+		t.Fatalf("Move() = %v", err)
+	}
+	if _, err := b.GetCalendarObject(ctx, "/user/calendars/work/d.ics", nil); !caldav.IsNotFound(err) {
+		t.Errorf("GetCalendarObject() after Move() = %v, expected not found", err)
+	}
+	if _, err := b.GetCalendarObject(ctx, "/user/calendars/home/b.ics", nil); err != nil {
+		t.Errorf("GetCalendarObject() after Move() = %v", err)
+	}
+
+	if err := c.RemoveAll(ctx, "/user/calendars/home/"); err != nil {
+		t.Fatalf("RemoveAll() = %v", err)
+	}
+	if _, err := b.GetCalendar(ctx, "/user/calendars/home/"); !caldav.IsNotFound(err) {
+		t.Errorf("GetCalendar() after delete = %v, expected not found", err)
+	}
+}
+
+func TestBackend_put(t *testing.T) {
+	ctx := context.Background()
+	b := newTestBackend(t)
+
+	srv := httptest.NewServer(&caldav.Handler{Backend: b})
+	defer srv.Close()
+
+	var buf bytes.Buffer
+	if err := ical.NewEncoder(&buf).Encode(parseEvent(t, "a")); err != nil {
+		t.Fatal(err)
+	}
+	canonical := buf.String()
+	// Properties aren't in the order the encoder writes them
+	unordered := strings.ReplaceAll(strings.Replace(testEvent, "%s", "a", 1), "\n", "\r\n")
+
+	for _, tc := range []struct {
+		name     string
+		body     string
+		expected int
+		etag     bool
+	}{
+		{"create", canonical, http.StatusCreated, true},
+		{"update", canonical, http.StatusNoContent, true},
+		{"unordered", unordered, http.StatusNoContent, false},
+	} {
+		req, err := http.NewRequest(http.MethodPut, srv.URL+"/user/calendars/work/a.ics", strings.NewReader(tc.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", ical.MIMEType)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%v: PUT request failed: %v", tc.name, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tc.expected {
+			t.Errorf("%v: PUT returned status %v, expected %v", tc.name, resp.StatusCode, tc.expected)
+		}
+
+		co, err := b.GetCalendarObject(ctx, "/user/calendars/work/a.ics", nil)
+		if err != nil {
+			t.Fatalf("GetCalendarObject() = %v", err)
+		}
+		expectedETag := ""
+		if tc.etag {
+			expectedETag = `"` + co.ETag + `"`
+		}
+		if etag := resp.Header.Get("ETag"); etag != expectedETag {
+			t.Errorf("%v: PUT returned ETag %q, expected %q", tc.name, etag, expectedETag)
+		}
+	}
+}
+
+func TestBackend_partialCalendarData(t *testing.T) {
+	ctx := context.Background()
+	b := newTestBackend(t)
+	if _, err := b.PutCalendarObject(ctx, "/user/calendars/work/a.ics", parseEvent(t, "a"), nil); err != nil {
+		t.Fatalf("PutCalendarObject() = %v", err)
+	}
+
+	srv := httptest.NewServer(&caldav.Handler{Backend: b})
+	defer srv.Close()
+	c, err := caldav.NewClient(nil, srv.URL)
+	if err != nil {
+		t.Fatalf("NewClient() = %v", err)
+	}
+
+	compReq := caldav.CalendarCompRequest{
+		Name: "VCALENDAR",
+		Comps: []caldav.CalendarCompRequest{{
+			Name:  "VEVENT",
+			Props: []string{"UID", "SUMMARY"},
+		}},
+	}
+	l, err := c.QueryCalendar(ctx, "/user/calendars/work/", &caldav.CalendarQuery{
+		CompRequest: compReq,
+		CompFilter:  caldav.CompFilter{Name: "VCALENDAR"},
+	})
+	if err != nil {
+		t.Fatalf("QueryCalendar() = %v", err)
+	}
+	if len(l) != 1 {
+		t.Fatalf("QueryCalendar() returned %v objects, expected 1", len(l))
+	}
+	if len(l[0].Data.Props) != 0 || len(l[0].Data.Children) != 1 {
+		t.Fatalf("QueryCalendar() returned %+v, expected a single VEVENT", l[0].Data.Component)
+	}
+	event := l[0].Data.Children[0]
+	if len(event.Props) != 2 || event.Props.Get(ical.PropSummary) == nil {
+		t.Errorf("QueryCalendar() returned event properties %v, expected UID and SUMMARY", event.Props)
+	}
+}
+
+func TestBackend_expand(t *testing.T) {
+	ctx := context.Background()
+	b := newTestBackend(t)
+
+	s := strings.Replace(testEvent, "DURATION:PT1H\n", "DURATION:PT1H\nRRULE:FREQ=DAILY;COUNT=3\n", 1)
+	s = strings.ReplaceAll(strings.Replace(s, "%s", "a", 1), "\n", "\r\n")
+	cal, err := ical.NewDecoder(strings.NewReader(s)).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.PutCalendarObject(ctx, "/user/calendars/work/a.ics", cal, nil); err != nil {
+		t.Fatalf("PutCalendarObject() = %v", err)
+	}
+
+	srv := httptest.NewServer(&caldav.Handler{Backend: b})
+	defer srv.Close()
+	c, err := caldav.NewClient(nil, srv.URL)
+	if err != nil {
+		t.Fatalf("NewClient() = %v", err)
+	}
+
+	l, err := c.MultiGetCalendar(ctx, "/user/calendars/work/", &caldav.CalendarMultiGet{
+		Paths: []string{"/user/calendars/work/a.ics"},
+		CompRequest: caldav.CalendarCompRequest{
+			AllProps: true,
+			AllComps: true,
+			Expand: &caldav.TimeRange{
+				Start: time.Date(2006, 1, 3, 0, 0, 0, 0, time.UTC),
+				End:   time.Date(2006, 1, 10, 0, 0, 0, 0, time.UTC),
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("MultiGetCalendar() = %v", err)
+	}
+	if len(l) != 1 {
+		t.Fatalf("MultiGetCalendar() returned %v objects, expected 1", len(l))
+	}
+	if n := len(l[0].Data.Events()); n != 2 {
+		t.Errorf("MultiGetCalendar() returned %v instances, expected 2", n)
+	}
+}
+
+func TestBackend_freeBusyQuery(t *testing.T) {
+	ctx := context.Background()
+	b := newTestBackend(t)
+	if _, err := b.PutCalendarObject(ctx, "/user/calendars/work/a.ics", parseEvent(t, "a"), nil); err != nil {
+		t.Fatalf("PutCalendarObject() = %v", err)
+	}
+
+	srv := httptest.NewServer(&caldav.Handler{Backend: b})
+	defer srv.Close()
+
+	body := `<?xml version="1.0" encoding="utf-8" ?>
+<C:free-busy-query xmlns:C="urn:ietf:params:xml:ns:caldav">
+  <C:time-range start="20060102T000000Z" end="20060103T000000Z"/>
+</C:free-busy-query>`
+	req, err := http.NewRequest("REPORT", srv.URL+"/user/calendars/work/", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/xml")
+	req.Header.Set("Depth", "1")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("REPORT request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("REPORT returned status %v, expected 200", resp.StatusCode)
+	}
+
+	cal, err := ical.NewDecoder(resp.Body).Decode()
+	if err != nil {
+		t.Fatalf("failed to parse free-busy response: %v", err)
+	}
+	if len(cal.Children) != 1 || cal.Children[0].Name != ical.CompFreeBusy {
+		t.Fatalf("REPORT returned %+v, expected a VFREEBUSY component", cal.Component)
+	}
+	prop := cal.Children[0].Props.Get(ical.PropFreeBusy)
+	if prop == nil || prop.Value != "20060102T100000Z/20060102T110000Z" {
+		t.Errorf("REPORT returned busy period %+v", prop)
+	}
+}
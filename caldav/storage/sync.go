@@ -0,0 +1,40 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/emersion/go-webdav/caldav"
+)
+
+var _ caldav.SyncBackend = (*Backend)(nil)
+
+func (b *Backend) SyncCalendarObjects(ctx context.Context, path string, query *caldav.SyncQuery) (*caldav.SyncResponse, error) {
+	calName, err := b.calendarName(path)
+	if err != nil {
+		return nil, err
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if _, err := b.readCalendar(calName); err != nil {
+		return nil, err
+	}
+	res, err := b.store.Sync(calName, query.SyncToken, query.Limit)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := caldav.SyncResponse{SyncToken: res.SyncToken, Truncated: res.Truncated}
+	for i := range res.Updated {
+		co, err := b.newCalendarObject(calName, &res.Updated[i])
+		if err != nil {
+			return nil, err
+		}
+		resp.Updated = append(resp.Updated, *co)
+	}
+	for _, name := range res.Deleted {
+		resp.Deleted = append(resp.Deleted, b.store.ObjectPath(calName, name))
+	}
+	return &resp, nil
+}
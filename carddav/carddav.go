@@ -4,6 +4,7 @@
 package carddav
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/emersion/go-vcard"
@@ -28,13 +29,32 @@ type AddressBook struct {
 	Description          string
 	MaxResourceSize      int64
 	SupportedAddressData []AddressDataType
+	// DeadProps contains arbitrary properties set by clients.
+	DeadProps []webdav.Property
+	// SyncToken is the current sync token of the address book, if the
+	// backend implements SyncBackend. It's also used as the CTag.
+	SyncToken string
 }
 
-func (ab *AddressBook) SupportsAddressData(contentType, version string) bool {
+// defaultSupportedAddressData is the list of address data types supported by
+// address books which don't specify SupportedAddressData.
+var defaultSupportedAddressData = []AddressDataType{
+	{ContentType: vcard.MIMEType, Version: "3.0"},
+	{ContentType: vcard.MIMEType, Version: "4.0"},
+}
+
+func (ab *AddressBook) supportedAddressData() []AddressDataType {
 	if len(ab.SupportedAddressData) == 0 {
-		return contentType == "text/vcard" && version == "3.0"
+		return defaultSupportedAddressData
 	}
-	for _, t := range ab.SupportedAddressData {
+	return ab.SupportedAddressData
+}
+
+// SupportsAddressData reports whether the address book can store address
+// objects of the specified media type and version. Address books which don't
+// specify SupportedAddressData support vCard 3.0 and 4.0.
+func (ab *AddressBook) SupportsAddressData(contentType, version string) bool {
+	for _, t := range ab.supportedAddressData() {
 		if t.ContentType == contentType && t.Version == version {
 			return true
 		}
@@ -42,6 +62,22 @@ func (ab *AddressBook) SupportsAddressData(contentType, version string) bool {
 	return false
 }
 
+// ValidateAddressObject checks that a vCard has the properties required by
+// RFC 6350 and RFC 6352 section 5.1, and returns its UID.
+func ValidateAddressObject(card vcard.Card) (uid string, err error) {
+	if card.Value(vcard.FieldVersion) == "" {
+		return "", fmt.Errorf("carddav: missing VERSION property")
+	}
+	if card.Value(vcard.FieldFormattedName) == "" {
+		return "", fmt.Errorf("carddav: missing FN property")
+	}
+	uid = card.Value(vcard.FieldUID)
+	if uid == "" {
+		return "", fmt.Errorf("carddav: missing UID property")
+	}
+	return uid, nil
+}
+
 type AddressBookQuery struct {
 	DataRequest AddressDataRequest
 
@@ -78,6 +114,10 @@ type TextMatch struct {
 	Text            string
 	NegateCondition bool
 	MatchType       MatchType // defaults to MatchContains
+	// Collation is the collation used to compare text: "i;octet",
+	// "i;ascii-casemap" or "i;unicode-casemap". Defaults to
+	// "i;ascii-casemap".
+	Collation string
 }
 
 type FilterTest string
@@ -121,4 +161,7 @@ type SyncResponse struct {
 	SyncToken string
 	Updated   []AddressObject
 	Deleted   []string
+	// Truncated is set if only part of the changes are returned. The
+	// remaining changes can be fetched with SyncToken.
+	Truncated bool
 }
@@ -111,7 +111,7 @@ func (*testBackend) QueryAddressObjects(ctx context.Context, path string, query
 	panic("TODO: implement")
 }
 
-func (*testBackend) PutAddressObject(ctx context.Context, path string, card vcard.Card, opts *PutAddressObjectOptions) (*AddressObject, error) {
+func (*testBackend) PutAddressObject(ctx context.Context, path string, card vcard.Card, opts *PutAddressObjectOptions) (*PutAddressObjectResult, error) {
 	panic("TODO: implement")
 }
 
@@ -240,3 +240,157 @@ func TestCreateAddressbookMinimalBody(t *testing.T) {
 		t.Fatalf("Address book sdscription is '%s', expected 'My primary address book.'", c.Description)
 	}
 }
+
+type testPutBackend struct {
+	testBackend
+	objects []AddressObject
+}
+
+func (b *testPutBackend) QueryAddressObjects(ctx context.Context, path string, query *AddressBookQuery) ([]AddressObject, error) {
+	return Filter(query, b.objects)
+}
+
+func (b *testPutBackend) PutAddressObject(ctx context.Context, path string, card vcard.Card, opts *PutAddressObjectOptions) (*PutAddressObjectResult, error) {
+	return &PutAddressObjectResult{Created: true}, nil
+}
+
+func TestPutUIDConflict(t *testing.T) {
+	abPath := "/user/contacts/default/"
+	card, err := vcard.NewDecoder(strings.NewReader(aliceData)).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := Handler{Backend: &testPutBackend{
+		objects: []AddressObject{{Path: abPath + "alice.vcf", Card: card}},
+	}}
+
+	for _, tc := range []struct {
+		uid  string
+		code int
+	}{
+		{"urn:uuid:4fbe8971-0bc3-424c-9c26-36c3e1eff6b1", http.StatusConflict},
+		// UIDs are compared byte for byte
+		{"urn:uuid:4FBE8971-0BC3-424C-9C26-36C3E1EFF6B1", http.StatusCreated},
+	} {
+		body := strings.Replace(aliceData, "UID:urn:uuid:4fbe8971-0bc3-424c-9c26-36c3e1eff6b1", "UID:"+tc.uid, 1)
+		req := httptest.NewRequest(http.MethodPut, abPath+"other.vcf", strings.NewReader(body))
+		req.Header.Set("Content-Type", vcard.MIMEType)
+		ctx := context.WithValue(req.Context(), addressBookPathKey, abPath)
+		req = req.WithContext(ctx)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if w.Code != tc.code {
+			t.Errorf("PUT with UID %q: got status %v, want %v", tc.uid, w.Code, tc.code)
+		}
+		// The conflicting resource must be referenced
+		if tc.code == http.StatusConflict && !strings.Contains(w.Body.String(), abPath+"alice.vcf</href>") {
+			t.Errorf("PUT with UID %q: expected the conflicting resource in the response:\n%v", tc.uid, w.Body.String())
+		}
+	}
+}
+
+var reportSyncCollection = `
+<?xml version="1.0" encoding="UTF-8"?>
+<d:sync-collection xmlns:d="DAV:">
+  <d:sync-token>%s</d:sync-token>
+  <d:sync-level>1</d:sync-level>
+  <d:limit><d:nresults>1</d:nresults></d:limit>
+  <d:prop>
+    <d:getetag/>
+  </d:prop>
+</d:sync-collection>
+`
+
+type testSyncBackend struct {
+	testBackend
+	addressBook AddressBook
+	resp        *SyncResponse
+}
+
+func (b *testSyncBackend) ListAddressBooks(ctx context.Context) ([]AddressBook, error) {
+	return []AddressBook{b.addressBook}, nil
+}
+
+func (b *testSyncBackend) GetAddressBook(ctx context.Context, path string) (*AddressBook, error) {
+	if path != b.addressBook.Path {
+		return nil, webdav.NewHTTPError(404, fmt.Errorf("Not found"))
+	}
+	ab := b.addressBook
+	return &ab, nil
+}
+
+func (b *testSyncBackend) SyncAddressObjects(ctx context.Context, path string, query *SyncQuery) (*SyncResponse, error) {
+	if query.SyncToken != "http://example.org/sync/1" {
+		return nil, NewInvalidSyncTokenError()
+	}
+	if query.Limit != 1 {
+		return nil, fmt.Errorf("unexpected limit %v", query.Limit)
+	}
+	return b.resp, nil
+}
+
+func TestSyncCollection(t *testing.T) {
+	ab := AddressBook{Path: "/user/contacts/default/", SyncToken: "http://example.org/sync/2"}
+	handler := Handler{Backend: &testSyncBackend{
+		addressBook: ab,
+		resp: &SyncResponse{
+			SyncToken: "http://example.org/sync/2",
+			Updated:   []AddressObject{{Path: "/user/contacts/default/1.vcf", ETag: "abc"}},
+			Deleted:   []string{"/user/contacts/default/2.vcf"},
+			Truncated: true,
+		},
+	}}
+
+	do := func(method, body string) (int, string) {
+		req := httptest.NewRequest(method, ab.Path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/xml")
+		req.Header.Set("Depth", "0")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code, w.Body.String()
+	}
+
+	code, resp := do("REPORT", fmt.Sprintf(reportSyncCollection, "http://example.org/sync/1"))
+	if code != http.StatusMultiStatus {
+		t.Fatalf("Expected status 207, got %v:\n%v", code, resp)
+	}
+	for _, s := range []string{
+		`<sync-token>http://example.org/sync/2</sync-token>`,
+		`&#34;abc&#34;</getetag>`,
+		`<href>/user/contacts/default/2.vcf</href><status>HTTP/1.1 404 Not Found</status>`,
+		`<href>/user/contacts/default/</href><status>HTTP/1.1 507 Insufficient Storage</status>`,
+	} {
+		if !strings.Contains(resp, s) {
+			t.Errorf("Expected %v in response:\n%v", s, resp)
+		}
+	}
+
+	// An invalid token should be rejected
+	code, resp = do("REPORT", fmt.Sprintf(reportSyncCollection, "http://example.org/sync/0"))
+	if code != http.StatusForbidden || !strings.Contains(resp, "valid-sync-token") {
+		t.Errorf("Expected valid-sync-token error, got %v:\n%v", code, resp)
+	}
+
+	// So should an invalid sync level
+	code, resp = do("REPORT", strings.Replace(fmt.Sprintf(reportSyncCollection, "http://example.org/sync/1"), "<d:sync-level>1", "<d:sync-level>2", 1))
+	if code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an invalid sync-level, got %v:\n%v", code, resp)
+	}
+
+	// The sync-token and getctag properties should be exposed along with the
+	// report
+	code, resp = do("PROPFIND", `<d:propfind xmlns:d="DAV:" xmlns:cs="http://calendarserver.org/ns/"><d:prop><d:sync-token/><cs:getctag/><d:supported-report-set/></d:prop></d:propfind>`)
+	if code != http.StatusMultiStatus {
+		t.Fatalf("Expected status 207, got %v:\n%v", code, resp)
+	}
+	for _, s := range []string{
+		`<sync-token xmlns="DAV:">http://example.org/sync/2</sync-token>`,
+		`<getctag xmlns="http://calendarserver.org/ns/">http://example.org/sync/2</getctag>`,
+		`sync-collection`,
+	} {
+		if !strings.Contains(resp, s) {
+			t.Errorf("Expected %v in response:\n%v", s, resp)
+		}
+	}
+}
@@ -17,9 +17,58 @@ import (
 )
 
 // DiscoverContextURL performs a DNS-based CardDAV service discovery as
-// described in RFC 6352 section 11. It returns the URL to the CardDAV server.
+// described in RFC 6764 section 3 and 4. It returns the URL to the CardDAV
+// server.
 func DiscoverContextURL(ctx context.Context, domain string) (string, error) {
-	return internal.DiscoverContextURL(ctx, "carddavs", domain)
+	return internal.DiscoverContextURL(ctx, "carddav", domain)
+}
+
+// Discovery is the result of a CardDAV service discovery.
+type Discovery struct {
+	Client *Client
+	// Endpoint is the context URL of the CardDAV server.
+	Endpoint string
+	// Principal is the path of the current user principal.
+	Principal string
+	// AddressBookHomeSet is the path of the current user's address book home set.
+	AddressBookHomeSet string
+}
+
+// Discover performs the CardDAV bootstrapping procedure described in RFC 6764
+// section 6: SRV and TXT lookups, well-known URI redirect handling,
+// current-user-principal and home set lookups. It returns a client for the
+// discovered server.
+//
+// domain can either be a domain name, an e-mail address or an URL. If
+// options is nil, defaults are used.
+func Discover(ctx context.Context, c webdav.HTTPClient, domain string, options *webdav.DiscoveryOptions) (*Discovery, error) {
+	if options == nil {
+		options = new(webdav.DiscoveryOptions)
+	}
+	trace := internal.DiscoveryTrace(options.Trace)
+
+	endpoint, principal, err := internal.DiscoverPrincipal(ctx, c, options.Resolver, "carddav", domain, trace)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := NewClient(c, endpoint.String())
+	if err != nil {
+		return nil, err
+	}
+
+	homeSet, err := client.FindAddressBookHomeSet(ctx, principal)
+	trace.Step("home-set", client.ic.ResolveHref(principal).String(), homeSet, err)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Discovery{
+		Client:             client,
+		Endpoint:           endpoint.String(),
+		Principal:          principal,
+		AddressBookHomeSet: homeSet,
+	}, nil
 }
 
 // Client provides access to a remote CardDAV server.
@@ -201,6 +250,7 @@ func encodeTextMatch(tm *TextMatch) *textMatch {
 		Text:            tm.Text,
 		NegateCondition: negateCondition(tm.NegateCondition),
 		MatchType:       matchType(tm.MatchType),
+		Collation:       tm.Collation,
 	}
 }
 
@@ -469,6 +519,10 @@ func (c *Client) SyncCollection(
 			if err, ok := err.(*internal.HTTPError); ok && err.Code == http.StatusNotFound {
 				ret.Deleted = append(ret.Deleted, p)
 				continue
+			} else if ok && err.Code == http.StatusInsufficientStorage && (p == path || path == fmt.Sprintf("%s/", p)) {
+				// The server truncated the results, see RFC 6578 section 3.6
+				ret.Truncated = true
+				continue
 			}
 			return nil, err
 		}
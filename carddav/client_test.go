@@ -0,0 +1,97 @@
+package carddav
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/emersion/go-webdav"
+)
+
+type testResolver struct {
+	target string
+	port   uint16
+}
+
+func (r *testResolver) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	if service != "carddavs" || proto != "tcp" || name != "example.org" {
+		return "", nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+	return "", []*net.SRV{{Target: r.target + ".", Port: r.port}}, nil
+}
+
+func (r *testResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+}
+
+func TestDiscover(t *testing.T) {
+	handler := Handler{Backend: &testBackend{}}
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/.well-known/carddav" {
+			// Some servers redirect with 301, which turns the PROPFIND into
+			// a GET if the HTTP client follows it
+			http.Redirect(w, r, "/user/", http.StatusMovedPermanently)
+			return
+		}
+		ctx := context.WithValue(r.Context(), currentUserPrincipalKey, "/user/")
+		ctx = context.WithValue(ctx, homeSetPathKey, "/user/contacts/")
+		ctx = context.WithValue(ctx, addressBookPathKey, "/user/contacts/default/")
+		handler.ServeHTTP(w, r.WithContext(ctx))
+	}))
+	defer srv.Close()
+
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, err := strconv.Atoi(u.Port())
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolver := &testResolver{target: u.Hostname(), port: uint16(port)}
+
+	for _, tc := range []struct {
+		name   string
+		client webdav.HTTPClient
+	}{
+		{"client", srv.Client()},
+		{"wrapped-client", webdav.HTTPClientWithBasicAuth(srv.Client(), "user", "pass")},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var steps []webdav.DiscoveryStep
+			discovery, err := Discover(context.Background(), tc.client, "user@example.org", &webdav.DiscoveryOptions{
+				Resolver: resolver,
+				Trace: func(step *webdav.DiscoveryStep) {
+					step.Err = nil
+					steps = append(steps, *step)
+				},
+			})
+			if err != nil {
+				t.Fatalf("Discover() = %v, steps: %+v", err, steps)
+			}
+
+			if discovery.Principal != "/user/" {
+				t.Errorf("Discovery.Principal = %q, expected %q", discovery.Principal, "/user/")
+			}
+			if discovery.AddressBookHomeSet != "/user/contacts/" {
+				t.Errorf("Discovery.AddressBookHomeSet = %q, expected %q", discovery.AddressBookHomeSet, "/user/contacts/")
+			}
+
+			expected := []webdav.DiscoveryStep{
+				{Name: "srv", Target: "_carddavs._tcp.example.org", Result: u.Host},
+				{Name: "txt", Target: "_carddavs._tcp.example.org"},
+				{Name: "principal", Target: srv.URL + "/.well-known/carddav", Result: "redirected to " + srv.URL + "/user/"},
+				{Name: "principal", Target: srv.URL + "/user/", Result: "/user/"},
+				{Name: "home-set", Target: srv.URL + "/user/", Result: "/user/contacts/"},
+			}
+			if !reflect.DeepEqual(steps, expected) {
+				t.Errorf("got steps:\n%+v\nexpected:\n%+v", steps, expected)
+			}
+		})
+	}
+}
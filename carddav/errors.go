@@ -0,0 +1,34 @@
+package carddav
+
+import (
+	"encoding/xml"
+	"errors"
+	"net/http"
+
+	"github.com/emersion/go-webdav/internal"
+)
+
+// IsNotFound reports whether err is an HTTP 404 Not Found error.
+func IsNotFound(err error) bool {
+	return internal.IsNotFound(err)
+}
+
+// IsPreconditionFailed reports whether err is an HTTP 412 Precondition Failed
+// error, as returned when an If-Match or If-None-Match condition doesn't hold.
+func IsPreconditionFailed(err error) bool {
+	var httpErr *internal.HTTPError
+	return errors.As(err, &httpErr) && httpErr.Code == http.StatusPreconditionFailed
+}
+
+// HasPrecondition reports whether err carries the specified CARDDAV
+// precondition element.
+func HasPrecondition(err error, precondition PreconditionType) bool {
+	return internal.HasCondition(err, xml.Name{Space: namespace, Local: string(precondition)})
+}
+
+// IsUIDConflict reports whether err carries a CARDDAV:no-uid-conflict
+// precondition. The path of the conflicting resource, if provided by the
+// server, is available in the Href field of the *webdav.HTTPError.
+func IsUIDConflict(err error) bool {
+	return HasPrecondition(err, PreconditionNoUIDConflict)
+}
@@ -590,6 +590,74 @@ END:VCARD`)
 			addr: alice,
 			want: true,
 		},
+		{
+			name: "match-name-ascii-casemap",
+			query: &AddressBookQuery{
+				PropFilters: []PropFilter{
+					{
+						Name: vcard.FieldFormattedName,
+						TextMatches: []TextMatch{{
+							Text:      "alice",
+							MatchType: MatchStartsWith,
+							Collation: "",
+						}},
+					},
+				},
+			},
+			addr: alice,
+			want: true,
+		},
+		{
+			name: "match-name-octet",
+			query: &AddressBookQuery{
+				PropFilters: []PropFilter{
+					{
+						Name: vcard.FieldFormattedName,
+						TextMatches: []TextMatch{{
+							Text:      "alice",
+							MatchType: MatchStartsWith,
+							Collation: "i;octet",
+						}},
+					},
+				},
+			},
+			addr: alice,
+			want: false,
+		},
+		{
+			name: "match-name-unicode-casemap",
+			query: &AddressBookQuery{
+				PropFilters: []PropFilter{
+					{
+						Name: vcard.FieldFormattedName,
+						TextMatches: []TextMatch{{
+							Text:      "GOPHER",
+							MatchType: MatchEndsWith,
+							Collation: "i;unicode-casemap",
+						}},
+					},
+				},
+			},
+			addr: alice,
+			want: true,
+		},
+		{
+			name: "invalid-collation",
+			query: &AddressBookQuery{
+				PropFilters: []PropFilter{
+					{
+						Name: vcard.FieldFormattedName,
+						TextMatches: []TextMatch{{
+							Text:      "alice",
+							MatchType: MatchContains,
+							Collation: "i;basic",
+						}},
+					},
+				},
+			},
+			addr: alice,
+			err:  fmt.Errorf("webdav: unsupported collation \"i;basic\""),
+		},
 		{
 			name: "invalid-query-filter",
 			query: &AddressBookQuery{
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"mime"
 	"net/http"
@@ -25,6 +26,18 @@ type PutAddressObjectOptions struct {
 	IfMatch webdav.ConditionalMatch
 }
 
+// PutAddressObjectResult is returned by Backend.PutAddressObject.
+type PutAddressObjectResult struct {
+	AddressObject
+	// Created is true if the address object didn't exist before.
+	Created bool
+	// Modified is true if the backend altered the address object before storing
+	// it, for instance to normalize it. The ETag isn't returned to the client
+	// in that case, so that it fetches the stored version. The handler already
+	// withholds the ETag if the request body isn't in canonical encoding.
+	Modified bool
+}
+
 // Backend is a CardDAV server backend.
 type Backend interface {
 	AddressBookHomeSetPath(ctx context.Context) (string, error)
@@ -35,12 +48,31 @@ type Backend interface {
 	GetAddressObject(ctx context.Context, path string, req *AddressDataRequest) (*AddressObject, error)
 	ListAddressObjects(ctx context.Context, path string, req *AddressDataRequest) ([]AddressObject, error)
 	QueryAddressObjects(ctx context.Context, path string, query *AddressBookQuery) ([]AddressObject, error)
-	PutAddressObject(ctx context.Context, path string, card vcard.Card, opts *PutAddressObjectOptions) (*AddressObject, error)
+	PutAddressObject(ctx context.Context, path string, card vcard.Card, opts *PutAddressObjectOptions) (*PutAddressObjectResult, error)
 	DeleteAddressObject(ctx context.Context, path string) error
 
 	webdav.UserPrincipalBackend
 }
 
+// SyncBackend is an optional interface which can be implemented by a Backend
+// to support collection synchronization, as defined in RFC 6578.
+//
+// If the sync token is invalid or too old, SyncAddressObjects should return
+// an error created with NewInvalidSyncTokenError. Address books should
+// populate their SyncToken field.
+type SyncBackend interface {
+	SyncAddressObjects(ctx context.Context, path string, query *SyncQuery) (*SyncResponse, error)
+}
+
+// UpdateBackend is an optional interface which can be implemented by a
+// Backend to allow clients to update address book properties with PROPPATCH.
+//
+// UpdateAddressBook is called with the address book returned by
+// GetAddressBook, with the requested changes applied.
+type UpdateBackend interface {
+	UpdateAddressBook(ctx context.Context, addressBook *AddressBook) error
+}
+
 // Handler handles CardDAV HTTP requests. It can be used to create a CardDAV
 // server.
 type Handler struct {
@@ -94,8 +126,10 @@ func (h *Handler) handleReport(w http.ResponseWriter, r *http.Request) error {
 		return h.handleQuery(r, w, report.Query)
 	} else if report.Multiget != nil {
 		return h.handleMultiget(r.Context(), w, report.Multiget)
+	} else if report.SyncCollection != nil {
+		return h.handleSyncCollection(r, w, report.SyncCollection)
 	}
-	return internal.HTTPErrorf(http.StatusBadRequest, "carddav: expected addressbook-query or addressbook-multiget element in REPORT request")
+	return internal.HTTPErrorf(http.StatusBadRequest, "carddav: expected addressbook-query, addressbook-multiget or sync-collection element in REPORT request")
 }
 
 func decodePropFilter(el *propFilter) (*PropFilter, error) {
@@ -107,7 +141,11 @@ func decodePropFilter(el *propFilter) (*PropFilter, error) {
 		pf.IsNotDefined = true
 	}
 	for _, tm := range el.TextMatches {
-		pf.TextMatches = append(pf.TextMatches, *decodeTextMatch(&tm))
+		textMatch, err := decodeTextMatch(&tm)
+		if err != nil {
+			return nil, err
+		}
+		pf.TextMatches = append(pf.TextMatches, *textMatch)
 	}
 	for _, paramEl := range el.Params {
 		param, err := decodeParamFilter(&paramEl)
@@ -128,17 +166,25 @@ func decodeParamFilter(el *paramFilter) (*ParamFilter, error) {
 		pf.IsNotDefined = true
 	}
 	if el.TextMatch != nil {
-		pf.TextMatch = decodeTextMatch(el.TextMatch)
+		textMatch, err := decodeTextMatch(el.TextMatch)
+		if err != nil {
+			return nil, err
+		}
+		pf.TextMatch = textMatch
 	}
 	return pf, nil
 }
 
-func decodeTextMatch(tm *textMatch) *TextMatch {
+func decodeTextMatch(tm *textMatch) (*TextMatch, error) {
+	if !internal.IsSupportedCollation(tm.Collation) {
+		return nil, NewPreconditionError(PreconditionSupportedCollation)
+	}
 	return &TextMatch{
 		Text:            tm.Text,
 		NegateCondition: bool(tm.NegateCondition),
 		MatchType:       MatchType(tm.MatchType),
-	}
+		Collation:       tm.Collation,
+	}, nil
 }
 
 func decodeAddressDataReq(addressData *addressDataReq) (*AddressDataRequest, error) {
@@ -169,7 +215,9 @@ func (h *Handler) handleQuery(r *http.Request, w http.ResponseWriter, query *add
 	q.FilterTest = FilterTest(query.Filter.Test)
 	for _, el := range query.Filter.Props {
 		pf, err := decodePropFilter(&el)
-		if err != nil {
+		if _, ok := err.(*internal.HTTPError); ok {
+			return err
+		} else if err != nil {
 			return &internal.HTTPError{Code: http.StatusBadRequest, Err: err}
 		}
 		q.PropFilters = append(q.PropFilters, *pf)
@@ -251,6 +299,55 @@ func (h *Handler) handleMultiget(ctx context.Context, w http.ResponseWriter, mul
 	return internal.ServeMultiStatus(w, ms)
 }
 
+func (h *Handler) handleSyncCollection(r *http.Request, w http.ResponseWriter, sync *internal.SyncCollectionQuery) error {
+	syncBackend, ok := h.Backend.(SyncBackend)
+	if !ok {
+		return internal.NewConditionError(http.StatusForbidden, internal.SupportedReportName)
+	}
+
+	limit, err := internal.ParseSyncCollection(sync)
+	if err != nil {
+		return err
+	}
+
+	q := SyncQuery{SyncToken: sync.SyncToken, Limit: limit}
+	if sync.Prop != nil {
+		var addressData addressDataReq
+		if err := sync.Prop.Decode(&addressData); err != nil && !internal.IsNotFound(err) {
+			return err
+		} else if err == nil {
+			decoded, err := decodeAddressDataReq(&addressData)
+			if err != nil {
+				return err
+			}
+			q.DataRequest = *decoded
+		}
+	}
+
+	sr, err := syncBackend.SyncAddressObjects(r.Context(), r.URL.Path, &q)
+	if err != nil {
+		return err
+	}
+
+	b := backend{
+		Backend: h.Backend,
+		Prefix:  strings.TrimSuffix(h.Prefix, "/"),
+	}
+	propfind := internal.PropFind{Prop: sync.Prop}
+
+	var resps []internal.Response
+	for _, ao := range sr.Updated {
+		resp, err := b.propFindAddressObject(r.Context(), &propfind, &ao)
+		if err != nil {
+			return err
+		}
+		resps = append(resps, *resp)
+	}
+
+	ms := internal.NewSyncCollectionMultiStatus(r.URL.Path, sr.SyncToken, resps, sr.Deleted, sr.Truncated)
+	return internal.ServeMultiStatus(w, ms)
+}
+
 type backend struct {
 	Backend Backend
 	Prefix  string
@@ -302,6 +399,8 @@ func (b *backend) Options(r *http.Request) (caps []string, allow []string, err e
 		http.MethodPut,
 		http.MethodDelete,
 		"PROPFIND",
+		"COPY",
+		"MOVE",
 	}, nil
 }
 
@@ -499,13 +598,19 @@ func (b *backend) propFindAddressBook(ctx context.Context, propfind *internal.Pr
 		internal.ResourceTypeName: func(*internal.RawXMLValue) (interface{}, error) {
 			return internal.NewResourceType(internal.CollectionName, addressBookName), nil
 		},
+		internal.SupportedReportSetName: func(*internal.RawXMLValue) (interface{}, error) {
+			reports := []xml.Name{addressBookQueryName, addressBookMultigetName}
+			if _, ok := b.Backend.(SyncBackend); ok {
+				reports = append(reports, internal.SyncCollectionName)
+			}
+			return internal.NewSupportedReportSet(reports...), nil
+		},
 		supportedAddressDataName: func(*internal.RawXMLValue) (interface{}, error) {
-			return &supportedAddressData{
-				Types: []addressDataType{
-					{ContentType: vcard.MIMEType, Version: "3.0"},
-					{ContentType: vcard.MIMEType, Version: "4.0"},
-				},
-			}, nil
+			var types []addressDataType
+			for _, t := range ab.supportedAddressData() {
+				types = append(types, addressDataType{ContentType: t.ContentType, Version: t.Version})
+			}
+			return &supportedAddressData{Types: types}, nil
 		},
 	}
 
@@ -524,6 +629,23 @@ func (b *backend) propFindAddressBook(ctx context.Context, propfind *internal.Pr
 			return &maxResourceSize{Size: ab.MaxResourceSize}, nil
 		}
 	}
+	for _, prop := range ab.DeadProps {
+		var raw internal.RawXMLValue
+		if err := xml.Unmarshal(prop.Raw, &raw); err != nil {
+			return nil, err
+		}
+		props[prop.XMLName] = func(*internal.RawXMLValue) (interface{}, error) {
+			return &raw, nil
+		}
+	}
+	if ab.SyncToken != "" {
+		props[internal.SyncTokenName] = func(*internal.RawXMLValue) (interface{}, error) {
+			return &internal.SyncToken{Token: ab.SyncToken}, nil
+		}
+		props[internal.GetCTagName] = func(*internal.RawXMLValue) (interface{}, error) {
+			return &internal.GetCTag{CTag: ab.SyncToken}, nil
+		}
+	}
 
 	return internal.NewPropFindResponse(ab.Path, propfind, props)
 }
@@ -614,43 +736,58 @@ func (b *backend) propFindAllAddressObjects(ctx context.Context, propfind *inter
 }
 
 func (b *backend) PropPatch(r *http.Request, update *internal.PropertyUpdate) (*internal.Response, error) {
-	homeSetPath, err := b.Backend.AddressBookHomeSetPath(r.Context())
+	updateBackend, ok := b.Backend.(UpdateBackend)
+	if !ok || b.resourceTypeAtPath(r.URL.Path) != resourceTypeAddressBook {
+		forbidden := func(*internal.RawXMLValue, bool) error {
+			return internal.HTTPErrorf(http.StatusForbidden, "carddav: properties can't be updated on this resource")
+		}
+		return internal.NewPropPatchResponse(r.URL.Path, update, forbidden, nil)
+	}
+
+	ab, err := b.Backend.GetAddressBook(r.Context(), r.URL.Path)
 	if err != nil {
 		return nil, err
 	}
+	// The backend may return a pointer to its own data
+	updated := *ab
 
-	resp := internal.NewOKResponse(r.URL.Path)
+	patch := func(raw *internal.RawXMLValue, remove bool) error {
+		return patchAddressBookProp(&updated, raw, remove)
+	}
+	commit := func() error {
+		return updateBackend.UpdateAddressBook(r.Context(), &updated)
+	}
+	return internal.NewPropPatchResponse(r.URL.Path, update, patch, commit)
+}
 
-	if r.URL.Path == homeSetPath {
-		// TODO: support PROPPATCH for address books
-		for _, prop := range update.Remove {
-			emptyVal := internal.NewRawXMLElement(prop.Prop.XMLName, nil, nil)
-			if err := resp.EncodeProp(http.StatusNotImplemented, emptyVal); err != nil {
-				return nil, err
-			}
-		}
-		for _, prop := range update.Set {
-			emptyVal := internal.NewRawXMLElement(prop.Prop.XMLName, nil, nil)
-			if err := resp.EncodeProp(http.StatusNotImplemented, emptyVal); err != nil {
-				return nil, err
+// patchAddressBookProp sets or removes an address book property which can be
+// modified after the address book has been created.
+func patchAddressBookProp(ab *AddressBook, raw *internal.RawXMLValue, remove bool) error {
+	name, _ := raw.XMLName()
+	switch name {
+	case internal.DisplayNameName:
+		var dn internal.DisplayName
+		if !remove {
+			if err := raw.Decode(&dn); err != nil {
+				return err
 			}
 		}
-	} else {
-		for _, prop := range update.Remove {
-			emptyVal := internal.NewRawXMLElement(prop.Prop.XMLName, nil, nil)
-			if err := resp.EncodeProp(http.StatusMethodNotAllowed, emptyVal); err != nil {
-				return nil, err
+		ab.Name = dn.Name
+	case addressBookDescriptionName:
+		var desc addressbookDescription
+		if !remove {
+			if err := raw.Decode(&desc); err != nil {
+				return err
 			}
 		}
-		for _, prop := range update.Set {
-			emptyVal := internal.NewRawXMLElement(prop.Prop.XMLName, nil, nil)
-			if err := resp.EncodeProp(http.StatusMethodNotAllowed, emptyVal); err != nil {
-				return nil, err
-			}
+		ab.Description = desc.Description
+	default:
+		if name.Space == internal.Namespace || name.Space == namespace {
+			return internal.HTTPErrorf(http.StatusForbidden, "carddav: property %q %q is protected", name.Space, name.Local)
 		}
+		return internal.PatchDeadProp(&ab.DeadProps, raw, remove)
 	}
-
-	return resp, nil
+	return nil
 }
 
 func (b *backend) Put(w http.ResponseWriter, r *http.Request) error {
@@ -662,39 +799,77 @@ func (b *backend) Put(w http.ResponseWriter, r *http.Request) error {
 		IfMatch:     ifMatch,
 	}
 
-	t, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if b.resourceTypeAtPath(r.URL.Path) != resourceTypeAddressObject {
+		return internal.HTTPErrorf(http.StatusForbidden, "carddav: address objects can only be created inside an address book")
+	}
+	abPath := path.Dir(path.Clean(r.URL.Path)) + "/"
+	ab, err := b.Backend.GetAddressBook(r.Context(), abPath)
+	if internal.IsNotFound(err) {
+		return internal.HTTPErrorf(http.StatusConflict, "carddav: address book %q doesn't exist", abPath)
+	} else if err != nil {
+		return err
+	}
+
+	t, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
 	if err != nil {
 		return internal.HTTPErrorf(http.StatusBadRequest, "carddav: malformed Content-Type: %v", err)
 	}
 	if t != vcard.MIMEType {
-		// TODO: send CARDDAV:supported-address-data error
-		return internal.HTTPErrorf(http.StatusBadRequest, "carddav: unsupporetd Content-Type %q", t)
+		return NewPreconditionError(PreconditionSupportedAddressData)
+	}
+	if v, ok := params["version"]; ok && !ab.SupportsAddressData(t, v) {
+		return NewPreconditionError(PreconditionSupportedAddressData)
+	}
+
+	data, err := internal.ReadRequestBody(r, ab.MaxResourceSize)
+	if err == internal.ErrBodyTooLarge {
+		return NewPreconditionError(PreconditionMaxResourceSize)
+	} else if err != nil {
+		return err
 	}
 
-	// TODO: check CARDDAV:max-resource-size precondition
-	card, err := vcard.NewDecoder(r.Body).Decode()
+	card, err := vcard.NewDecoder(bytes.NewReader(data)).Decode()
 	if err != nil {
-		// TODO: send CARDDAV:valid-address-data error
-		return internal.HTTPErrorf(http.StatusBadRequest, "carddav: failed to parse vCard: %v", err)
+		return NewPreconditionError(PreconditionValidAddressData)
 	}
+	// Backends store the parsed card, which is encoded in canonical form
+	var canonical bytes.Buffer
+	modified := vcard.NewEncoder(&canonical).Encode(card) != nil || !bytes.Equal(canonical.Bytes(), data)
 
-	// TODO: add support for the CARDDAV:no-uid-conflict error
-	ao, err := b.Backend.PutAddressObject(r.Context(), r.URL.Path, card, &opts)
+	uid, err := ValidateAddressObject(card)
 	if err != nil {
+		return NewPreconditionError(PreconditionValidAddressData)
+	}
+	if !ab.SupportsAddressData(t, card.Value(vcard.FieldVersion)) {
+		return NewPreconditionError(PreconditionSupportedAddressData)
+	}
+	if err := b.checkUIDConflict(r.Context(), abPath, uid, r.URL.Path); err != nil {
 		return err
 	}
-	if ao.ETag != "" {
-		w.Header().Set("ETag", internal.ETag(ao.ETag).String())
+
+	res, err := b.Backend.PutAddressObject(r.Context(), r.URL.Path, card, &opts)
+	if err != nil {
+		return err
 	}
-	if !ao.ModTime.IsZero() {
-		w.Header().Set("Last-Modified", ao.ModTime.UTC().Format(http.TimeFormat))
+	// RFC 7231 section 4.3.4: the ETag must not be returned if the stored
+	// card isn't the one sent by the client. Backends only get the parsed
+	// card, so they can't tell whether the request body was encoded
+	// differently.
+	if res.ETag != "" && !res.Modified && !modified {
+		w.Header().Set("ETag", internal.ETag(res.ETag).String())
 	}
-	if ao.Path != "" {
-		w.Header().Set("Location", ao.Path)
+	if !res.ModTime.IsZero() {
+		w.Header().Set("Last-Modified", res.ModTime.UTC().Format(http.TimeFormat))
+	}
+	if res.Path != "" {
+		w.Header().Set("Location", res.Path)
 	}
 
-	// TODO: http.StatusNoContent if the resource already existed
-	w.WriteHeader(http.StatusCreated)
+	if res.Created {
+		w.WriteHeader(http.StatusCreated)
+	} else {
+		w.WriteHeader(http.StatusNoContent)
+	}
 
 	return nil
 }
@@ -735,12 +910,178 @@ func (b *backend) Mkcol(r *http.Request) error {
 	return b.Backend.CreateAddressBook(r.Context(), &ab)
 }
 
+// checkCopyMove checks that an address object can be copied or moved from the
+// request URI to dest, and returns the source object. created is true if dest
+// doesn't exist yet.
+func (b *backend) checkCopyMove(r *http.Request, dest string, overwrite, move bool) (ao *AddressObject, created bool, err error) {
+	ctx := r.Context()
+	src := r.URL.Path
+	if b.resourceTypeAtPath(src) != resourceTypeAddressObject {
+		return nil, false, internal.HTTPErrorf(http.StatusForbidden, "carddav: only address objects can be copied or moved")
+	}
+	if b.resourceTypeAtPath(dest) != resourceTypeAddressObject {
+		return nil, false, internal.HTTPErrorf(http.StatusForbidden, "carddav: destination must be an address object")
+	}
+	if path.Clean(src) == path.Clean(dest) {
+		return nil, false, internal.HTTPErrorf(http.StatusForbidden, "carddav: source and destination are the same")
+	}
+
+	ao, err = b.Backend.GetAddressObject(ctx, src, &AddressDataRequest{AllProp: true})
+	if err != nil {
+		return nil, false, err
+	}
+	if ifMatch := webdav.ConditionalMatch(r.Header.Get("If-Match")); ifMatch.IsSet() && !ifMatch.IsWildcard() {
+		etag, err := ifMatch.ETag()
+		if err != nil {
+			return nil, false, internal.HTTPErrorf(http.StatusBadRequest, "carddav: malformed If-Match header: %v", err)
+		}
+		if etag != ao.ETag {
+			return nil, false, internal.HTTPErrorf(http.StatusPreconditionFailed, "carddav: If-Match condition failed")
+		}
+	}
+
+	// The destination address book needs to accept the object, like for PUT
+	destPath := path.Dir(path.Clean(dest)) + "/"
+	ab, err := b.Backend.GetAddressBook(ctx, destPath)
+	if internal.IsNotFound(err) {
+		return nil, false, internal.HTTPErrorf(http.StatusConflict, "carddav: address book %q doesn't exist", destPath)
+	} else if err != nil {
+		return nil, false, err
+	}
+	if !ab.SupportsAddressData(vcard.MIMEType, ao.Card.Value(vcard.FieldVersion)) {
+		return nil, false, NewPreconditionError(PreconditionSupportedAddressData)
+	}
+	if ab.MaxResourceSize > 0 {
+		var buf bytes.Buffer
+		if err := vcard.NewEncoder(&buf).Encode(ao.Card); err != nil {
+			return nil, false, err
+		}
+		if int64(buf.Len()) > ab.MaxResourceSize {
+			return nil, false, NewPreconditionError(PreconditionMaxResourceSize)
+		}
+	}
+
+	_, err = b.Backend.GetAddressObject(ctx, dest, &AddressDataRequest{})
+	if internal.IsNotFound(err) {
+		created = true
+	} else if err != nil {
+		return nil, false, err
+	} else if !overwrite {
+		return nil, false, internal.HTTPErrorf(http.StatusPreconditionFailed, "carddav: destination %q already exists", dest)
+	}
+
+	// The object being overwritten and the object being moved don't count
+	// as conflicts
+	ignore := []string{dest}
+	if move {
+		ignore = append(ignore, src)
+	}
+	if uid := ao.Card.Value(vcard.FieldUID); uid != "" {
+		err := b.checkUIDConflict(ctx, destPath, uid, ignore...)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	return ao, created, nil
+}
+
+// checkUIDConflict returns a CARDDAV:no-uid-conflict error if an address
+// object other than the ones in ignore has the specified UID in an address
+// book.
+func (b *backend) checkUIDConflict(ctx context.Context, abPath, uid string, ignore ...string) error {
+	l, err := b.Backend.QueryAddressObjects(ctx, abPath, &AddressBookQuery{
+		DataRequest: AddressDataRequest{Props: []string{vcard.FieldUID}},
+		PropFilters: []PropFilter{{
+			Name: vcard.FieldUID,
+			TextMatches: []TextMatch{{
+				Text:      uid,
+				MatchType: MatchEquals,
+				// UIDs are case-sensitive
+				Collation: internal.CollationOctet,
+			}},
+		}},
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, ao := range l {
+		ignored := false
+		for _, p := range ignore {
+			if path.Clean(ao.Path) == path.Clean(p) {
+				ignored = true
+				break
+			}
+		}
+		if !ignored {
+			return NewUIDConflictError(ao.Path)
+		}
+	}
+	return nil
+}
+
+// isUIDConflictWith reports whether err is a CARDDAV:no-uid-conflict error
+// caused by the address object at href.
+func isUIDConflictWith(err error, href string) bool {
+	var httpErr *internal.HTTPError
+	if !IsUIDConflict(err) || !errors.As(err, &httpErr) {
+		return false
+	}
+	return httpErr.Href != "" && path.Clean(httpErr.Href) == path.Clean(href)
+}
+
+// putCopy stores a copy of an address object at dest. If overwrite is false,
+// the backend is asked not to replace an object created concurrently.
+func (b *backend) putCopy(ctx context.Context, dest string, ao *AddressObject, overwrite bool) error {
+	var opts PutAddressObjectOptions
+	if !overwrite {
+		opts.IfNoneMatch = "*"
+	}
+	_, err := b.Backend.PutAddressObject(ctx, dest, ao.Card, &opts)
+	return err
+}
+
 func (b *backend) Copy(r *http.Request, dest *internal.Href, recursive, overwrite bool) (created bool, err error) {
-	return false, internal.HTTPErrorf(http.StatusNotImplemented, "carddav: Copy not implemented")
+	ao, created, err := b.checkCopyMove(r, dest.Path, overwrite, false)
+	if err != nil {
+		return false, err
+	}
+	if err := b.putCopy(r.Context(), dest.Path, ao, overwrite); err != nil {
+		return false, err
+	}
+	return created, nil
 }
 
 func (b *backend) Move(r *http.Request, dest *internal.Href, overwrite bool) (created bool, err error) {
-	return false, internal.HTTPErrorf(http.StatusNotImplemented, "carddav: Move not implemented")
+	ctx := r.Context()
+	ao, created, err := b.checkCopyMove(r, dest.Path, overwrite, true)
+	if err != nil {
+		return false, err
+	}
+
+	// The destination is stored first, so that the source object is left
+	// untouched on failure
+	err = b.putCopy(ctx, dest.Path, ao, overwrite)
+	if err == nil {
+		return created, b.Backend.DeleteAddressObject(ctx, r.URL.Path)
+	} else if !isUIDConflictWith(err, r.URL.Path) {
+		return false, err
+	}
+
+	// Within an address book, backends enforcing UID uniqueness report a
+	// conflict with the source object, which needs to be removed first
+	if err := b.Backend.DeleteAddressObject(ctx, r.URL.Path); err != nil {
+		return false, err
+	}
+	if err := b.putCopy(ctx, dest.Path, ao, overwrite); err != nil {
+		_, restoreErr := b.Backend.PutAddressObject(ctx, r.URL.Path, ao.Card, &PutAddressObjectOptions{IfNoneMatch: "*"})
+		if restoreErr != nil {
+			return false, fmt.Errorf("carddav: failed to move address object (%v) and to restore the source object: %v", err, restoreErr)
+		}
+		return false, err
+	}
+	return created, nil
 }
 
 // PreconditionType as defined in https://tools.ietf.org/rfcmarkup?doc=6352#section-6.3.2.1
@@ -751,15 +1092,30 @@ const (
 	PreconditionSupportedAddressData PreconditionType = "supported-address-data"
 	PreconditionValidAddressData     PreconditionType = "valid-address-data"
 	PreconditionMaxResourceSize      PreconditionType = "max-resource-size"
+	PreconditionSupportedCollation   PreconditionType = "supported-collation"
 )
 
+// NewInvalidSyncTokenError returns an error indicating that the sync token
+// passed to SyncBackend.SyncAddressObjects is invalid or has expired.
+func NewInvalidSyncTokenError() error {
+	return internal.NewConditionError(http.StatusForbidden, internal.ValidSyncTokenName)
+}
+
 func NewPreconditionError(err PreconditionType) error {
 	name := xml.Name{Space: "urn:ietf:params:xml:ns:carddav", Local: string(err)}
 	elem := internal.NewRawXMLElement(name, nil, nil)
 	return &internal.HTTPError{
-		Code: 409,
+		Code:       409,
+		Conditions: []xml.Name{name},
 		Err: &internal.Error{
 			Raw: []internal.RawXMLValue{*elem},
 		},
 	}
 }
+
+// NewUIDConflictError returns a CARDDAV:no-uid-conflict precondition error
+// referencing the address object resource which already uses the UID.
+func NewUIDConflictError(href string) error {
+	name := xml.Name{Space: namespace, Local: string(PreconditionNoUIDConflict)}
+	return internal.NewHrefConditionError(http.StatusConflict, name, href)
+}
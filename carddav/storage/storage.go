@@ -0,0 +1,360 @@
+// Package storage provides a CardDAV backend storing address books on the
+// local filesystem.
+//
+// Each address book is stored in its own directory, with its metadata in a
+// JSON sidecar file. Each address object is stored in its own vCard file.
+// Changes are recorded in a per-address book change log to support
+// collection synchronization.
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/emersion/go-vcard"
+	"github.com/emersion/go-webdav"
+	"github.com/emersion/go-webdav/carddav"
+	"github.com/emersion/go-webdav/internal/filestore"
+)
+
+// metadataFilename is the name of the JSON sidecar file holding address book
+// metadata. Since it starts with a dot, it can't clash with object names.
+const metadataFilename = ".addressbook.json"
+
+// addressBookMetadata is the JSON representation of an address book's
+// metadata.
+type addressBookMetadata struct {
+	Name                 string                   `json:"name,omitempty"`
+	Description          string                   `json:"description,omitempty"`
+	MaxResourceSize      int64                    `json:"max_resource_size,omitempty"`
+	SupportedAddressData []addressDataType        `json:"supported_address_data,omitempty"`
+	DeadProps            []filestore.DeadProperty `json:"dead_props,omitempty"`
+}
+
+type addressDataType struct {
+	ContentType string `json:"content_type"`
+	Version     string `json:"version"`
+}
+
+// Backend is a carddav.Backend storing address books in a local directory.
+type Backend struct {
+	store         *filestore.Store
+	principalPath string
+
+	mu sync.RWMutex
+}
+
+var (
+	_ carddav.Backend       = (*Backend)(nil)
+	_ carddav.UpdateBackend = (*Backend)(nil)
+)
+
+// New creates a new backend storing address books in dir. The directory is
+// created if it doesn't exist.
+//
+// principalPath is the path of the current user principal and homeSetPath
+// the path of the address book home set, e.g. "/user/" and
+// "/user/contacts/". Address books are exposed as direct children of the
+// home set.
+func New(dir, principalPath, homeSetPath string) (*Backend, error) {
+	if !strings.HasPrefix(homeSetPath, "/") || !strings.HasPrefix(principalPath, "/") {
+		return nil, fmt.Errorf("storage: principal and home set paths must be absolute")
+	}
+	store, err := filestore.New(dir, homeSetPath, metadataFilename, parseUID)
+	if err != nil {
+		return nil, err
+	}
+	return &Backend{store: store, principalPath: principalPath}, nil
+}
+
+// parseUID returns the UID of a stored address object.
+func parseUID(data []byte) (string, error) {
+	card, err := vcard.NewDecoder(bytes.NewReader(data)).Decode()
+	if err != nil {
+		return "", err
+	}
+	uid := card.Value(vcard.FieldUID)
+	if uid == "" {
+		return "", fmt.Errorf("storage: missing UID")
+	}
+	return uid, nil
+}
+
+// addressBookName returns the name of the address book at the specified
+// path.
+func (b *Backend) addressBookName(p string) (string, error) {
+	abName, objName, err := b.store.SplitPath(p)
+	if err != nil {
+		return "", err
+	}
+	if objName != "" {
+		return "", webdav.NewHTTPError(http.StatusNotFound, fmt.Errorf("storage: %q is not an address book", p))
+	}
+	return abName, nil
+}
+
+func (b *Backend) AddressBookHomeSetPath(ctx context.Context) (string, error) {
+	return b.store.HomeSetPath(), nil
+}
+
+func (b *Backend) CurrentUserPrincipal(ctx context.Context) (string, error) {
+	return b.principalPath, nil
+}
+
+func (b *Backend) readAddressBook(abName string) (*carddav.AddressBook, error) {
+	var meta addressBookMetadata
+	if err := b.store.ReadMetadata(abName, &meta); err != nil {
+		return nil, err
+	}
+
+	syncToken, err := b.store.SyncToken(abName)
+	if err != nil {
+		return nil, err
+	}
+
+	ab := &carddav.AddressBook{
+		Path:            b.store.CollectionPath(abName),
+		Name:            meta.Name,
+		Description:     meta.Description,
+		MaxResourceSize: meta.MaxResourceSize,
+		SyncToken:       syncToken,
+		DeadProps:       filestore.DecodeDeadProps(meta.DeadProps),
+	}
+	for _, t := range meta.SupportedAddressData {
+		ab.SupportedAddressData = append(ab.SupportedAddressData, carddav.AddressDataType{
+			ContentType: t.ContentType,
+			Version:     t.Version,
+		})
+	}
+	return ab, nil
+}
+
+func newAddressBookMetadata(ab *carddav.AddressBook) *addressBookMetadata {
+	meta := &addressBookMetadata{
+		Name:            ab.Name,
+		Description:     ab.Description,
+		MaxResourceSize: ab.MaxResourceSize,
+		DeadProps:       filestore.EncodeDeadProps(ab.DeadProps),
+	}
+	for _, t := range ab.SupportedAddressData {
+		meta.SupportedAddressData = append(meta.SupportedAddressData, addressDataType{
+			ContentType: t.ContentType,
+			Version:     t.Version,
+		})
+	}
+	return meta
+}
+
+func (b *Backend) CreateAddressBook(ctx context.Context, addressBook *carddav.AddressBook) error {
+	abName, err := b.addressBookName(addressBook.Path)
+	if err != nil {
+		return webdav.NewHTTPError(http.StatusForbidden, err)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.store.CreateCollection(abName, newAddressBookMetadata(addressBook))
+}
+
+func (b *Backend) UpdateAddressBook(ctx context.Context, addressBook *carddav.AddressBook) error {
+	abName, err := b.addressBookName(addressBook.Path)
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, err := b.readAddressBook(abName); err != nil {
+		return err
+	}
+	return b.store.WriteMetadata(abName, newAddressBookMetadata(addressBook))
+}
+
+func (b *Backend) DeleteAddressBook(ctx context.Context, path string) error {
+	abName, err := b.addressBookName(path)
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, err := b.readAddressBook(abName); err != nil {
+		return err
+	}
+	return b.store.DeleteCollection(abName)
+}
+
+func (b *Backend) ListAddressBooks(ctx context.Context) ([]carddav.AddressBook, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	names, err := b.store.ListCollections()
+	if err != nil {
+		return nil, err
+	}
+
+	var l []carddav.AddressBook
+	for _, name := range names {
+		ab, err := b.readAddressBook(name)
+		if carddav.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		l = append(l, *ab)
+	}
+	return l, nil
+}
+
+func (b *Backend) GetAddressBook(ctx context.Context, path string) (*carddav.AddressBook, error) {
+	abName, err := b.addressBookName(path)
+	if err != nil {
+		return nil, err
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.readAddressBook(abName)
+}
+
+// newAddressObject parses an address object read from disk.
+func (b *Backend) newAddressObject(abName string, obj *filestore.Object) (*carddav.AddressObject, error) {
+	card, err := vcard.NewDecoder(bytes.NewReader(obj.Data)).Decode()
+	if err != nil {
+		return nil, fmt.Errorf("storage: failed to parse address object %q: %v", b.store.ObjectPath(abName, obj.Name), err)
+	}
+
+	return &carddav.AddressObject{
+		Path:          b.store.ObjectPath(abName, obj.Name),
+		ModTime:       obj.ModTime,
+		ContentLength: int64(len(obj.Data)),
+		ETag:          obj.ETag,
+		Card:          card,
+	}, nil
+}
+
+func (b *Backend) GetAddressObject(ctx context.Context, path string, req *carddav.AddressDataRequest) (*carddav.AddressObject, error) {
+	abName, objName, err := b.store.SplitPath(path)
+	if err != nil {
+		return nil, err
+	}
+	if objName == "" {
+		return nil, webdav.NewHTTPError(http.StatusNotFound, fmt.Errorf("storage: %q is not an address object", path))
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	obj, err := b.store.ReadObject(abName, objName)
+	if err != nil {
+		return nil, err
+	}
+	return b.newAddressObject(abName, obj)
+}
+
+func (b *Backend) ListAddressObjects(ctx context.Context, path string, req *carddav.AddressDataRequest) ([]carddav.AddressObject, error) {
+	abName, err := b.addressBookName(path)
+	if err != nil {
+		return nil, err
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if _, err := b.readAddressBook(abName); err != nil {
+		return nil, err
+	}
+	objs, err := b.store.ListObjects(abName)
+	if err != nil {
+		return nil, err
+	}
+
+	l := make([]carddav.AddressObject, 0, len(objs))
+	for i := range objs {
+		ao, err := b.newAddressObject(abName, &objs[i])
+		if err != nil {
+			return nil, err
+		}
+		l = append(l, *ao)
+	}
+	return l, nil
+}
+
+func (b *Backend) QueryAddressObjects(ctx context.Context, path string, query *carddav.AddressBookQuery) ([]carddav.AddressObject, error) {
+	l, err := b.ListAddressObjects(ctx, path, &query.DataRequest)
+	if err != nil {
+		return nil, err
+	}
+	return carddav.Filter(query, l)
+}
+
+func (b *Backend) PutAddressObject(ctx context.Context, path string, card vcard.Card, opts *carddav.PutAddressObjectOptions) (*carddav.PutAddressObjectResult, error) {
+	abName, objName, err := b.store.SplitPath(path)
+	if err != nil {
+		return nil, err
+	}
+	if objName == "" {
+		return nil, webdav.NewHTTPError(http.StatusMethodNotAllowed, fmt.Errorf("storage: %q is not an address object", path))
+	}
+	if opts == nil {
+		opts = new(carddav.PutAddressObjectOptions)
+	}
+
+	uid := card.Value(vcard.FieldUID)
+	if uid == "" {
+		return nil, carddav.NewPreconditionError(carddav.PreconditionValidAddressData)
+	}
+
+	var buf bytes.Buffer
+	if err := vcard.NewEncoder(&buf).Encode(card); err != nil {
+		return nil, carddav.NewPreconditionError(carddav.PreconditionValidAddressData)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, err := b.readAddressBook(abName); err != nil {
+		if carddav.IsNotFound(err) {
+			return nil, webdav.NewHTTPError(http.StatusConflict, fmt.Errorf("storage: address book %q doesn't exist", abName))
+		}
+		return nil, err
+	}
+
+	obj, created, err := b.store.PutObject(abName, objName, buf.Bytes(), uid, opts.IfMatch, opts.IfNoneMatch)
+	var conflict *filestore.UIDConflictError
+	if errors.As(err, &conflict) {
+		return nil, carddav.NewUIDConflictError(b.store.ObjectPath(abName, conflict.Name))
+	} else if err != nil {
+		return nil, err
+	}
+
+	ao, err := b.newAddressObject(abName, obj)
+	if err != nil {
+		return nil, err
+	}
+	return &carddav.PutAddressObjectResult{AddressObject: *ao, Created: created}, nil
+}
+
+func (b *Backend) DeleteAddressObject(ctx context.Context, path string) error {
+	abName, objName, err := b.store.SplitPath(path)
+	if err != nil {
+		return err
+	}
+	if objName == "" {
+		return webdav.NewHTTPError(http.StatusMethodNotAllowed, fmt.Errorf("storage: %q is not an address object", path))
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.store.DeleteObject(abName, objName)
+}
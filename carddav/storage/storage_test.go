@@ -0,0 +1,474 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-vcard"
+	"github.com/emersion/go-webdav"
+	"github.com/emersion/go-webdav/carddav"
+)
+
+func newCard(uid, name string) vcard.Card {
+	card := make(vcard.Card)
+	card.SetValue(vcard.FieldVersion, "3.0")
+	card.SetValue(vcard.FieldUID, uid)
+	card.SetValue(vcard.FieldFormattedName, name)
+	return card
+}
+
+func newTestBackend(t *testing.T) *Backend {
+	t.Helper()
+	b, err := New(t.TempDir(), "/user/", "/user/contacts/")
+	if err != nil {
+		t.Fatalf("New() = %v", err)
+	}
+	err = b.CreateAddressBook(context.Background(), &carddav.AddressBook{
+		Path: "/user/contacts/default/",
+		Name: "Contacts",
+	})
+	if err != nil {
+		t.Fatalf("CreateAddressBook() = %v", err)
+	}
+	return b
+}
+
+func TestBackend_addressBooks(t *testing.T) {
+	ctx := context.Background()
+	b := newTestBackend(t)
+
+	err := b.CreateAddressBook(ctx, &carddav.AddressBook{Path: "/user/contacts/default/"})
+	if err == nil {
+		t.Errorf("CreateAddressBook() with an existing address book succeeded")
+	}
+
+	l, err := b.ListAddressBooks(ctx)
+	if err != nil {
+		t.Fatalf("ListAddressBooks() = %v", err)
+	}
+	if len(l) != 1 || l[0].Path != "/user/contacts/default/" || l[0].Name != "Contacts" {
+		t.Errorf("ListAddressBooks() = %+v", l)
+	}
+
+	if err := b.DeleteAddressBook(ctx, "/user/contacts/default/"); err != nil {
+		t.Fatalf("DeleteAddressBook() = %v", err)
+	}
+	if _, err := b.GetAddressBook(ctx, "/user/contacts/default/"); !carddav.IsNotFound(err) {
+		t.Errorf("GetAddressBook() after delete = %v, expected not found", err)
+	}
+}
+
+func TestBackend_objects(t *testing.T) {
+	ctx := context.Background()
+	b := newTestBackend(t)
+
+	ao, err := b.PutAddressObject(ctx, "/user/contacts/default/a.vcf", newCard("a", "Alice"), nil)
+	if err != nil {
+		t.Fatalf("PutAddressObject() = %v", err)
+	}
+	if _, err := b.PutAddressObject(ctx, "/user/contacts/default/b.vcf", newCard("b", "Bob"), nil); err != nil {
+		t.Fatalf("PutAddressObject() = %v", err)
+	}
+
+	got, err := b.GetAddressObject(ctx, ao.Path, nil)
+	if err != nil {
+		t.Fatalf("GetAddressObject() = %v", err)
+	}
+	if got.ETag != ao.ETag || got.Card.PreferredValue(vcard.FieldFormattedName) != "Alice" {
+		t.Errorf("GetAddressObject() = %+v", got)
+	}
+
+	_, err = b.PutAddressObject(ctx, "/user/contacts/default/c.vcf", newCard("a", "Alice"), nil)
+	var httpErr *webdav.HTTPError
+	if !carddav.IsUIDConflict(err) {
+		t.Errorf("PutAddressObject() with a duplicate UID = %v, expected a UID conflict", err)
+	} else if !errors.As(err, &httpErr) || httpErr.Href != ao.Path {
+		t.Errorf("PutAddressObject() with a duplicate UID = %v, expected a conflict with %q", err, ao.Path)
+	}
+
+	_, err = b.PutAddressObject(ctx, ao.Path, newCard("a", "Alice"), &carddav.PutAddressObjectOptions{IfNoneMatch: "*"})
+	if !carddav.IsPreconditionFailed(err) {
+		t.Errorf("PutAddressObject() with If-None-Match = %v, expected precondition failed", err)
+	}
+
+	_, err = b.PutAddressObject(ctx, ao.Path, newCard("a", "Alicia"), &carddav.PutAddressObjectOptions{IfMatch: webdav.ConditionalMatch(`"` + ao.ETag + `"`)})
+	if err != nil {
+		t.Errorf("PutAddressObject() with a matching If-Match = %v", err)
+	}
+
+	l, err := b.QueryAddressObjects(ctx, "/user/contacts/default/", &carddav.AddressBookQuery{
+		PropFilters: []carddav.PropFilter{{
+			Name:        vcard.FieldFormattedName,
+			TextMatches: []carddav.TextMatch{{Text: "Alicia"}},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("QueryAddressObjects() = %v", err)
+	}
+	if len(l) != 1 || l[0].Path != ao.Path {
+		t.Errorf("QueryAddressObjects() = %+v, expected %q only", l, ao.Path)
+	}
+
+	if err := b.DeleteAddressObject(ctx, ao.Path); err != nil {
+		t.Fatalf("DeleteAddressObject() = %v", err)
+	}
+	if _, err := b.GetAddressObject(ctx, ao.Path, nil); !carddav.IsNotFound(err) {
+		t.Errorf("GetAddressObject() after delete = %v, expected not found", err)
+	}
+}
+
+func TestBackend_sync(t *testing.T) {
+	ctx := context.Background()
+	b := newTestBackend(t)
+	const abPath = "/user/contacts/default/"
+
+	srv := httptest.NewServer(&carddav.Handler{Backend: b})
+	defer srv.Close()
+	c, err := carddav.NewClient(nil, srv.URL)
+	if err != nil {
+		t.Fatalf("NewClient() = %v", err)
+	}
+
+	for _, name := range []string{"a", "b"} {
+		if _, err := b.PutAddressObject(ctx, abPath+name+".vcf", newCard(name, name), nil); err != nil {
+			t.Fatalf("PutAddressObject() = %v", err)
+		}
+	}
+
+	resp, err := c.SyncCollection(ctx, abPath, &carddav.SyncQuery{})
+	if err != nil {
+		t.Fatalf("SyncCollection() = %v", err)
+	}
+	if len(resp.Updated) != 2 || len(resp.Deleted) != 0 || resp.Truncated {
+		t.Errorf("initial SyncCollection() = %+v, expected 2 updated objects", resp)
+	}
+
+	ab, err := b.GetAddressBook(ctx, abPath)
+	if err != nil {
+		t.Fatalf("GetAddressBook() = %v", err)
+	}
+	if ab.SyncToken != resp.SyncToken {
+		t.Errorf("GetAddressBook() sync token = %q, expected %q", ab.SyncToken, resp.SyncToken)
+	}
+
+	if err := b.DeleteAddressObject(ctx, abPath+"a.vcf"); err != nil {
+		t.Fatalf("DeleteAddressObject() = %v", err)
+	}
+	if _, err := b.PutAddressObject(ctx, abPath+"b.vcf", newCard("b", "Bob"), nil); err != nil {
+		t.Fatalf("PutAddressObject() = %v", err)
+	}
+
+	resp, err = c.SyncCollection(ctx, abPath, &carddav.SyncQuery{SyncToken: resp.SyncToken, Limit: 1})
+	if err != nil {
+		t.Fatalf("SyncCollection() = %v", err)
+	}
+	if !resp.Truncated || len(resp.Deleted) != 1 || resp.Deleted[0] != abPath+"a.vcf" {
+		t.Errorf("SyncCollection() = %+v, expected a truncated response with a.vcf deleted", resp)
+	}
+
+	resp, err = c.SyncCollection(ctx, abPath, &carddav.SyncQuery{SyncToken: resp.SyncToken})
+	if err != nil {
+		t.Fatalf("SyncCollection() = %v", err)
+	}
+	if resp.Truncated || len(resp.Updated) != 1 || resp.Updated[0].Path != abPath+"b.vcf" {
+		t.Errorf("SyncCollection() = %+v, expected b.vcf updated", resp)
+	}
+
+	_, err = c.SyncCollection(ctx, abPath, &carddav.SyncQuery{SyncToken: "urn:x-go-webdav:sync:invalid:1"})
+	if err == nil {
+		t.Errorf("SyncCollection() with an invalid token succeeded")
+	}
+}
+
+func TestBackend_propPatch(t *testing.T) {
+	ctx := context.Background()
+	b := newTestBackend(t)
+	const abPath = "/user/contacts/default/"
+
+	srv := httptest.NewServer(&carddav.Handler{Backend: b})
+	defer srv.Close()
+	c, err := webdav.NewClient(nil, srv.URL)
+	if err != nil {
+		t.Fatalf("NewClient() = %v", err)
+	}
+
+	descName := xml.Name{Space: "urn:ietf:params:xml:ns:carddav", Local: "addressbook-description"}
+	customName := xml.Name{Space: "http://example.org/ns", Local: "custom"}
+	set := []webdav.Property{
+		webdav.NewTextProperty(descName, "Friends and family"),
+		webdav.NewTextProperty(customName, "hello"),
+	}
+	resp, err := c.PropPatch(ctx, abPath, set, nil)
+	if err != nil {
+		t.Fatalf("PropPatch() = %v", err)
+	}
+	for name, prop := range resp.Props {
+		if err := prop.Err(); err != nil {
+			t.Errorf("PropPatch() property %v: %v", name, err)
+		}
+	}
+
+	ab, err := b.GetAddressBook(ctx, abPath)
+	if err != nil {
+		t.Fatalf("GetAddressBook() = %v", err)
+	}
+	if ab.Description != "Friends and family" || len(ab.DeadProps) != 1 || ab.DeadProps[0].XMLName != customName {
+		t.Errorf("GetAddressBook() = %+v after PropPatch()", ab)
+	}
+
+	// Address objects don't have writable properties
+	if _, err := b.PutAddressObject(ctx, abPath+"a.vcf", newCard("a", "Alice"), nil); err != nil {
+		t.Fatalf("PutAddressObject() = %v", err)
+	}
+	resp, err = c.PropPatch(ctx, abPath+"a.vcf", set, nil)
+	if err != nil {
+		t.Fatalf("PropPatch() = %v", err)
+	}
+	if prop := resp.Props[descName]; prop.Status != http.StatusForbidden {
+		t.Errorf("PropPatch() on an address object returned status %v, expected 403", prop.Status)
+	}
+}
+
+func TestBackend_copyMove(t *testing.T) {
+	ctx := context.Background()
+	b := newTestBackend(t)
+	err := b.CreateAddressBook(ctx, &carddav.AddressBook{Path: "/user/contacts/work/"})
+	if err != nil {
+		t.Fatalf("CreateAddressBook() = %v", err)
+	}
+
+	srv := httptest.NewServer(&carddav.Handler{Backend: b})
+	defer srv.Close()
+	c, err := webdav.NewClient(nil, srv.URL)
+	if err != nil {
+		t.Fatalf("NewClient() = %v", err)
+	}
+
+	for _, name := range []string{"a", "b"} {
+		if _, err := b.PutAddressObject(ctx, "/user/contacts/default/"+name+".vcf", newCard(name, name), nil); err != nil {
+			t.Fatalf("PutAddressObject() = %v", err)
+		}
+	}
+
+	err = c.Copy(ctx, "/user/contacts/default/a.vcf", "/user/contacts/default/c.vcf", nil)
+	if !carddav.HasPrecondition(err, carddav.PreconditionNoUIDConflict) {
+		t.Errorf("Copy() within an address book = %v, expected a UID conflict", err)
+	}
+
+	if err := c.Copy(ctx, "/user/contacts/default/a.vcf", "/user/contacts/work/a.vcf", nil); err != nil {
+		t.Fatalf("Copy() = %v", err)
+	}
+	err = c.Move(ctx, "/user/contacts/default/b.vcf", "/user/contacts/work/a.vcf", &webdav.MoveOptions{NoOverwrite: true})
+	if !carddav.IsPreconditionFailed(err) {
+		t.Errorf("Move() without overwrite = %v, expected precondition failed", err)
+	}
+
+	req, err := http.NewRequest("MOVE", srv.URL+"/user/contacts/default/b.vcf", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Destination", srv.URL+"/user/contacts/work/b.vcf")
+	req.Header.Set("If-Match", `"wrong"`)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("MOVE request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusPreconditionFailed {
+		t.Errorf("MOVE with a mismatching If-Match returned status %v, expected 412", resp.StatusCode)
+	}
+
+	req.Header.Del("If-Match")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("MOVE request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Errorf("MOVE returned status %v, expected 201", resp.StatusCode)
+	}
+	if _, err := b.GetAddressObject(ctx, "/user/contacts/default/b.vcf", nil); !carddav.IsNotFound(err) {
+		t.Errorf("GetAddressObject() after Move() = %v, expected not found", err)
+	}
+	if _, err := b.GetAddressObject(ctx, "/user/contacts/work/b.vcf", nil); err != nil {
+		t.Errorf("GetAddressObject() after Move() = %v", err)
+	}
+
+	// Moving onto an existing object replaces it
+	if err := c.Move(ctx, "/user/contacts/work/b.vcf", "/user/contacts/work/a.vcf", nil); err != nil {
+		t.Fatalf("Move() with overwrite = %v", err)
+	}
+	ao, err := b.GetAddressObject(ctx, "/user/contacts/work/a.vcf", nil)
+	if err != nil {
+		t.Fatalf("GetAddressObject() = %v", err)
+	}
+	if uid := ao.Card.Value(vcard.FieldUID); uid != "b" {
+		t.Errorf("GetAddressObject() UID = %q after Move(), expected %q", uid, "b")
+	}
+}
+
+func TestBackend_copyMoveDestinationPreconditions(t *testing.T) {
+	ctx := context.Background()
+	b := newTestBackend(t)
+	for _, ab := range []carddav.AddressBook{
+		{Path: "/user/contacts/small/", MaxResourceSize: 10},
+		{Path: "/user/contacts/v4/", SupportedAddressData: []carddav.AddressDataType{{ContentType: vcard.MIMEType, Version: "4.0"}}},
+	} {
+		if err := b.CreateAddressBook(ctx, &ab); err != nil {
+			t.Fatalf("CreateAddressBook() = %v", err)
+		}
+	}
+	if _, err := b.PutAddressObject(ctx, "/user/contacts/default/a.vcf", newCard("a", "Alice"), nil); err != nil {
+		t.Fatalf("PutAddressObject() = %v", err)
+	}
+
+	srv := httptest.NewServer(&carddav.Handler{Backend: b})
+	defer srv.Close()
+	c, err := webdav.NewClient(nil, srv.URL)
+	if err != nil {
+		t.Fatalf("NewClient() = %v", err)
+	}
+
+	err = c.Copy(ctx, "/user/contacts/default/a.vcf", "/user/contacts/small/a.vcf", nil)
+	if !carddav.HasPrecondition(err, carddav.PreconditionMaxResourceSize) {
+		t.Errorf("Copy() to an address book with a small max-resource-size = %v, expected a precondition error", err)
+	}
+	err = c.Move(ctx, "/user/contacts/default/a.vcf", "/user/contacts/v4/a.vcf", nil)
+	if !carddav.HasPrecondition(err, carddav.PreconditionSupportedAddressData) {
+		t.Errorf("Move() of a vCard 3.0 to a vCard 4.0 address book = %v, expected a precondition error", err)
+	}
+	if _, err := b.GetAddressObject(ctx, "/user/contacts/default/a.vcf", nil); err != nil {
+		t.Errorf("GetAddressObject() after a failed Move() = %v", err)
+	}
+}
+
+func TestBackend_put(t *testing.T) {
+	ctx := context.Background()
+	b := newTestBackend(t)
+
+	srv := httptest.NewServer(&carddav.Handler{Backend: b})
+	defer srv.Close()
+
+	var buf bytes.Buffer
+	if err := vcard.NewEncoder(&buf).Encode(newCard("a", "Alice")); err != nil {
+		t.Fatal(err)
+	}
+	canonical := buf.String()
+	// Properties aren't in the order the encoder writes them
+	unordered := "BEGIN:VCARD\r\nVERSION:3.0\r\nUID:a\r\nFN:Alice\r\nEND:VCARD\r\n"
+	if unordered == canonical {
+		t.Fatalf("test vCard is in canonical encoding")
+	}
+
+	for _, tc := range []struct {
+		name     string
+		body     string
+		expected int
+		etag     bool
+	}{
+		{"create", canonical, http.StatusCreated, true},
+		{"update", canonical, http.StatusNoContent, true},
+		{"unordered", unordered, http.StatusNoContent, false},
+	} {
+		req, err := http.NewRequest(http.MethodPut, srv.URL+"/user/contacts/default/a.vcf", strings.NewReader(tc.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", vcard.MIMEType)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%v: PUT request failed: %v", tc.name, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tc.expected {
+			t.Errorf("%v: PUT returned status %v, expected %v", tc.name, resp.StatusCode, tc.expected)
+		}
+
+		ao, err := b.GetAddressObject(ctx, "/user/contacts/default/a.vcf", nil)
+		if err != nil {
+			t.Fatalf("GetAddressObject() = %v", err)
+		}
+		expectedETag := ""
+		if tc.etag {
+			expectedETag = `"` + ao.ETag + `"`
+		}
+		if etag := resp.Header.Get("ETag"); etag != expectedETag {
+			t.Errorf("%v: PUT returned ETag %q, expected %q", tc.name, etag, expectedETag)
+		}
+	}
+}
+
+func TestBackend_putPreconditions(t *testing.T) {
+	ctx := context.Background()
+	b := newTestBackend(t)
+	err := b.CreateAddressBook(ctx, &carddav.AddressBook{
+		Path:            "/user/contacts/small/",
+		MaxResourceSize: 256,
+	})
+	if err != nil {
+		t.Fatalf("CreateAddressBook() = %v", err)
+	}
+	if _, err := b.PutAddressObject(ctx, "/user/contacts/small/a.vcf", newCard("a", "Alice"), nil); err != nil {
+		t.Fatalf("PutAddressObject() = %v", err)
+	}
+
+	srv := httptest.NewServer(&carddav.Handler{Backend: b})
+	defer srv.Close()
+
+	const card = "BEGIN:VCARD\r\nVERSION:%s\r\n%sEND:VCARD\r\n"
+	for _, tc := range []struct {
+		name         string
+		contentType  string
+		body         string
+		precondition carddav.PreconditionType
+	}{
+		{"valid", "text/vcard", fmt.Sprintf(card, "4.0", "UID:b\r\nFN:Bob\r\n"), ""},
+		{"unsupported-type", "text/x-vcard", fmt.Sprintf(card, "3.0", "UID:b\r\nFN:Bob\r\n"), carddav.PreconditionSupportedAddressData},
+		{"unsupported-version", "text/vcard", fmt.Sprintf(card, "2.1", "UID:b\r\nFN:Bob\r\n"), carddav.PreconditionSupportedAddressData},
+		{"unsupported-version-param", "text/vcard; version=2.1", fmt.Sprintf(card, "3.0", "UID:b\r\nFN:Bob\r\n"), carddav.PreconditionSupportedAddressData},
+		{"malformed", "text/vcard", "BEGIN:VCARD\r\n", carddav.PreconditionValidAddressData},
+		{"missing-fn", "text/vcard", fmt.Sprintf(card, "3.0", "UID:b\r\n"), carddav.PreconditionValidAddressData},
+		{"missing-uid", "text/vcard", fmt.Sprintf(card, "3.0", "FN:Bob\r\n"), carddav.PreconditionValidAddressData},
+		{"uid-conflict", "text/vcard", fmt.Sprintf(card, "3.0", "UID:a\r\nFN:Alice\r\n"), carddav.PreconditionNoUIDConflict},
+		{"too-large", "text/vcard", fmt.Sprintf(card, "3.0", "UID:b\r\nFN:Bob\r\nNOTE:"+strings.Repeat("x", 256)+"\r\n"), carddav.PreconditionMaxResourceSize},
+		// Data after the end of the vCard counts towards the size
+		{"too-large-trailing-data", "text/vcard", fmt.Sprintf(card, "3.0", "UID:b\r\nFN:Bob\r\n") + strings.Repeat("\r\n", 200), carddav.PreconditionMaxResourceSize},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPut, srv.URL+"/user/contacts/small/"+tc.name+".vcf", strings.NewReader(tc.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", tc.contentType)
+			// Exercise the streaming size check
+			req.ContentLength = -1
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("PUT request failed: %v", err)
+			}
+			defer resp.Body.Close()
+			data, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tc.precondition == "" {
+				if resp.StatusCode != http.StatusCreated {
+					t.Errorf("PUT returned status %v, expected 201:\n%s", resp.StatusCode, data)
+				}
+				return
+			}
+			if resp.StatusCode != http.StatusConflict || !strings.Contains(string(data), string(tc.precondition)) {
+				t.Errorf("PUT returned status %v, expected a %v precondition error:\n%s", resp.StatusCode, tc.precondition, data)
+			}
+		})
+	}
+}
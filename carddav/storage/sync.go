@@ -0,0 +1,40 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/emersion/go-webdav/carddav"
+)
+
+var _ carddav.SyncBackend = (*Backend)(nil)
+
+func (b *Backend) SyncAddressObjects(ctx context.Context, path string, query *carddav.SyncQuery) (*carddav.SyncResponse, error) {
+	abName, err := b.addressBookName(path)
+	if err != nil {
+		return nil, err
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if _, err := b.readAddressBook(abName); err != nil {
+		return nil, err
+	}
+	res, err := b.store.Sync(abName, query.SyncToken, query.Limit)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := carddav.SyncResponse{SyncToken: res.SyncToken, Truncated: res.Truncated}
+	for i := range res.Updated {
+		ao, err := b.newAddressObject(abName, &res.Updated[i])
+		if err != nil {
+			return nil, err
+		}
+		resp.Updated = append(resp.Updated, *ao)
+	}
+	for _, name := range res.Deleted {
+		resp.Deleted = append(resp.Deleted, b.store.ObjectPath(abName, name))
+	}
+	return &resp, nil
+}
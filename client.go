@@ -2,9 +2,11 @@ package webdav
 
 import (
 	"context"
+	"encoding/xml"
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/emersion/go-webdav/internal"
@@ -26,11 +28,11 @@ func (c *basicAuthHTTPClient) Do(req *http.Request) (*http.Response, error) {
 }
 
 // HTTPClientWithBasicAuth returns an HTTP client that adds basic
-// authentication to all outgoing requests. If c is nil, http.DefaultClient is
+// authentication to all outgoing requests. If c is nil, a default client is
 // used.
 func HTTPClientWithBasicAuth(c HTTPClient, username, password string) HTTPClient {
 	if c == nil {
-		c = http.DefaultClient
+		c = defaultHTTPClient
 	}
 	return &basicAuthHTTPClient{c, username, password}
 }
@@ -109,16 +111,16 @@ func fileInfoFromResponse(resp *internal.Response) (*FileInfo, error) {
 			return nil, err
 		}
 
-		var getETag internal.GetETag
-		if err := resp.DecodeProp(&getETag); err != nil && !internal.IsNotFound(err) {
-			return nil, err
-		}
-
 		fi.Size = getLen.Length
 		fi.MIMEType = getType.Type
-		fi.ETag = string(getETag.ETag)
 	}
 
+	var getETag internal.GetETag
+	if err := resp.DecodeProp(&getETag); err != nil && !internal.IsNotFound(err) {
+		return nil, err
+	}
+	fi.ETag = string(getETag.ETag)
+
 	var getMod internal.GetLastModified
 	if err := resp.DecodeProp(&getMod); err != nil && !internal.IsNotFound(err) {
 		return nil, err
@@ -139,6 +141,15 @@ func (c *Client) Stat(ctx context.Context, name string) (*FileInfo, error) {
 
 // Open fetches a file's contents.
 func (c *Client) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	return c.OpenWithOptions(ctx, name, nil)
+}
+
+// OpenWithOptions is like Open, but accepts options.
+func (c *Client) OpenWithOptions(ctx context.Context, name string, options *OpenOptions) (io.ReadCloser, error) {
+	if options == nil {
+		options = new(OpenOptions)
+	}
+
 	req, err := c.ic.NewRequest(http.MethodGet, name, nil)
 	if err != nil {
 		return nil, err
@@ -149,7 +160,11 @@ func (c *Client) Open(ctx context.Context, name string) (io.ReadCloser, error) {
 		return nil, err
 	}
 
-	return resp.Body, nil
+	if options.Progress == nil && options.RateLimiter == nil {
+		return resp.Body, nil
+	}
+	r := newTransferReader(ctx, resp.Body, resp.ContentLength, options.Progress, options.RateLimiter)
+	return &transferReadCloser{r, resp.Body}, nil
 }
 
 // ReadDir lists files in a directory.
@@ -176,6 +191,122 @@ func (c *Client) ReadDir(ctx context.Context, name string, recursive bool) ([]Fi
 	return l, nil
 }
 
+func propResponseFromResponse(resp *internal.Response) (*PropResponse, error) {
+	path, err := resp.Path()
+	if err != nil {
+		return nil, err
+	}
+
+	pr := &PropResponse{Path: path, Props: make(map[xml.Name]Property)}
+	for _, propstat := range resp.PropStats {
+		for i := range propstat.Prop.Raw {
+			raw := &propstat.Prop.Raw[i]
+			name, ok := raw.XMLName()
+			if !ok {
+				continue
+			}
+
+			var b []byte
+			if propstat.Status.Code/100 == 2 {
+				b, err = xml.Marshal(raw)
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			pr.Props[name] = Property{
+				XMLName: name,
+				Status:  propstat.Status.Code,
+				Raw:     b,
+			}
+		}
+	}
+
+	return pr, nil
+}
+
+func (c *Client) propFind(ctx context.Context, name string, depth Depth, propfind *internal.PropFind) ([]PropResponse, error) {
+	ms, err := c.ic.PropFind(ctx, name, depth, propfind)
+	if err != nil {
+		return nil, err
+	}
+
+	l := make([]PropResponse, 0, len(ms.Responses))
+	for _, resp := range ms.Responses {
+		pr, err := propResponseFromResponse(&resp)
+		if err != nil {
+			return l, err
+		}
+		l = append(l, *pr)
+	}
+
+	return l, nil
+}
+
+// PropFind fetches the specified properties of a resource. If depth isn't
+// DepthZero, the properties of the resource's members are fetched as well.
+//
+// Properties which couldn't be retrieved have a non-2xx Status.
+func (c *Client) PropFind(ctx context.Context, name string, depth Depth, names ...xml.Name) ([]PropResponse, error) {
+	return c.propFind(ctx, name, depth, internal.NewPropNamePropFind(names...))
+}
+
+// PropFindAll fetches all properties of a resource, as defined by the
+// DAV:allprop PROPFIND request. Additional properties not returned by
+// DAV:allprop can be specified in include.
+func (c *Client) PropFindAll(ctx context.Context, name string, depth Depth, include ...xml.Name) ([]PropResponse, error) {
+	propfind := &internal.PropFind{AllProp: &struct{}{}}
+	if len(include) > 0 {
+		propfind.Include = &internal.Include{Raw: internal.NewPropNamePropFind(include...).Prop.Raw}
+	}
+	return c.propFind(ctx, name, depth, propfind)
+}
+
+// PropFindNames fetches the names of all properties defined on a resource.
+// The returned properties contain empty XML elements.
+func (c *Client) PropFindNames(ctx context.Context, name string, depth Depth) ([]PropResponse, error) {
+	return c.propFind(ctx, name, depth, &internal.PropFind{PropName: &struct{}{}})
+}
+
+// PropPatch sets and removes properties of a resource.
+//
+// Properties are removed before being set. PROPPATCH is atomic: if any
+// property can't be updated, none are. The returned PropResponse contains the
+// status of each property.
+func (c *Client) PropPatch(ctx context.Context, name string, set []Property, remove []xml.Name) (*PropResponse, error) {
+	var update internal.PropertyUpdate
+
+	if len(remove) > 0 {
+		prop := internal.NewPropNamePropFind(remove...).Prop
+		update.Instructions = append(update.Instructions, internal.NewRemoveInstruction(*prop))
+	}
+
+	if len(set) > 0 {
+		var prop internal.Prop
+		for _, p := range set {
+			var raw internal.RawXMLValue
+			if len(p.Raw) > 0 {
+				if err := xml.Unmarshal(p.Raw, &raw); err != nil {
+					return nil, fmt.Errorf("webdav: failed to parse property <%v %v>: %v", p.XMLName.Space, p.XMLName.Local, err)
+				}
+				if n, _ := raw.XMLName(); n != p.XMLName {
+					return nil, fmt.Errorf("webdav: property <%v %v> has mismatched XML element <%v %v>", p.XMLName.Space, p.XMLName.Local, n.Space, n.Local)
+				}
+			} else {
+				raw = *internal.NewRawXMLElement(p.XMLName, nil, nil)
+			}
+			prop.Raw = append(prop.Raw, raw)
+		}
+		update.Instructions = append(update.Instructions, internal.NewSetInstruction(prop))
+	}
+
+	resp, err := c.ic.PropPatch(ctx, name, &update)
+	if err != nil {
+		return nil, err
+	}
+	return propResponseFromResponse(resp)
+}
+
 type fileWriter struct {
 	pw   *io.PipeWriter
 	done <-chan error
@@ -193,18 +324,59 @@ func (fw *fileWriter) Close() error {
 }
 
 // Create writes a file's contents.
+//
+// If the context is cancelled, the upload is aborted and pending Write calls
+// return an error.
 func (c *Client) Create(ctx context.Context, name string) (io.WriteCloser, error) {
+	return c.CreateWithOptions(ctx, name, nil)
+}
+
+// CreateWithOptions is like Create, but accepts options.
+func (c *Client) CreateWithOptions(ctx context.Context, name string, options *CreateOptions) (io.WriteCloser, error) {
+	if options == nil {
+		options = new(CreateOptions)
+	}
+
 	pr, pw := io.Pipe()
 
-	req, err := c.ic.NewRequest(http.MethodPut, name, pr)
+	total := options.ContentLength
+	if total <= 0 {
+		total = -1
+	}
+	var body io.Reader = pr
+	if options.Progress != nil || options.RateLimiter != nil {
+		r := newTransferReader(ctx, pr, total, options.Progress, options.RateLimiter)
+		body = &transferReadCloser{r, pr}
+	}
+
+	req, err := c.ic.NewRequest(http.MethodPut, name, body)
 	if err != nil {
 		pw.Close()
 		return nil, err
 	}
+	if options.ContentLength > 0 {
+		req.ContentLength = options.ContentLength
+	}
+	c.setLockIfHeader(req, name, options.LockToken)
+
+	finished := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			// Unblock pending Write calls right away
+			pr.CloseWithError(ctx.Err())
+		case <-finished:
+		}
+	}()
 
 	done := make(chan error, 1)
 	go func() {
+		defer close(finished)
+
 		resp, err := c.ic.Do(req.WithContext(ctx))
+		// Make sure the writer doesn't block forever if the request
+		// failed before the whole body has been consumed
+		pr.CloseWithError(err)
 		if err != nil {
 			done <- err
 			return
@@ -219,10 +391,20 @@ func (c *Client) Create(ctx context.Context, name string) (io.WriteCloser, error
 // RemoveAll deletes a file. If the file is a directory, all of its descendants
 // are recursively deleted as well.
 func (c *Client) RemoveAll(ctx context.Context, name string) error {
+	return c.RemoveAllWithOptions(ctx, name, nil)
+}
+
+// RemoveAllWithOptions is like RemoveAll, but accepts options.
+func (c *Client) RemoveAllWithOptions(ctx context.Context, name string, options *RemoveAllOptions) error {
+	if options == nil {
+		options = new(RemoveAllOptions)
+	}
+
 	req, err := c.ic.NewRequest(http.MethodDelete, name, nil)
 	if err != nil {
 		return err
 	}
+	c.setLockIfHeader(req, name, options.LockToken)
 
 	resp, err := c.ic.Do(req.WithContext(ctx))
 	if err != nil {
@@ -269,6 +451,7 @@ func (c *Client) Copy(ctx context.Context, name, dest string, options *CopyOptio
 	req.Header.Set("Destination", c.ic.ResolveHref(dest).String())
 	req.Header.Set("Overwrite", internal.FormatOverwrite(!options.NoOverwrite))
 	req.Header.Set("Depth", depth.String())
+	c.setLockIfHeader(req, dest, options.DestinationLockToken)
 
 	resp, err := c.ic.Do(req.WithContext(ctx))
 	if err != nil {
@@ -291,6 +474,7 @@ func (c *Client) Move(ctx context.Context, name, dest string, options *MoveOptio
 
 	req.Header.Set("Destination", c.ic.ResolveHref(dest).String())
 	req.Header.Set("Overwrite", internal.FormatOverwrite(!options.NoOverwrite))
+	c.setLockIfHeader(req, name, options.LockToken, dest, options.DestinationLockToken)
 
 	resp, err := c.ic.Do(req.WithContext(ctx))
 	if err != nil {
@@ -299,3 +483,206 @@ func (c *Client) Move(ctx context.Context, name, dest string, options *MoveOptio
 	resp.Body.Close()
 	return nil
 }
+
+// setLockIfHeader sets an If header with a tagged list for each pair of
+// resource path and lock token. Pairs with an empty lock token are skipped.
+func (c *Client) setLockIfHeader(req *http.Request, pairs ...string) {
+	var lists []string
+	for i := 0; i+1 < len(pairs); i += 2 {
+		name, token := pairs[i], pairs[i+1]
+		if token == "" {
+			continue
+		}
+		lists = append(lists, fmt.Sprintf("<%v> (<%v>)", c.ic.ResolveHref(name).String(), token))
+	}
+	if len(lists) > 0 {
+		req.Header.Set("If", strings.Join(lists, " "))
+	}
+}
+
+func lockFromActiveLock(al *internal.ActiveLock) (*Lock, error) {
+	lock := &Lock{Root: al.LockRoot.Href.Path}
+	if al.LockToken != nil {
+		lock.Token = strings.TrimSpace(al.LockToken.Href)
+	}
+	if al.LockScope.Shared != nil {
+		lock.Scope = LockScopeShared
+	}
+	if al.Owner != nil {
+		lock.Owner = strings.TrimSpace(al.Owner.Href)
+		if lock.Owner == "" {
+			lock.Owner = strings.TrimSpace(al.Owner.Text)
+		}
+	}
+
+	var err error
+	if al.Depth != "" {
+		if lock.Depth, err = internal.ParseDepth(strings.TrimSpace(al.Depth)); err != nil {
+			return nil, err
+		}
+	}
+	if al.Timeout != "" {
+		if lock.Timeout, err = internal.ParseTimeout(al.Timeout); err != nil {
+			return nil, err
+		}
+	}
+
+	return lock, nil
+}
+
+func (c *Client) doLock(req *http.Request, name, token string) (*Lock, error) {
+	resp, err := c.ic.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if h := resp.Header.Get("Lock-Token"); h != "" {
+		token = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(h), "<"), ">")
+	}
+
+	var prop struct {
+		XMLName       xml.Name               `xml:"DAV: prop"`
+		LockDiscovery internal.LockDiscovery `xml:"lockdiscovery"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&prop); err != nil {
+		return nil, err
+	}
+
+	for _, al := range prop.LockDiscovery.ActiveLock {
+		lock, err := lockFromActiveLock(&al)
+		if err != nil {
+			return nil, err
+		}
+		if lock.Token != token && token != "" {
+			continue
+		}
+		if lock.Root == "" {
+			lock.Root = name
+		}
+		return lock, nil
+	}
+
+	return nil, fmt.Errorf("webdav: lock %q missing from LOCK response", token)
+}
+
+// Lock takes a write lock on a file. If the file doesn't exist, an empty file
+// is created.
+//
+// The returned lock token needs to be passed to subsequent requests modifying
+// the file.
+func (c *Client) Lock(ctx context.Context, name string, options *LockOptions) (*Lock, error) {
+	if options == nil {
+		options = new(LockOptions)
+	}
+
+	lockInfo := internal.LockInfo{
+		LockType: internal.LockType{Write: &struct{}{}},
+	}
+	switch options.Scope {
+	case LockScopeExclusive:
+		lockInfo.LockScope.Exclusive = &struct{}{}
+	case LockScopeShared:
+		lockInfo.LockScope.Shared = &struct{}{}
+	default:
+		return nil, fmt.Errorf("webdav: invalid lock scope %v", options.Scope)
+	}
+	if options.Owner != "" {
+		lockInfo.Owner = &internal.Owner{Text: options.Owner}
+	}
+
+	switch options.Depth {
+	case DepthZero, DepthInfinity:
+		// ok
+	default:
+		return nil, fmt.Errorf("webdav: invalid lock depth %v", options.Depth)
+	}
+
+	req, err := c.ic.NewXMLRequest("LOCK", name, &lockInfo)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Depth", options.Depth.String())
+	if options.Timeout != 0 {
+		req.Header.Set("Timeout", internal.FormatTimeout(options.Timeout))
+	}
+
+	return c.doLock(req.WithContext(ctx), name, "")
+}
+
+// RefreshLock refreshes a lock previously taken with Lock. If timeout is
+// zero, the server default is used.
+func (c *Client) RefreshLock(ctx context.Context, name, token string, timeout time.Duration) (*Lock, error) {
+	req, err := c.ic.NewRequest("LOCK", name, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("If", fmt.Sprintf("(<%v>)", token))
+	if timeout != 0 {
+		req.Header.Set("Timeout", internal.FormatTimeout(timeout))
+	}
+
+	return c.doLock(req.WithContext(ctx), name, token)
+}
+
+// Unlock releases a lock.
+func (c *Client) Unlock(ctx context.Context, name, token string) error {
+	req, err := c.ic.NewRequest("UNLOCK", name, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Lock-Token", fmt.Sprintf("<%v>", token))
+
+	resp, err := c.ic.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// KeepLockAlive refreshes a lock in the background until the context is
+// cancelled. The lock is refreshed when half of its timeout has elapsed.
+//
+// The returned channel is closed when the context is cancelled or when
+// refreshing fails, in which case the error is sent on the channel first. The
+// lock isn't released when the context is cancelled, Unlock needs to be
+// called for that purpose.
+func (c *Client) KeepLockAlive(ctx context.Context, name string, lock *Lock) <-chan error {
+	done := make(chan error, 1)
+	go func() {
+		defer close(done)
+
+		timeout := lock.Timeout
+		for {
+			if timeout <= 0 {
+				// The lock never expires
+				<-ctx.Done()
+				return
+			}
+
+			interval := timeout / 2
+			if interval < time.Second {
+				interval = time.Second
+			}
+
+			timer := time.NewTimer(interval)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+
+			refreshed, err := c.RefreshLock(ctx, name, lock.Token, lock.Timeout)
+			if ctx.Err() != nil {
+				return
+			} else if err != nil {
+				done <- err
+				return
+			}
+			timeout = refreshed.Timeout
+		}
+	}()
+	return done
+}
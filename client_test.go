@@ -0,0 +1,229 @@
+package webdav
+
+import (
+	"context"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/emersion/go-webdav/internal"
+)
+
+var (
+	testFileIDName  = xml.Name{Space: "http://owncloud.org/ns", Local: "fileid"}
+	testMissingName = xml.Name{Space: "http://example.org/ns", Local: "missing"}
+)
+
+const testPropMultiStatus = `<?xml version="1.0" encoding="utf-8" ?>
+<d:multistatus xmlns:d="DAV:" xmlns:oc="http://owncloud.org/ns">
+  <d:response>
+    <d:href>/dir/</d:href>
+    <d:propstat>
+      <d:prop>
+        <d:displayname>Documents</d:displayname>
+        <oc:fileid><oc:id>42</oc:id><d:href>/dir/</d:href></oc:fileid>
+      </d:prop>
+      <d:status>HTTP/1.1 200 OK</d:status>
+    </d:propstat>
+    <d:propstat>
+      <d:prop><x:missing xmlns:x="http://example.org/ns"/></d:prop>
+      <d:status>HTTP/1.1 404 Not Found</d:status>
+    </d:propstat>
+  </d:response>
+  <d:response>
+    <d:href>/dir/file.txt</d:href>
+    <d:propstat>
+      <d:prop><d:displayname>file.txt</d:displayname></d:prop>
+      <d:status>HTTP/1.1 200 OK</d:status>
+    </d:propstat>
+  </d:response>
+</d:multistatus>`
+
+const testPropPatchMultiStatus = `<?xml version="1.0" encoding="utf-8" ?>
+<d:multistatus xmlns:d="DAV:">
+  <d:response>
+    <d:href>/dir/</d:href>
+    <d:propstat>
+      <d:prop><d:displayname/><oc:fileid xmlns:oc="http://owncloud.org/ns"/></d:prop>
+      <d:status>HTTP/1.1 200 OK</d:status>
+    </d:propstat>
+  </d:response>
+</d:multistatus>`
+
+// newTestPropServer returns a server replying to PROPFIND and PROPPATCH
+// requests with a fixed response. The decoded request body is stored in req.
+func newTestPropServer(t *testing.T, req interface{}, depth *string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := xml.NewDecoder(r.Body).Decode(req); err != nil {
+			t.Errorf("failed to decode %v request: %v", r.Method, err)
+		}
+		if depth != nil {
+			*depth = r.Header.Get("Depth")
+		}
+		w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+		w.WriteHeader(http.StatusMultiStatus)
+		if r.Method == "PROPPATCH" {
+			w.Write([]byte(testPropPatchMultiStatus))
+		} else {
+			w.Write([]byte(testPropMultiStatus))
+		}
+	}))
+}
+
+func rawXMLNames(l []internal.RawXMLValue) []xml.Name {
+	var names []xml.Name
+	for _, raw := range l {
+		if name, ok := raw.XMLName(); ok {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func TestClient_PropFind(t *testing.T) {
+	var propfind internal.PropFind
+	var depth string
+	srv := newTestPropServer(t, &propfind, &depth)
+	defer srv.Close()
+
+	c, err := NewClient(nil, srv.URL)
+	if err != nil {
+		t.Fatalf("NewClient() = %v", err)
+	}
+
+	l, err := c.PropFind(context.Background(), "/dir/", DepthOne, internal.DisplayNameName, testFileIDName, testMissingName)
+	if err != nil {
+		t.Fatalf("PropFind() = %v", err)
+	}
+
+	if depth != "1" {
+		t.Errorf("PROPFIND request Depth = %q, expected %q", depth, "1")
+	}
+	expectedNames := []xml.Name{internal.DisplayNameName, testFileIDName, testMissingName}
+	if propfind.Prop == nil || !reflect.DeepEqual(rawXMLNames(propfind.Prop.Raw), expectedNames) {
+		t.Errorf("PROPFIND request properties = %+v, expected %v", propfind.Prop, expectedNames)
+	}
+
+	if len(l) != 2 || l[0].Path != "/dir/" || l[1].Path != "/dir/file.txt" {
+		t.Fatalf("PropFind() = %+v, expected responses for /dir/ and /dir/file.txt", l)
+	}
+
+	displayName := l[0].Props[internal.DisplayNameName]
+	if s, err := displayName.Text(); err != nil || s != "Documents" {
+		t.Errorf("displayname = %q, %v, expected %q", s, err, "Documents")
+	}
+
+	fileID := l[0].Props[testFileIDName]
+	var v struct {
+		XMLName xml.Name `xml:"http://owncloud.org/ns fileid"`
+		ID      string   `xml:"http://owncloud.org/ns id"`
+		Href    string   `xml:"DAV: href"`
+	}
+	if err := fileID.Decode(&v); err != nil {
+		t.Errorf("fileid Decode() = %v", err)
+	} else if v.ID != "42" || v.Href != "/dir/" {
+		t.Errorf("fileid = %+v, raw:\n%s", v, fileID.Raw)
+	}
+
+	missing := l[0].Props[testMissingName]
+	if missing.Status != http.StatusNotFound || missing.Raw != nil {
+		t.Errorf("missing property = %+v, expected a 404 status without value", missing)
+	}
+	if err := missing.Err(); err == nil {
+		t.Errorf("missing property Err() = nil")
+	}
+	if _, err := missing.Text(); err == nil {
+		t.Errorf("missing property Text() succeeded")
+	}
+}
+
+func TestClient_PropFindAll(t *testing.T) {
+	var propfind internal.PropFind
+	srv := newTestPropServer(t, &propfind, nil)
+	defer srv.Close()
+
+	c, err := NewClient(nil, srv.URL)
+	if err != nil {
+		t.Fatalf("NewClient() = %v", err)
+	}
+
+	if _, err := c.PropFindAll(context.Background(), "/dir/", DepthZero, testFileIDName); err != nil {
+		t.Fatalf("PropFindAll() = %v", err)
+	}
+	if propfind.AllProp == nil || propfind.Prop != nil || propfind.PropName != nil {
+		t.Errorf("PROPFIND request = %+v, expected allprop", propfind)
+	}
+	if propfind.Include == nil || !reflect.DeepEqual(rawXMLNames(propfind.Include.Raw), []xml.Name{testFileIDName}) {
+		t.Errorf("PROPFIND request include = %+v, expected %v", propfind.Include, testFileIDName)
+	}
+}
+
+func TestClient_PropFindNames(t *testing.T) {
+	var propfind internal.PropFind
+	srv := newTestPropServer(t, &propfind, nil)
+	defer srv.Close()
+
+	c, err := NewClient(nil, srv.URL)
+	if err != nil {
+		t.Fatalf("NewClient() = %v", err)
+	}
+
+	if _, err := c.PropFindNames(context.Background(), "/dir/", DepthZero); err != nil {
+		t.Fatalf("PropFindNames() = %v", err)
+	}
+	if propfind.PropName == nil || propfind.Prop != nil || propfind.AllProp != nil {
+		t.Errorf("PROPFIND request = %+v, expected propname", propfind)
+	}
+}
+
+func TestClient_PropPatch(t *testing.T) {
+	var update internal.PropertyUpdate
+	srv := newTestPropServer(t, &update, nil)
+	defer srv.Close()
+
+	c, err := NewClient(nil, srv.URL)
+	if err != nil {
+		t.Fatalf("NewClient() = %v", err)
+	}
+
+	fileID := Property{
+		XMLName: testFileIDName,
+		Raw:     []byte(`<fileid xmlns="http://owncloud.org/ns"><id>42</id></fileid>`),
+	}
+	set := []Property{NewTextProperty(internal.DisplayNameName, "Documents"), fileID}
+	resp, err := c.PropPatch(context.Background(), "/dir/", set, []xml.Name{testMissingName})
+	if err != nil {
+		t.Fatalf("PropPatch() = %v", err)
+	}
+	if resp.Path != "/dir/" {
+		t.Errorf("PropPatch() path = %q, expected %q", resp.Path, "/dir/")
+	}
+	if prop := resp.Props[testFileIDName]; prop.Status != http.StatusOK {
+		t.Errorf("PropPatch() fileid status = %v, expected %v", prop.Status, http.StatusOK)
+	}
+
+	if len(update.Instructions) != 2 {
+		t.Fatalf("PROPPATCH request has %v instructions, expected 2", len(update.Instructions))
+	}
+	remove, setInst := update.Instructions[0], update.Instructions[1]
+	if !remove.IsRemove() || !reflect.DeepEqual(rawXMLNames(remove.Prop.Raw), []xml.Name{testMissingName}) {
+		t.Errorf("PROPPATCH request first instruction = %+v, expected removal of %v", remove, testMissingName)
+	}
+	if !setInst.IsSet() || !reflect.DeepEqual(rawXMLNames(setInst.Prop.Raw), []xml.Name{internal.DisplayNameName, testFileIDName}) {
+		t.Errorf("PROPPATCH request second instruction = %+v, expected displayname and fileid to be set", setInst)
+	}
+	var v struct {
+		ID string `xml:"http://owncloud.org/ns id"`
+	}
+	if err := setInst.Prop.Raw[1].Decode(&v); err != nil || v.ID != "42" {
+		t.Errorf("PROPPATCH request fileid = %+v, %v", v, err)
+	}
+
+	// The raw value must match the property name
+	fileID.XMLName = testMissingName
+	if _, err := c.PropPatch(context.Background(), "/dir/", []Property{fileID}, nil); err == nil {
+		t.Errorf("PropPatch() with a mismatched property name succeeded")
+	}
+}
@@ -0,0 +1,20 @@
+package webdav
+
+import (
+	"github.com/emersion/go-webdav/internal"
+)
+
+// Resolver performs DNS lookups. It's implemented by *net.Resolver.
+type Resolver = internal.Resolver
+
+// DiscoveryStep describes a step performed during service discovery. It can
+// be used to troubleshoot setups where discovery fails.
+type DiscoveryStep = internal.DiscoveryStep
+
+// DiscoveryOptions contains options for CalDAV and CardDAV service discovery.
+type DiscoveryOptions struct {
+	// Resolver is used for DNS lookups. If nil, net.DefaultResolver is used.
+	Resolver Resolver
+	// Trace, if non-nil, is called for each attempted discovery step.
+	Trace func(step *DiscoveryStep)
+}
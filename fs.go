@@ -0,0 +1,366 @@
+package webdav
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/emersion/go-webdav/internal"
+)
+
+// FSOptions contains options for Client.FS.
+type FSOptions struct {
+	// CacheDirs enables caching of directory listings. Cached listings are
+	// revalidated against the directory's ETag, which requires the server to
+	// return ETags for collections.
+	CacheDirs bool
+}
+
+// FS returns a read-only file system backed by the WebDAV server. Paths are
+// interpreted relative to the client endpoint. The returned file system
+// implements fs.StatFS, fs.ReadDirFS and fs.ReadFileFS. Its files implement
+// io.Seeker with ranged GET requests, so that it can be served with http.FS.
+//
+// All requests are performed with the provided context. If options is nil,
+// defaults are used.
+func (c *Client) FS(ctx context.Context, options *FSOptions) fs.FS {
+	if options == nil {
+		options = new(FSOptions)
+	}
+	return &remoteFS{
+		c:       c,
+		ctx:     ctx,
+		options: *options,
+		cache:   make(map[string]*cachedDir),
+	}
+}
+
+type cachedDir struct {
+	etag    string
+	entries []fs.DirEntry
+}
+
+type remoteFS struct {
+	c       *Client
+	ctx     context.Context
+	options FSOptions
+
+	mu    sync.Mutex
+	cache map[string]*cachedDir
+}
+
+var (
+	_ fs.StatFS     = (*remoteFS)(nil)
+	_ fs.ReadDirFS  = (*remoteFS)(nil)
+	_ fs.ReadFileFS = (*remoteFS)(nil)
+)
+
+// remotePath converts an fs.FS path into a path suitable for Client methods.
+func (rfs *remoteFS) remotePath(op, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		return "", nil
+	}
+	return name, nil
+}
+
+func fsError(op, name string, err error) error {
+	var httpErr *internal.HTTPError
+	if errors.As(err, &httpErr) {
+		switch httpErr.Code {
+		case http.StatusNotFound, http.StatusGone:
+			err = fs.ErrNotExist
+		case http.StatusUnauthorized, http.StatusForbidden:
+			err = fs.ErrPermission
+		}
+	}
+	return &fs.PathError{Op: op, Path: name, Err: err}
+}
+
+func (rfs *remoteFS) Open(name string) (fs.File, error) {
+	p, err := rfs.remotePath("open", name)
+	if err != nil {
+		return nil, err
+	}
+
+	fi, err := rfs.c.Stat(rfs.ctx, p)
+	if err != nil {
+		return nil, fsError("open", name, err)
+	}
+
+	info := newFileInfo(name, fi)
+	if fi.IsDir {
+		return &remoteDir{fs: rfs, name: name, info: info}, nil
+	}
+	return &remoteFile{fs: rfs, name: name, info: info}, nil
+}
+
+func (rfs *remoteFS) Stat(name string) (fs.FileInfo, error) {
+	p, err := rfs.remotePath("stat", name)
+	if err != nil {
+		return nil, err
+	}
+
+	fi, err := rfs.c.Stat(rfs.ctx, p)
+	if err != nil {
+		return nil, fsError("stat", name, err)
+	}
+	return newFileInfo(name, fi), nil
+}
+
+func (rfs *remoteFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	p, err := rfs.remotePath("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+
+	if rfs.options.CacheDirs {
+		rfs.mu.Lock()
+		cached := rfs.cache[name]
+		rfs.mu.Unlock()
+
+		if cached != nil {
+			fi, err := rfs.c.Stat(rfs.ctx, p)
+			if err != nil {
+				return nil, fsError("readdir", name, err)
+			}
+			if fi.ETag == cached.etag {
+				return append([]fs.DirEntry(nil), cached.entries...), nil
+			}
+		}
+	}
+
+	l, err := rfs.c.ReadDir(rfs.ctx, p, false)
+	if err != nil {
+		return nil, fsError("readdir", name, err)
+	}
+
+	dirPath := path.Clean(rfs.c.ic.ResolveHref(p).Path)
+
+	// Servers are supposed to include the directory itself in the listing
+	var etag string
+	isDir := true
+	entries := make([]fs.DirEntry, 0, len(l))
+	for i := range l {
+		fi := &l[i]
+		if path.Clean(fi.Path) == dirPath {
+			etag = fi.ETag
+			isDir = fi.IsDir
+			continue
+		}
+		entries = append(entries, fs.FileInfoToDirEntry(newFileInfo(path.Clean(fi.Path), fi)))
+	}
+	if !isDir {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+
+	if rfs.options.CacheDirs && etag != "" {
+		rfs.mu.Lock()
+		rfs.cache[name] = &cachedDir{etag: etag, entries: entries}
+		rfs.mu.Unlock()
+	}
+
+	return append([]fs.DirEntry(nil), entries...), nil
+}
+
+func (rfs *remoteFS) ReadFile(name string) ([]byte, error) {
+	p, err := rfs.remotePath("readfile", name)
+	if err != nil {
+		return nil, err
+	}
+
+	rc, err := rfs.c.Open(rfs.ctx, p)
+	if err != nil {
+		return nil, fsError("readfile", name, err)
+	}
+	defer rc.Close()
+
+	b, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: err}
+	}
+	return b, nil
+}
+
+// fileInfo implements fs.FileInfo.
+type fileInfo struct {
+	name string
+	fi   *FileInfo
+}
+
+func newFileInfo(name string, fi *FileInfo) *fileInfo {
+	return &fileInfo{name: path.Base(name), fi: fi}
+}
+
+func (fi *fileInfo) Name() string {
+	return fi.name
+}
+
+func (fi *fileInfo) Size() int64 {
+	return fi.fi.Size
+}
+
+func (fi *fileInfo) Mode() fs.FileMode {
+	if fi.fi.IsDir {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
+
+func (fi *fileInfo) ModTime() time.Time {
+	return fi.fi.ModTime
+}
+
+func (fi *fileInfo) IsDir() bool {
+	return fi.fi.IsDir
+}
+
+// Sys returns the underlying *FileInfo.
+func (fi *fileInfo) Sys() interface{} {
+	return fi.fi
+}
+
+// remoteFile implements fs.File and io.Seeker. The file is downloaded when
+// it's first read, with a ranged GET request if the offset isn't zero.
+type remoteFile struct {
+	fs     *remoteFS
+	name   string
+	info   *fileInfo
+	body   io.ReadCloser
+	offset int64
+}
+
+var _ io.Seeker = (*remoteFile)(nil)
+
+func (f *remoteFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+// open starts downloading the file at the current offset.
+func (f *remoteFile) open() error {
+	p, _ := f.fs.remotePath("read", f.name)
+	req, err := f.fs.c.ic.NewRequest(http.MethodGet, p, nil)
+	if err != nil {
+		return fsError("read", f.name, err)
+	}
+	if f.offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", f.offset))
+	}
+
+	resp, err := f.fs.c.ic.Do(req.WithContext(f.fs.ctx))
+	if err != nil {
+		return fsError("read", f.name, err)
+	}
+	if f.offset > 0 && resp.StatusCode != http.StatusPartialContent {
+		// The server doesn't support ranges, skip to the offset
+		if _, err := io.CopyN(ioutil.Discard, resp.Body, f.offset); err != nil && err != io.EOF {
+			resp.Body.Close()
+			return &fs.PathError{Op: "read", Path: f.name, Err: err}
+		}
+	}
+	f.body = resp.Body
+	return nil
+}
+
+func (f *remoteFile) Read(b []byte) (int, error) {
+	if f.body == nil {
+		if f.offset > 0 && f.offset >= f.info.Size() {
+			return 0, io.EOF
+		}
+		if err := f.open(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.body.Read(b)
+	f.offset += int64(n)
+	return n, err
+}
+
+func (f *remoteFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.info.Size()
+	default:
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrInvalid}
+	}
+	if offset < 0 {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrInvalid}
+	}
+
+	if offset != f.offset && f.body != nil {
+		f.body.Close()
+		f.body = nil
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+func (f *remoteFile) Close() error {
+	if f.body == nil {
+		return nil
+	}
+	return f.body.Close()
+}
+
+type remoteDir struct {
+	fs      *remoteFS
+	name    string
+	info    *fileInfo
+	entries []fs.DirEntry
+	loaded  bool
+}
+
+func (d *remoteDir) Stat() (fs.FileInfo, error) {
+	return d.info, nil
+}
+
+func (d *remoteDir) Read(b []byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.name, Err: errors.New("is a directory")}
+}
+
+func (d *remoteDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !d.loaded {
+		entries, err := d.fs.ReadDir(d.name)
+		if err != nil {
+			return nil, err
+		}
+		d.entries = entries
+		d.loaded = true
+	}
+
+	if n <= 0 {
+		l := d.entries
+		d.entries = nil
+		return l, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(d.entries) {
+		n = len(d.entries)
+	}
+	l := d.entries[:n]
+	d.entries = d.entries[n:]
+	return l, nil
+}
+
+func (d *remoteDir) Close() error {
+	return nil
+}
@@ -0,0 +1,145 @@
+package webdav
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestClient_FS(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"hello.txt":           "Hello, world!",
+		"docs/readme.md":      "# README",
+		"docs/nested/note.md": "note",
+	}
+	for name, data := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	srv := httptest.NewServer(&Handler{FileSystem: LocalFileSystem(dir)})
+	defer srv.Close()
+
+	c, err := NewClient(nil, srv.URL)
+	if err != nil {
+		t.Fatalf("NewClient() = %v", err)
+	}
+
+	fsys := c.FS(context.Background(), &FSOptions{CacheDirs: true})
+	if err := fstest.TestFS(fsys, "hello.txt", "docs/readme.md", "docs/nested/note.md"); err != nil {
+		t.Error(err)
+	}
+
+	b, err := fs.ReadFile(fsys, "docs/readme.md")
+	if err != nil {
+		t.Errorf("ReadFile() = %v", err)
+	} else if string(b) != files["docs/readme.md"] {
+		t.Errorf("ReadFile() = %q, expected %q", string(b), files["docs/readme.md"])
+	}
+
+	if _, err := fs.Stat(fsys, "missing.txt"); !os.IsNotExist(err) {
+		t.Errorf("Stat() = %v, expected fs.ErrNotExist", err)
+	}
+}
+
+func TestClient_FS_httpFileServer(t *testing.T) {
+	dir := t.TempDir()
+	data := "<!DOCTYPE html><html><body>Hello, world!</body></html>"
+	// The extension is unknown, so the content type is sniffed
+	if err := os.WriteFile(filepath.Join(dir, "page.unknown"), []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(&Handler{FileSystem: LocalFileSystem(dir)})
+	defer srv.Close()
+
+	c, err := NewClient(nil, srv.URL)
+	if err != nil {
+		t.Fatalf("NewClient() = %v", err)
+	}
+	fileServer := http.FileServer(http.FS(c.FS(context.Background(), nil)))
+
+	req := httptest.NewRequest(http.MethodGet, "/page.unknown", nil)
+	w := httptest.NewRecorder()
+	fileServer.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || w.Body.String() != data {
+		t.Errorf("GET returned %v %q, expected %v %q", w.Code, w.Body.String(), http.StatusOK, data)
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("GET returned Content-Type %q, expected text/html", ct)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/page.unknown", nil)
+	req.Header.Set("Range", "bytes=28-33")
+	w = httptest.NewRecorder()
+	fileServer.ServeHTTP(w, req)
+	if w.Code != http.StatusPartialContent || w.Body.String() != data[28:34] {
+		t.Errorf("ranged GET returned %v %q, expected %v %q", w.Code, w.Body.String(), http.StatusPartialContent, data[28:34])
+	}
+}
+
+func TestRemoteFile_Seek(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "digits.txt"), []byte("0123456789"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(&Handler{FileSystem: LocalFileSystem(dir)})
+	defer srv.Close()
+
+	c, err := NewClient(nil, srv.URL)
+	if err != nil {
+		t.Fatalf("NewClient() = %v", err)
+	}
+	f, err := c.FS(context.Background(), nil).Open("digits.txt")
+	if err != nil {
+		t.Fatalf("Open() = %v", err)
+	}
+	defer f.Close()
+	seeker := f.(io.ReadSeeker)
+
+	b := make([]byte, 3)
+	for _, tc := range []struct {
+		offset int64
+		whence int
+		pos    int64
+		data   string
+	}{
+		{0, io.SeekCurrent, 0, "012"},
+		{2, io.SeekCurrent, 5, "567"},
+		{-2, io.SeekEnd, 8, "89"},
+		{1, io.SeekStart, 1, "123"},
+	} {
+		pos, err := seeker.Seek(tc.offset, tc.whence)
+		if err != nil || pos != tc.pos {
+			t.Fatalf("Seek(%v, %v) = %v, %v, expected %v", tc.offset, tc.whence, pos, err, tc.pos)
+		}
+		n, err := io.ReadFull(seeker, b[:len(tc.data)])
+		if err != nil || string(b[:n]) != tc.data {
+			t.Errorf("Read() after Seek(%v, %v) = %q, %v, expected %q", tc.offset, tc.whence, b[:n], err, tc.data)
+		}
+	}
+
+	if _, err := seeker.Seek(0, io.SeekEnd); err != nil {
+		t.Fatalf("Seek() = %v", err)
+	}
+	if n, err := seeker.Read(b); n != 0 || err != io.EOF {
+		t.Errorf("Read() at the end = %v, %v, expected EOF", n, err)
+	}
+	if _, err := seeker.Seek(-1, io.SeekStart); err == nil {
+		t.Errorf("Seek() to a negative offset succeeded")
+	}
+}
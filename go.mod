@@ -1,10 +1,12 @@
 module github.com/emersion/go-webdav
 
-go 1.13
+go 1.16
 
 require (
 	github.com/emersion/go-ical v0.0.0-20240127095438-fc1c9d8fb2b6
 	github.com/emersion/go-vcard v0.0.0-20230815062825-8fda7d206ec9
 	github.com/hashicorp/go-uuid v1.0.3 // indirect
 	github.com/joho/godotenv v1.5.1 // indirect
+	github.com/teambition/rrule-go v1.8.2
+	golang.org/x/text v0.3.8
 )
@@ -7,7 +7,6 @@ import (
 	"fmt"
 	"io"
 	"mime"
-	"net"
 	"net/http"
 	"net/url"
 	"path"
@@ -15,42 +14,6 @@ import (
 	"unicode"
 )
 
-// DiscoverContextURL performs a DNS-based CardDAV/CalDAV service discovery as
-// described in RFC 6352 section 11. It returns the URL to the CardDAV server.
-func DiscoverContextURL(ctx context.Context, service, domain string) (string, error) {
-	var resolver net.Resolver
-
-	// Only lookup TLS records, plaintext connections are insecure
-	_, addrs, err := resolver.LookupSRV(ctx, service+"s", "tcp", domain)
-	if dnsErr, ok := err.(*net.DNSError); ok {
-		if dnsErr.IsTemporary {
-			return "", err
-		}
-	} else if err != nil {
-		return "", err
-	}
-
-	if len(addrs) == 0 {
-		return "", fmt.Errorf("webdav: domain doesn't have an SRV record")
-	}
-	addr := addrs[0]
-
-	target := strings.TrimSuffix(addr.Target, ".")
-	if target == "" {
-		return "", fmt.Errorf("webdav: empty target in SRV record")
-	}
-
-	// TODO: perform a TXT lookup, check for a "path" key in the response
-	u := url.URL{Scheme: "https"}
-	if addr.Port == 443 {
-		u.Host = target
-	} else {
-		u.Host = fmt.Sprintf("%v:%v", target, addr.Port)
-	}
-	u.Path = "/.well-known/" + service
-	return u.String(), nil
-}
-
 // HTTPClient performs HTTP requests. It's implemented by *http.Client.
 type HTTPClient interface {
 	Do(req *http.Request) (*http.Response, error)
@@ -116,37 +79,81 @@ func (c *Client) Do(req *http.Request) (*http.Response, error) {
 		return nil, err
 	}
 	if resp.StatusCode/100 != 2 {
-		defer resp.Body.Close()
+		return nil, errorFromResponse(resp)
+	}
+	return resp, nil
+}
 
-		contentType := resp.Header.Get("Content-Type")
-		if contentType == "" {
-			contentType = "text/plain"
+// errorFromResponse creates an *HTTPError from a non-2xx response. The
+// response body is closed.
+func errorFromResponse(resp *http.Response) *HTTPError {
+	defer resp.Body.Close()
+
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "text/plain"
+	}
+
+	httpErr := &HTTPError{Code: resp.StatusCode}
+	t, _, _ := mime.ParseMediaType(contentType)
+	if t == "application/xml" || t == "text/xml" {
+		if err := decodeXMLError(resp.Body, httpErr); err != nil {
+			httpErr.Err = err
+		}
+	} else if strings.HasPrefix(t, "text/") {
+		lr := io.LimitedReader{R: resp.Body, N: 1024}
+		var buf bytes.Buffer
+		io.Copy(&buf, &lr)
+		if s := strings.TrimSpace(buf.String()); s != "" {
+			if lr.N == 0 {
+				s += " […]"
+			}
+			httpErr.Err = fmt.Errorf("%v", s)
 		}
+	}
+	return httpErr
+}
 
-		var wrappedErr error
-		t, _, _ := mime.ParseMediaType(contentType)
-		if t == "application/xml" || t == "text/xml" {
-			var davErr Error
-			if err := xml.NewDecoder(resp.Body).Decode(&davErr); err != nil {
-				wrappedErr = err
-			} else {
-				wrappedErr = &davErr
+// decodeXMLError populates httpErr from an XML error body. Both DAV:error and
+// DAV:multistatus bodies are supported.
+func decodeXMLError(r io.Reader, httpErr *HTTPError) error {
+	var raw RawXMLValue
+	if err := xml.NewDecoder(r).Decode(&raw); err != nil {
+		return err
+	}
+
+	name, _ := raw.XMLName()
+	switch name {
+	case ErrorName:
+		var davErr Error
+		if err := raw.Decode(&davErr); err != nil {
+			return err
+		}
+		httpErr.Conditions = davErr.Conditions()
+		httpErr.Href = davErr.Href()
+		httpErr.Err = &davErr
+	case MultiStatusName:
+		var ms MultiStatus
+		if err := raw.Decode(&ms); err != nil {
+			return err
+		}
+		httpErr.Description = ms.ResponseDescription
+		for _, resp := range ms.Responses {
+			if resp.Error == nil {
+				continue
 			}
-		} else if strings.HasPrefix(t, "text/") {
-			lr := io.LimitedReader{R: resp.Body, N: 1024}
-			var buf bytes.Buffer
-			io.Copy(&buf, &lr)
-			resp.Body.Close()
-			if s := strings.TrimSpace(buf.String()); s != "" {
-				if lr.N == 0 {
-					s += " […]"
-				}
-				wrappedErr = fmt.Errorf("%v", s)
+			httpErr.Conditions = append(httpErr.Conditions, resp.Error.Conditions()...)
+			if httpErr.Href == "" {
+				httpErr.Href = resp.Error.Href()
 			}
 		}
-		return nil, &HTTPError{Code: resp.StatusCode, Err: wrappedErr}
+		if httpErr.Description != "" {
+			httpErr.Err = fmt.Errorf("%v", httpErr.Description)
+		}
+	default:
+		return fmt.Errorf("webdav: unexpected XML error body <%v %v>", name.Space, name.Local)
 	}
-	return resp, nil
+	return nil
 }
 
 func (c *Client) DoMultiStatus(req *http.Request) (*MultiStatus, error) {
@@ -194,6 +201,24 @@ func (c *Client) PropFindFlat(ctx context.Context, path string, propfind *PropFi
 	return &ms.Responses[0], nil
 }
 
+// PropPatch performs a PROPPATCH request.
+func (c *Client) PropPatch(ctx context.Context, path string, update *PropertyUpdate) (*Response, error) {
+	req, err := c.NewXMLRequest("PROPPATCH", path, update)
+	if err != nil {
+		return nil, err
+	}
+
+	ms, err := c.DoMultiStatus(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ms.Responses) != 1 {
+		return nil, fmt.Errorf("PROPPATCH returned %d responses", len(ms.Responses))
+	}
+	return &ms.Responses[0], nil
+}
+
 func parseCommaSeparatedSet(values []string, upper bool) map[string]bool {
 	m := make(map[string]bool)
 	for _, v := range values {
@@ -0,0 +1,93 @@
+package internal
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const exampleUIDConflictErrorStr = `<?xml version="1.0" encoding="utf-8" ?>
+<d:error xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">
+  <c:no-uid-conflict>
+    <d:href>/home/user/calendars/default/other.ics</d:href>
+  </c:no-uid-conflict>
+</d:error>`
+
+const exampleMultiStatusErrorStr = `<?xml version="1.0" encoding="utf-8" ?>
+<d:multistatus xmlns:d="DAV:">
+  <d:response>
+    <d:href>/container/resource</d:href>
+    <d:status>HTTP/1.1 423 Locked</d:status>
+    <d:error><d:lock-token-submitted><d:href>/container/</d:href></d:lock-token-submitted></d:error>
+  </d:response>
+  <d:responsedescription>Resource is locked</d:responsedescription>
+</d:multistatus>`
+
+func TestClient_Do_error(t *testing.T) {
+	tests := []struct {
+		name        string
+		code        int
+		body        string
+		condition   xml.Name
+		href        string
+		description string
+	}{
+		{
+			name:      "error",
+			code:      http.StatusConflict,
+			body:      exampleUIDConflictErrorStr,
+			condition: xml.Name{"urn:ietf:params:xml:ns:caldav", "no-uid-conflict"},
+			href:      "/home/user/calendars/default/other.ics",
+		},
+		{
+			name:        "multistatus",
+			code:        http.StatusLocked,
+			body:        exampleMultiStatusErrorStr,
+			condition:   xml.Name{Namespace, "lock-token-submitted"},
+			href:        "/container/",
+			description: "Resource is locked",
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+				w.WriteHeader(tc.code)
+				w.Write([]byte(tc.body))
+			}))
+			defer srv.Close()
+
+			c, err := NewClient(nil, srv.URL)
+			if err != nil {
+				t.Fatalf("NewClient() = %v", err)
+			}
+			req, err := c.NewRequest(http.MethodPut, "/container/resource", nil)
+			if err != nil {
+				t.Fatalf("NewRequest() = %v", err)
+			}
+
+			_, err = c.Do(req.WithContext(context.Background()))
+			var httpErr *HTTPError
+			if !errors.As(err, &httpErr) {
+				t.Fatalf("Do() = %v, expected an *HTTPError", err)
+			}
+			if httpErr.Code != tc.code {
+				t.Errorf("HTTPError.Code = %v, expected %v", httpErr.Code, tc.code)
+			}
+			if !httpErr.HasCondition(tc.condition) {
+				t.Errorf("HTTPError.Conditions = %v, expected %v", httpErr.Conditions, tc.condition)
+			}
+			if httpErr.Href != tc.href {
+				t.Errorf("HTTPError.Href = %q, expected %q", httpErr.Href, tc.href)
+			}
+			if httpErr.Description != tc.description {
+				t.Errorf("HTTPError.Description = %q, expected %q", httpErr.Description, tc.description)
+			}
+		})
+	}
+}
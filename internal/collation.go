@@ -0,0 +1,55 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Collations supported for text matching, as defined in RFC 4790 section 9
+// and RFC 5051.
+const (
+	CollationOctet          = "i;octet"
+	CollationASCIICasemap   = "i;ascii-casemap"
+	CollationUnicodeCasemap = "i;unicode-casemap"
+)
+
+// DefaultCollation is the collation used when none is specified, as defined
+// in RFC 4791 section 9.7.5 and RFC 6352 section 10.5.4.
+const DefaultCollation = CollationASCIICasemap
+
+// IsSupportedCollation reports whether a collation is supported. The empty
+// string stands for DefaultCollation.
+func IsSupportedCollation(name string) bool {
+	switch name {
+	case "", CollationOctet, CollationASCIICasemap, CollationUnicodeCasemap:
+		return true
+	}
+	return false
+}
+
+// CollationKey returns the key of a string for a collation. Two strings are
+// equal according to the collation if and only if their keys are equal, and
+// substring matches are performed on keys.
+func CollationKey(collation, s string) (string, error) {
+	switch collation {
+	case CollationOctet:
+		return s, nil
+	case "", CollationASCIICasemap:
+		return strings.Map(func(r rune) rune {
+			if 'a' <= r && r <= 'z' {
+				return r - 'a' + 'A'
+			}
+			return r
+		}, s), nil
+	case CollationUnicodeCasemap:
+		// Decompose before folding, since compatibility decompositions may
+		// yield characters with a different case
+		s = cases.Fold().String(norm.NFKD.String(s))
+		return norm.NFKD.String(s), nil
+	default:
+		return "", fmt.Errorf("webdav: unsupported collation %q", collation)
+	}
+}
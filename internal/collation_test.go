@@ -0,0 +1,39 @@
+package internal
+
+import (
+	"testing"
+)
+
+func TestCollationKey(t *testing.T) {
+	for _, tc := range []struct {
+		collation string
+		a, b      string
+		equal     bool
+	}{
+		{CollationOctet, "Smith", "smith", false},
+		{CollationOctet, "Smith", "Smith", true},
+		{"", "Smith", "smith", true},
+		{CollationASCIICasemap, "Smith", "SMITH", true},
+		{CollationASCIICasemap, "Éric", "éric", false},
+		{CollationUnicodeCasemap, "Éric", "éric", true},
+		// Precomposed and decomposed forms
+		{CollationUnicodeCasemap, "\u00e9ric", "e\u0301ric", true},
+		{CollationUnicodeCasemap, "Straße", "STRASSE", true},
+	} {
+		a, err := CollationKey(tc.collation, tc.a)
+		if err != nil {
+			t.Fatalf("CollationKey(%q, %q) = %v", tc.collation, tc.a, err)
+		}
+		b, err := CollationKey(tc.collation, tc.b)
+		if err != nil {
+			t.Fatalf("CollationKey(%q, %q) = %v", tc.collation, tc.b, err)
+		}
+		if (a == b) != tc.equal {
+			t.Errorf("%v: %q == %q = %v, want %v", tc.collation, tc.a, tc.b, a == b, tc.equal)
+		}
+	}
+
+	if _, err := CollationKey("i;basic", "Smith"); err == nil {
+		t.Errorf("CollationKey() with an unsupported collation succeeded")
+	}
+}
@@ -0,0 +1,306 @@
+package internal
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Resolver performs DNS lookups. It's implemented by *net.Resolver.
+type Resolver interface {
+	LookupSRV(ctx context.Context, service, proto, name string) (cname string, addrs []*net.SRV, err error)
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
+
+// DiscoveryStep describes a step performed during service discovery.
+type DiscoveryStep struct {
+	// Name is the kind of step: "srv" and "txt" for DNS lookups,
+	// "principal" for current-user-principal requests and "home-set" for
+	// home set requests.
+	Name string
+	// Target is the DNS name or URL queried.
+	Target string
+	// Result is a human-readable description of the outcome, if successful.
+	Result string
+	Err    error
+}
+
+// DiscoveryTrace is called for each step performed during service discovery.
+type DiscoveryTrace func(step *DiscoveryStep)
+
+// Step reports a discovery step, if trace is non-nil.
+func (trace DiscoveryTrace) Step(name, target, result string, err error) {
+	if trace != nil {
+		trace(&DiscoveryStep{Name: name, Target: target, Result: result, Err: err})
+	}
+}
+
+const maxDiscoveryRedirects = 10
+
+// DiscoverContextURL performs a DNS-based CardDAV/CalDAV service discovery as
+// described in RFC 6764 section 3 and 4. It returns the URL to the server.
+func DiscoverContextURL(ctx context.Context, service, domain string) (string, error) {
+	u, err := LookupContextURL(ctx, net.DefaultResolver, service, domain, nil)
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
+
+// LookupContextURL performs SRV and TXT lookups for a service, as described in
+// RFC 6764 section 3 and 4. Only TLS records are taken into account.
+func LookupContextURL(ctx context.Context, resolver Resolver, service, domain string, trace DiscoveryTrace) (*url.URL, error) {
+	// Only lookup TLS records, plaintext connections are insecure
+	srvName := "_" + service + "s._tcp." + domain
+	_, addrs, err := resolver.LookupSRV(ctx, service+"s", "tcp", domain)
+	if dnsErr, ok := err.(*net.DNSError); ok {
+		if dnsErr.IsTemporary {
+			trace.Step("srv", srvName, "", err)
+			return nil, err
+		}
+	} else if err != nil {
+		trace.Step("srv", srvName, "", err)
+		return nil, err
+	}
+
+	if len(addrs) == 0 {
+		err := fmt.Errorf("webdav: domain doesn't have an SRV record")
+		trace.Step("srv", srvName, "", err)
+		return nil, err
+	}
+	addr := addrs[0]
+
+	target := strings.TrimSuffix(addr.Target, ".")
+	if target == "" {
+		err := fmt.Errorf("webdav: empty target in SRV record")
+		trace.Step("srv", srvName, "", err)
+		return nil, err
+	}
+
+	u := url.URL{Scheme: "https"}
+	if addr.Port == 443 {
+		u.Host = target
+	} else {
+		u.Host = fmt.Sprintf("%v:%v", target, addr.Port)
+	}
+	trace.Step("srv", srvName, u.Host, nil)
+
+	u.Path = "/.well-known/" + service
+	if txts, err := resolver.LookupTXT(ctx, srvName); err != nil {
+		// The TXT record is optional
+		trace.Step("txt", srvName, "", err)
+	} else if p := parseTXTPath(txts); p != "" {
+		u.Path = p
+		trace.Step("txt", srvName, "path="+p, nil)
+	} else {
+		trace.Step("txt", srvName, "no path key", nil)
+	}
+
+	return &u, nil
+}
+
+// parseTXTPath extracts the "path" key from TXT records, as described in RFC
+// 6764 section 4.
+func parseTXTPath(txts []string) string {
+	for _, txt := range txts {
+		for _, kv := range strings.Fields(txt) {
+			k, v := kv, ""
+			if i := strings.IndexByte(kv, '='); i >= 0 {
+				k, v = kv[:i], kv[i+1:]
+			}
+			if strings.EqualFold(k, "path") && strings.HasPrefix(v, "/") {
+				return v
+			}
+		}
+	}
+	return ""
+}
+
+// noRedirectHTTPClient returns a version of c which doesn't follow redirects,
+// if possible. Other clients, e.g. wrapping an *http.Client, may still follow
+// redirects: FindCurrentUserPrincipal detects it from the request attached to
+// the response.
+func noRedirectHTTPClient(c HTTPClient) HTTPClient {
+	if c == nil {
+		c = http.DefaultClient
+	}
+	if hc, ok := c.(*http.Client); ok {
+		noRedirect := *hc
+		noRedirect.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+		return &noRedirect
+	}
+	return c
+}
+
+func isRedirect(code int) bool {
+	switch code {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
+
+// FindCurrentUserPrincipal fetches the current user principal at the
+// specified URL, manually following redirects as described in RFC 6764
+// section 5. It returns the final URL along with the principal path.
+func FindCurrentUserPrincipal(ctx context.Context, c HTTPClient, u *url.URL, trace DiscoveryTrace) (*url.URL, string, error) {
+	c = noRedirectHTTPClient(c)
+
+	for i := 0; i <= maxDiscoveryRedirects; i++ {
+		target := u.String()
+
+		ic, err := NewClient(c, target)
+		if err != nil {
+			return nil, "", err
+		}
+		req, err := ic.NewXMLRequest("PROPFIND", "", NewPropNamePropFind(CurrentUserPrincipalName))
+		if err != nil {
+			return nil, "", err
+		}
+		req.URL = u
+		req.Host = u.Host
+		req.Header.Set("Depth", DepthZero.String())
+
+		resp, err := c.Do(req.WithContext(ctx))
+		if err != nil {
+			trace.Step("principal", target, "", err)
+			return nil, "", err
+		}
+
+		// The HTTP client may follow redirects by itself, e.g. if it wraps an
+		// *http.Client. 301 and 302 redirects turn the PROPFIND into a GET,
+		// in which case the request is sent again to the final URL.
+		base := u
+		if resp.Request != nil && resp.Request.URL != nil {
+			base = resp.Request.URL
+		}
+		followed := base.String() != target
+		downgraded := followed && resp.Request.Method != req.Method
+
+		var loc *url.URL
+		if isRedirect(resp.StatusCode) {
+			loc, err = base.Parse(resp.Header.Get("Location"))
+		} else if followed {
+			loc = base
+		}
+		if err == nil && loc != nil && loc.Scheme != "https" && u.Scheme == "https" {
+			err = fmt.Errorf("webdav: refusing to follow redirect to insecure URL %q", loc)
+		}
+		if err != nil {
+			resp.Body.Close()
+			trace.Step("principal", target, "", err)
+			return nil, "", err
+		}
+		if loc != nil {
+			trace.Step("principal", target, fmt.Sprintf("redirected to %v", loc), nil)
+			u, target = loc, loc.String()
+			if isRedirect(resp.StatusCode) || downgraded {
+				resp.Body.Close()
+				continue
+			}
+		}
+
+		principal, err := decodeCurrentUserPrincipal(resp)
+		if err != nil {
+			trace.Step("principal", target, "", err)
+			return nil, "", err
+		}
+		trace.Step("principal", target, principal, nil)
+		return u, principal, nil
+	}
+
+	err := fmt.Errorf("webdav: too many redirects")
+	trace.Step("principal", u.String(), "", err)
+	return nil, "", err
+}
+
+func decodeCurrentUserPrincipal(resp *http.Response) (string, error) {
+	if resp.StatusCode/100 != 2 {
+		return "", errorFromResponse(resp)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusMultiStatus {
+		return "", fmt.Errorf("HTTP multi-status request failed: %v", resp.Status)
+	}
+
+	var ms MultiStatus
+	if err := xml.NewDecoder(resp.Body).Decode(&ms); err != nil {
+		return "", err
+	}
+	if len(ms.Responses) != 1 {
+		return "", fmt.Errorf("PROPFIND with Depth: 0 returned %d responses", len(ms.Responses))
+	}
+
+	var prop CurrentUserPrincipal
+	if err := ms.Responses[0].DecodeProp(&prop); err != nil {
+		return "", err
+	}
+	if prop.Unauthenticated != nil {
+		return "", fmt.Errorf("webdav: unauthenticated")
+	}
+	if prop.Href.Path == "" {
+		return "", fmt.Errorf("webdav: empty current-user-principal")
+	}
+	return prop.Href.Path, nil
+}
+
+// DiscoverPrincipal performs the bootstrapping procedure described in RFC
+// 6764 section 6 and returns the context URL along with the current user
+// principal path.
+//
+// domain can either be a domain name, an e-mail address or an URL. For
+// domain names and e-mail addresses, DNS SRV and TXT lookups are performed,
+// falling back to the well-known URI on the domain itself.
+func DiscoverPrincipal(ctx context.Context, c HTTPClient, resolver Resolver, service, domain string, trace DiscoveryTrace) (*url.URL, string, error) {
+	var candidates []*url.URL
+	if strings.Contains(domain, "://") {
+		u, err := url.Parse(domain)
+		if err != nil {
+			return nil, "", err
+		}
+		candidates = append(candidates, u)
+	} else {
+		if i := strings.LastIndexByte(domain, '@'); i >= 0 {
+			domain = domain[i+1:]
+		}
+		if resolver == nil {
+			resolver = net.DefaultResolver
+		}
+
+		if u, err := LookupContextURL(ctx, resolver, service, domain, trace); err == nil {
+			candidates = append(candidates, u)
+		}
+		candidates = append(candidates, &url.URL{
+			Scheme: "https",
+			Host:   domain,
+			Path:   "/.well-known/" + service,
+		})
+	}
+
+	// If the context path doesn't work, try the root as a last resort
+	last := candidates[len(candidates)-1]
+	if last.Path != "/" && last.Path != "" {
+		candidates = append(candidates, &url.URL{Scheme: last.Scheme, User: last.User, Host: last.Host, Path: "/"})
+	}
+
+	var err error
+	for _, u := range candidates {
+		var endpoint *url.URL
+		var principal string
+		endpoint, principal, err = FindCurrentUserPrincipal(ctx, c, u, trace)
+		if err == nil {
+			return endpoint, principal, nil
+		}
+		if ctx.Err() != nil {
+			return nil, "", ctx.Err()
+		}
+	}
+	return nil, "", fmt.Errorf("webdav: service discovery failed: %w", err)
+}
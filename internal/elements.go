@@ -22,6 +22,21 @@ var (
 	GetETagName          = xml.Name{Namespace, "getetag"}
 
 	CurrentUserPrincipalName = xml.Name{Namespace, "current-user-principal"}
+
+	SyncTokenName          = xml.Name{Namespace, "sync-token"}
+	SupportedReportSetName = xml.Name{Namespace, "supported-report-set"}
+	SyncCollectionName     = xml.Name{Namespace, "sync-collection"}
+
+	GetCTagName = xml.Name{"http://calendarserver.org/ns/", "getctag"}
+
+	SupportedReportName = xml.Name{Namespace, "supported-report"}
+	ValidSyncTokenName  = xml.Name{Namespace, "valid-sync-token"}
+
+	ErrorName       = xml.Name{Namespace, "error"}
+	MultiStatusName = xml.Name{Namespace, "multistatus"}
+
+	MkcolName         = xml.Name{Namespace, "mkcol"}
+	MkcolResponseName = xml.Name{Namespace, "mkcol-response"}
 )
 
 type Status struct {
@@ -155,10 +170,9 @@ func (resp *Response) Err() error {
 		}
 	}
 
-	return &HTTPError{
-		Code: resp.Status.Code,
-		Err:  err,
-	}
+	httpErr := newDAVError(resp.Status.Code, resp.Error, resp.ResponseDescription)
+	httpErr.Err = err
+	return httpErr
 }
 
 func (resp *Response) Path() (string, error) {
@@ -414,6 +428,38 @@ func (err *Error) Error() string {
 	return string(b)
 }
 
+// Conditions returns the names of the precondition and postcondition elements
+// contained in the error.
+func (err *Error) Conditions() []xml.Name {
+	var l []xml.Name
+	for _, raw := range err.Raw {
+		if name, ok := raw.XMLName(); ok {
+			l = append(l, name)
+		}
+	}
+	return l
+}
+
+// Href returns the path of the first DAV:href element found in a condition
+// element, if any.
+func (err *Error) Href() string {
+	for _, raw := range err.Raw {
+		if _, ok := raw.XMLName(); !ok {
+			continue
+		}
+		var cond struct {
+			Hrefs []Href `xml:"DAV: href"`
+		}
+		if err := raw.Decode(&cond); err != nil {
+			continue
+		}
+		if len(cond.Hrefs) > 0 {
+			return cond.Hrefs[0].Path
+		}
+	}
+	return ""
+}
+
 // https://tools.ietf.org/html/rfc4918#section-15.2
 type DisplayName struct {
 	XMLName xml.Name `xml:"DAV: displayname"`
@@ -430,14 +476,43 @@ type CurrentUserPrincipal struct {
 // https://tools.ietf.org/html/rfc4918#section-14.19
 type PropertyUpdate struct {
 	XMLName xml.Name `xml:"DAV: propertyupdate"`
-	Remove  []Remove `xml:"remove"`
-	Set     []Set    `xml:"set"`
+	// Instructions contains the DAV:set and DAV:remove elements, in document
+	// order.
+	Instructions []PropertyUpdateInstruction `xml:",any"`
 }
 
+// PropertyUpdateInstruction is a DAV:set or DAV:remove element.
+//
 // https://tools.ietf.org/html/rfc4918#section-14.23
-type Remove struct {
-	XMLName xml.Name `xml:"DAV: remove"`
-	Prop    Prop     `xml:"prop"`
+// https://tools.ietf.org/html/rfc4918#section-14.26
+type PropertyUpdateInstruction struct {
+	XMLName xml.Name
+	Prop    Prop `xml:"prop"`
+}
+
+var (
+	setName    = xml.Name{Namespace, "set"}
+	removeName = xml.Name{Namespace, "remove"}
+)
+
+// NewSetInstruction creates a DAV:set element.
+func NewSetInstruction(prop Prop) PropertyUpdateInstruction {
+	return PropertyUpdateInstruction{XMLName: setName, Prop: prop}
+}
+
+// NewRemoveInstruction creates a DAV:remove element.
+func NewRemoveInstruction(prop Prop) PropertyUpdateInstruction {
+	return PropertyUpdateInstruction{XMLName: removeName, Prop: prop}
+}
+
+// IsSet returns true if the instruction is a DAV:set element.
+func (inst *PropertyUpdateInstruction) IsSet() bool {
+	return inst.XMLName == setName
+}
+
+// IsRemove returns true if the instruction is a DAV:remove element.
+func (inst *PropertyUpdateInstruction) IsRemove() bool {
+	return inst.XMLName == removeName
 }
 
 // https://tools.ietf.org/html/rfc4918#section-14.26
@@ -446,6 +521,83 @@ type Set struct {
 	Prop    Prop     `xml:"prop"`
 }
 
+// https://tools.ietf.org/html/rfc5689#section-5.1
+type Mkcol struct {
+	XMLName xml.Name
+	Set     []Set `xml:"DAV: set"`
+}
+
+// https://tools.ietf.org/html/rfc5689#section-5.2
+type MkcolResponse struct {
+	XMLName   xml.Name
+	PropStats []PropStat `xml:"DAV: propstat"`
+}
+
+func (resp *MkcolResponse) Error() string {
+	var failed []string
+	for _, propstat := range resp.PropStats {
+		if propstat.Status.Code == http.StatusFailedDependency {
+			continue
+		}
+		for _, raw := range propstat.Prop.Raw {
+			if name, ok := raw.XMLName(); ok {
+				failed = append(failed, name.Local)
+			}
+		}
+	}
+	return fmt.Sprintf("failed to set properties: %v", strings.Join(failed, ", "))
+}
+
+// https://tools.ietf.org/html/rfc4918#section-14.11
+type LockInfo struct {
+	XMLName   xml.Name  `xml:"DAV: lockinfo"`
+	LockScope LockScope `xml:"lockscope"`
+	LockType  LockType  `xml:"locktype"`
+	Owner     *Owner    `xml:"owner,omitempty"`
+}
+
+// https://tools.ietf.org/html/rfc4918#section-14.13
+type LockScope struct {
+	XMLName   xml.Name  `xml:"DAV: lockscope"`
+	Exclusive *struct{} `xml:"exclusive,omitempty"`
+	Shared    *struct{} `xml:"shared,omitempty"`
+}
+
+// https://tools.ietf.org/html/rfc4918#section-14.15
+type LockType struct {
+	XMLName xml.Name  `xml:"DAV: locktype"`
+	Write   *struct{} `xml:"write,omitempty"`
+}
+
+// https://tools.ietf.org/html/rfc4918#section-14.17
+type Owner struct {
+	XMLName xml.Name `xml:"DAV: owner"`
+	Text    string   `xml:",chardata"`
+	Href    string   `xml:"href,omitempty"`
+}
+
+// https://tools.ietf.org/html/rfc4918#section-15.8
+type LockDiscovery struct {
+	XMLName    xml.Name     `xml:"DAV: lockdiscovery"`
+	ActiveLock []ActiveLock `xml:"activelock"`
+}
+
+// https://tools.ietf.org/html/rfc4918#section-14.1
+type ActiveLock struct {
+	XMLName   xml.Name  `xml:"DAV: activelock"`
+	LockScope LockScope `xml:"lockscope"`
+	LockType  LockType  `xml:"locktype"`
+	Depth     string    `xml:"depth"`
+	Owner     *Owner    `xml:"owner,omitempty"`
+	Timeout   string    `xml:"timeout,omitempty"`
+	LockToken *struct {
+		Href string `xml:"href"`
+	} `xml:"locktoken,omitempty"`
+	LockRoot struct {
+		Href Href `xml:"href"`
+	} `xml:"lockroot"`
+}
+
 // https://tools.ietf.org/html/rfc6578#section-6.1
 type SyncCollectionQuery struct {
 	XMLName   xml.Name `xml:"DAV: sync-collection"`
@@ -455,6 +607,40 @@ type SyncCollectionQuery struct {
 	Prop      *Prop    `xml:"prop"`
 }
 
+// https://tools.ietf.org/html/rfc6578#section-6.2
+type SyncToken struct {
+	XMLName xml.Name `xml:"DAV: sync-token"`
+	Token   string   `xml:",chardata"`
+}
+
+// https://github.com/apple/ccs-calendarserver/blob/master/doc/Extensions/caldav-ctag.txt
+type GetCTag struct {
+	XMLName xml.Name `xml:"http://calendarserver.org/ns/ getctag"`
+	CTag    string   `xml:",chardata"`
+}
+
+// https://tools.ietf.org/html/rfc3253#section-3.1.5
+type SupportedReportSet struct {
+	XMLName          xml.Name          `xml:"DAV: supported-report-set"`
+	SupportedReports []SupportedReport `xml:"supported-report"`
+}
+
+type SupportedReport struct {
+	Report struct {
+		Raw RawXMLValue `xml:",any"`
+	} `xml:"report"`
+}
+
+func NewSupportedReportSet(names ...xml.Name) *SupportedReportSet {
+	var set SupportedReportSet
+	for _, name := range names {
+		var report SupportedReport
+		report.Report.Raw = *NewRawXMLElement(name, nil, nil)
+		set.SupportedReports = append(set.SupportedReports, report)
+	}
+	return &set
+}
+
 // https://tools.ietf.org/html/rfc5323#section-5.17
 type Limit struct {
 	XMLName  xml.Name `xml:"DAV: limit"`
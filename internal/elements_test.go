@@ -38,6 +38,8 @@ func TestResponse_Err_error(t *testing.T) {
 		t.Errorf("Multistatus.Get() = %T, expected an *HTTPError", err)
 	} else if httpErr.Code != 423 {
 		t.Errorf("HTTPError.Code = %v, expected 423", httpErr.Code)
+	} else if !httpErr.HasCondition(xml.Name{Namespace, "lock-token-submitted"}) {
+		t.Errorf("HTTPError.Conditions = %v, expected DAV:lock-token-submitted", httpErr.Conditions)
 	}
 }
 
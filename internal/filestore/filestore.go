@@ -0,0 +1,420 @@
+// Package filestore implements the local filesystem layout shared by the
+// CalDAV and CardDAV storage backends.
+//
+// Each collection is stored in its own directory, with its metadata in a JSON
+// sidecar file. Each object is stored in its own file. Changes are recorded in
+// a per-collection change log, which supports collection synchronization and
+// indexes object UIDs.
+//
+// A Store doesn't synchronize accesses, callers are responsible for locking.
+package filestore
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-webdav"
+	"github.com/emersion/go-webdav/internal"
+)
+
+// DeadProperty is the JSON representation of an arbitrary property.
+type DeadProperty struct {
+	Space string `json:"space"`
+	Local string `json:"local"`
+	XML   string `json:"xml"`
+}
+
+// EncodeDeadProps converts properties to their JSON representation.
+func EncodeDeadProps(props []internal.Property) []DeadProperty {
+	var l []DeadProperty
+	for _, prop := range props {
+		l = append(l, DeadProperty{
+			Space: prop.XMLName.Space,
+			Local: prop.XMLName.Local,
+			XML:   string(prop.Raw),
+		})
+	}
+	return l
+}
+
+// DecodeDeadProps converts properties from their JSON representation.
+func DecodeDeadProps(l []DeadProperty) []internal.Property {
+	var props []internal.Property
+	for _, prop := range l {
+		props = append(props, internal.Property{
+			XMLName: xml.Name{Space: prop.Space, Local: prop.Local},
+			Raw:     []byte(prop.XML),
+		})
+	}
+	return props
+}
+
+// Object is an object stored in a collection.
+type Object struct {
+	Name    string
+	ModTime time.Time
+	Data    []byte
+	ETag    string
+}
+
+// UIDConflictError is returned by Store.PutObject if another object of the
+// collection already uses the UID.
+type UIDConflictError struct {
+	// Name is the name of the conflicting object.
+	Name string
+}
+
+func (err *UIDConflictError) Error() string {
+	return fmt.Sprintf("storage: UID already used by object %q", err.Name)
+}
+
+// Store stores collections in a local directory.
+//
+// Methods which modify the store, i.e. the Create, Delete, Put and Write
+// methods, must not be called concurrently with other methods.
+type Store struct {
+	dir              string
+	homeSetPath      string
+	metadataFilename string
+	parseUID         func(data []byte) (string, error)
+}
+
+// New creates a new store in dir. The directory is created if it doesn't
+// exist.
+//
+// Collections are exposed as direct children of homeSetPath, which must be
+// absolute. Their metadata is stored in a file named metadataFilename, which
+// must start with a dot so that it can't clash with object names. parseUID
+// returns the UID of an object from its data.
+func New(dir, homeSetPath, metadataFilename string, parseUID func(data []byte) (string, error)) (*Store, error) {
+	if !strings.HasSuffix(homeSetPath, "/") {
+		homeSetPath += "/"
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &Store{
+		dir:              dir,
+		homeSetPath:      homeSetPath,
+		metadataFilename: metadataFilename,
+		parseUID:         parseUID,
+	}, nil
+}
+
+// ErrFromOS converts a filesystem error to an HTTP error.
+func ErrFromOS(err error) error {
+	if os.IsNotExist(err) {
+		return webdav.NewHTTPError(http.StatusNotFound, err)
+	} else if os.IsPermission(err) {
+		return webdav.NewHTTPError(http.StatusForbidden, err)
+	}
+	return err
+}
+
+// validName reports whether a path segment can safely be used as a file
+// name.
+func validName(name string) bool {
+	return name != "" && !strings.HasPrefix(name, ".") &&
+		!strings.ContainsAny(name, "/\\\x00") && filepath.Base(name) == name
+}
+
+// HomeSetPath returns the path of the home set.
+func (s *Store) HomeSetPath() string {
+	return s.homeSetPath
+}
+
+// SplitPath splits a request path into a collection name and an object name,
+// relative to the home set. The object name is empty for collection paths.
+func (s *Store) SplitPath(p string) (collName, objName string, err error) {
+	p = path.Clean(p)
+	rel := strings.TrimPrefix(p, strings.TrimSuffix(s.homeSetPath, "/"))
+	if rel == p || !strings.HasPrefix(rel, "/") {
+		return "", "", webdav.NewHTTPError(http.StatusNotFound, fmt.Errorf("storage: path %q outside of home set", p))
+	}
+
+	parts := strings.Split(strings.TrimPrefix(rel, "/"), "/")
+	if len(parts) > 2 {
+		return "", "", webdav.NewHTTPError(http.StatusNotFound, fmt.Errorf("storage: invalid path %q", p))
+	}
+	for _, part := range parts {
+		if !validName(part) {
+			return "", "", webdav.NewHTTPError(http.StatusNotFound, fmt.Errorf("storage: invalid path %q", p))
+		}
+	}
+
+	collName = parts[0]
+	if len(parts) == 2 {
+		objName = parts[1]
+	}
+	return collName, objName, nil
+}
+
+// CollectionPath returns the request path of a collection.
+func (s *Store) CollectionPath(collName string) string {
+	return s.homeSetPath + collName + "/"
+}
+
+// ObjectPath returns the request path of an object.
+func (s *Store) ObjectPath(collName, objName string) string {
+	return s.homeSetPath + collName + "/" + objName
+}
+
+// writeFileAtomic writes a file by creating a temporary file in the same
+// directory and renaming it, so that readers never see partial writes.
+func writeFileAtomic(filename string, data []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(filename), ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), filename)
+}
+
+func etagFromData(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// ReadMetadata decodes the JSON metadata of a collection into v. A 404 error
+// is returned if the collection doesn't exist.
+func (s *Store) ReadMetadata(collName string, v interface{}) error {
+	data, err := ioutil.ReadFile(filepath.Join(s.dir, collName, s.metadataFilename))
+	if err != nil {
+		return ErrFromOS(err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("storage: failed to parse metadata of collection %q: %v", collName, err)
+	}
+	return nil
+}
+
+// WriteMetadata encodes v as the JSON metadata of a collection.
+func (s *Store) WriteMetadata(collName string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "\t")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(s.dir, collName, s.metadataFilename), data)
+}
+
+// CreateCollection creates a collection with the specified metadata. A 405
+// error is returned if the collection already exists.
+func (s *Store) CreateCollection(collName string, meta interface{}) error {
+	dir := filepath.Join(s.dir, collName)
+	if err := os.Mkdir(dir, 0700); os.IsExist(err) {
+		return webdav.NewHTTPError(http.StatusMethodNotAllowed, fmt.Errorf("storage: collection %q already exists", s.CollectionPath(collName)))
+	} else if err != nil {
+		return ErrFromOS(err)
+	}
+
+	id, err := newSyncID()
+	if err != nil {
+		os.RemoveAll(dir)
+		return err
+	}
+	state := syncState{ID: id, Changes: make(map[string]*syncChange)}
+	if err := s.writeSyncState(collName, &state); err != nil {
+		os.RemoveAll(dir)
+		return err
+	}
+
+	if err := s.WriteMetadata(collName, meta); err != nil {
+		os.RemoveAll(dir)
+		return err
+	}
+	return nil
+}
+
+// DeleteCollection deletes a collection and all of its objects.
+func (s *Store) DeleteCollection(collName string) error {
+	return ErrFromOS(os.RemoveAll(filepath.Join(s.dir, collName)))
+}
+
+// ListCollections returns the names of the collection candidates. Callers
+// should skip the ones whose metadata can't be found.
+func (s *Store) ListCollections() ([]string, error) {
+	entries, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, ErrFromOS(err)
+	}
+
+	var l []string
+	for _, entry := range entries {
+		if entry.IsDir() && validName(entry.Name()) {
+			l = append(l, entry.Name())
+		}
+	}
+	return l, nil
+}
+
+// ReadObject reads an object from disk.
+func (s *Store) ReadObject(collName, objName string) (*Object, error) {
+	filename := filepath.Join(s.dir, collName, objName)
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, ErrFromOS(err)
+	}
+	fi, err := os.Stat(filename)
+	if err != nil {
+		return nil, ErrFromOS(err)
+	}
+
+	return &Object{
+		Name:    objName,
+		ModTime: fi.ModTime(),
+		Data:    data,
+		ETag:    etagFromData(data),
+	}, nil
+}
+
+// ListObjects reads all objects of a collection from disk.
+func (s *Store) ListObjects(collName string) ([]Object, error) {
+	entries, err := ioutil.ReadDir(filepath.Join(s.dir, collName))
+	if err != nil {
+		return nil, ErrFromOS(err)
+	}
+
+	var l []Object
+	for _, entry := range entries {
+		if entry.IsDir() || !validName(entry.Name()) {
+			continue
+		}
+		obj, err := s.ReadObject(collName, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		l = append(l, *obj)
+	}
+	return l, nil
+}
+
+// checkConditions checks the If-Match and If-None-Match conditions against
+// the current object, which is nil if it doesn't exist.
+func checkConditions(cur *Object, ifMatch, ifNoneMatch webdav.ConditionalMatch) error {
+	if ifNoneMatch.IsSet() && cur != nil {
+		if ifNoneMatch.IsWildcard() {
+			return webdav.NewHTTPError(http.StatusPreconditionFailed, fmt.Errorf("storage: object already exists"))
+		}
+		etag, err := ifNoneMatch.ETag()
+		if err != nil {
+			return webdav.NewHTTPError(http.StatusBadRequest, err)
+		}
+		if etag == cur.ETag {
+			return webdav.NewHTTPError(http.StatusPreconditionFailed, fmt.Errorf("storage: object ETag matches If-None-Match"))
+		}
+	}
+
+	if ifMatch.IsSet() {
+		if cur == nil {
+			return webdav.NewHTTPError(http.StatusPreconditionFailed, fmt.Errorf("storage: object doesn't exist"))
+		}
+		if !ifMatch.IsWildcard() {
+			etag, err := ifMatch.ETag()
+			if err != nil {
+				return webdav.NewHTTPError(http.StatusBadRequest, err)
+			}
+			if etag != cur.ETag {
+				return webdav.NewHTTPError(http.StatusPreconditionFailed, fmt.Errorf("storage: object ETag doesn't match If-Match"))
+			}
+		}
+	}
+
+	return nil
+}
+
+// PutObject creates or updates an object of an existing collection.
+//
+// A *UIDConflictError is returned if another object already uses the UID.
+// The UIDs are looked up in the change log, so only objects which weren't
+// written by the store are parsed. The If-Match and If-None-Match conditions
+// are checked against the current object, if any.
+func (s *Store) PutObject(collName, objName string, data []byte, uid string, ifMatch, ifNoneMatch webdav.ConditionalMatch) (obj *Object, created bool, err error) {
+	state, err := s.readSyncState(collName)
+	if err != nil {
+		return nil, false, err
+	}
+	name, parsed, err := s.findUID(collName, state, uid, objName)
+	if err != nil {
+		return nil, false, err
+	} else if name != "" {
+		return nil, false, &UIDConflictError{Name: name}
+	}
+	for name, uid := range parsed {
+		state.Changes[name].UID = uid
+	}
+
+	cur, err := s.ReadObject(collName, objName)
+	if internal.IsNotFound(err) {
+		cur = nil
+	} else if err != nil {
+		return nil, false, err
+	}
+	if err := checkConditions(cur, ifMatch, ifNoneMatch); err != nil {
+		return nil, false, err
+	}
+
+	if err := writeFileAtomic(filepath.Join(s.dir, collName, objName), data); err != nil {
+		return nil, false, ErrFromOS(err)
+	}
+	if err := s.recordChange(collName, state, objName, uid, false); err != nil {
+		return nil, false, err
+	}
+
+	obj, err = s.ReadObject(collName, objName)
+	if err != nil {
+		return nil, false, err
+	}
+	return obj, cur == nil, nil
+}
+
+// DeleteObject deletes an object.
+func (s *Store) DeleteObject(collName, objName string) error {
+	filename := filepath.Join(s.dir, collName, objName)
+	if _, err := os.Stat(filename); err != nil {
+		return ErrFromOS(err)
+	}
+	state, err := s.readSyncState(collName)
+	if err != nil {
+		return err
+	}
+
+	// The deletion is recorded first, so that an object can't disappear
+	// without a change if the change log can't be written
+	var uid string
+	if change := state.Changes[objName]; change != nil {
+		uid = change.UID
+	}
+	if err := s.recordChange(collName, state, objName, "", true); err != nil {
+		return err
+	}
+	if err := os.Remove(filename); err != nil {
+		// The object is still there, record it again
+		if rollbackErr := s.recordChange(collName, state, objName, uid, false); rollbackErr != nil {
+			return fmt.Errorf("storage: failed to delete object %q (%v) and to roll back the change log: %v", objName, err, rollbackErr)
+		}
+		return ErrFromOS(err)
+	}
+	return nil
+}
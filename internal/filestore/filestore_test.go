@@ -0,0 +1,155 @@
+package filestore
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-webdav/internal"
+)
+
+// parseTestUID parses objects of the form "UID:<uid>".
+func parseTestUID(calls *int) func(data []byte) (string, error) {
+	return func(data []byte) (string, error) {
+		*calls++
+		s := string(data)
+		if !strings.HasPrefix(s, "UID:") {
+			return "", errors.New("missing UID")
+		}
+		return strings.TrimPrefix(s, "UID:"), nil
+	}
+}
+
+func TestStore_PutObject_uidIndex(t *testing.T) {
+	dir := t.TempDir()
+	calls := 0
+	s, err := New(dir, "/home/", ".meta.json", parseTestUID(&calls))
+	if err != nil {
+		t.Fatalf("New() = %v", err)
+	}
+	if err := s.CreateCollection("coll", struct{}{}); err != nil {
+		t.Fatalf("CreateCollection() = %v", err)
+	}
+
+	put := func(name, uid string) error {
+		_, _, err := s.PutObject("coll", name, []byte("UID:"+uid), uid, "", "")
+		return err
+	}
+
+	for _, name := range []string{"a", "b", "c"} {
+		if err := put(name, name); err != nil {
+			t.Fatalf("PutObject(%q) = %v", name, err)
+		}
+	}
+	// Updating an object with its own UID isn't a conflict
+	if err := put("a", "a"); err != nil {
+		t.Fatalf("PutObject() = %v", err)
+	}
+
+	var conflict *UIDConflictError
+	if err := put("d", "b"); !errors.As(err, &conflict) || conflict.Name != "b" {
+		t.Errorf("PutObject() with a duplicate UID = %v, expected a conflict with %q", err, "b")
+	}
+	if calls != 0 {
+		t.Errorf("objects written by the store were parsed %v times", calls)
+	}
+
+	// Objects added behind the store's back are parsed once
+	if err := ioutil.WriteFile(filepath.Join(dir, "coll", "e"), []byte("UID:e"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "coll", "f"), []byte("invalid"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := put("g", "e"); !errors.As(err, &conflict) || conflict.Name != "e" {
+		t.Errorf("PutObject() with the UID of an external object = %v, expected a conflict with %q", err, "e")
+	}
+	if err := put("g", "g"); err != nil {
+		t.Fatalf("PutObject() = %v", err)
+	}
+	calls = 0
+	if err := put("h", "h"); err != nil {
+		t.Fatalf("PutObject() = %v", err)
+	}
+	// Only the object without a valid UID is parsed again
+	if calls != 1 {
+		t.Errorf("objects were parsed %v times, expected 1", calls)
+	}
+
+	// Deleted objects release their UID
+	if err := s.DeleteObject("coll", "b"); err != nil {
+		t.Fatalf("DeleteObject() = %v", err)
+	}
+	if err := put("d", "b"); err != nil {
+		t.Errorf("PutObject() with the UID of a deleted object = %v", err)
+	}
+}
+
+func TestStore_findUID(t *testing.T) {
+	dir := t.TempDir()
+	calls := 0
+	s, err := New(dir, "/home/", ".meta.json", parseTestUID(&calls))
+	if err != nil {
+		t.Fatalf("New() = %v", err)
+	}
+	if err := s.CreateCollection("coll", struct{}{}); err != nil {
+		t.Fatalf("CreateCollection() = %v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "coll", "a"), []byte("UID:a"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := s.readSyncState("coll")
+	if err != nil {
+		t.Fatalf("readSyncState() = %v", err)
+	}
+	name, parsed, err := s.findUID("coll", state, "a", "")
+	if err != nil {
+		t.Fatalf("findUID() = %v", err)
+	}
+	if name != "a" || parsed["a"] != "a" {
+		t.Errorf("findUID() = %q, %v, expected %q and the parsed UID", name, parsed, "a")
+	}
+	// The parsed UIDs are only saved by PutObject
+	if uid := state.Changes["a"].UID; uid != "" {
+		t.Errorf("findUID() modified the change log, UID = %q", uid)
+	}
+}
+
+func TestStore_DeleteObject(t *testing.T) {
+	calls := 0
+	s, err := New(t.TempDir(), "/home/", ".meta.json", parseTestUID(&calls))
+	if err != nil {
+		t.Fatalf("New() = %v", err)
+	}
+	if err := s.CreateCollection("coll", struct{}{}); err != nil {
+		t.Fatalf("CreateCollection() = %v", err)
+	}
+	if _, _, err := s.PutObject("coll", "a", []byte("UID:a"), "a", "", ""); err != nil {
+		t.Fatalf("PutObject() = %v", err)
+	}
+	token, err := s.SyncToken("coll")
+	if err != nil {
+		t.Fatalf("SyncToken() = %v", err)
+	}
+
+	if err := s.DeleteObject("coll", "missing"); !internal.IsNotFound(err) {
+		t.Errorf("DeleteObject() on a missing object = %v, expected not found", err)
+	}
+	if cur, err := s.SyncToken("coll"); err != nil || cur != token {
+		t.Errorf("SyncToken() after a failed deletion = %q, %v, expected %q", cur, err, token)
+	}
+
+	if err := s.DeleteObject("coll", "a"); err != nil {
+		t.Fatalf("DeleteObject() = %v", err)
+	}
+	res, err := s.Sync("coll", token, 0)
+	if err != nil {
+		t.Fatalf("Sync() = %v", err)
+	}
+	if len(res.Deleted) != 1 || res.Deleted[0] != "a" {
+		t.Errorf("Sync() after DeleteObject() = %v, expected %q to be deleted", res.Deleted, "a")
+	}
+}
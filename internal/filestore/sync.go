@@ -0,0 +1,252 @@
+package filestore
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/emersion/go-webdav/internal"
+)
+
+// syncFilename is the name of the JSON sidecar file holding the change log
+// of a collection.
+const syncFilename = ".sync.json"
+
+const syncTokenPrefix = "urn:x-go-webdav:sync:"
+
+// syncState is the change log of a collection. Each change to an object
+// increments the sequence number, which is recorded along with the object
+// name and UID. Deleted objects are kept as tombstones.
+type syncState struct {
+	ID      string                 `json:"id"`
+	Seq     uint64                 `json:"seq"`
+	Changes map[string]*syncChange `json:"changes"`
+}
+
+type syncChange struct {
+	Seq     uint64 `json:"seq"`
+	Deleted bool   `json:"deleted,omitempty"`
+	// UID is empty if the object wasn't written by the store, in which case
+	// it's filled in when needed
+	UID string `json:"uid,omitempty"`
+}
+
+func newSyncID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b[:]), nil
+}
+
+func newInvalidSyncTokenError() error {
+	return internal.NewConditionError(http.StatusForbidden, internal.ValidSyncTokenName)
+}
+
+func (state *syncState) token(seq uint64) string {
+	return syncTokenPrefix + state.ID + ":" + strconv.FormatUint(seq, 10)
+}
+
+// parseToken returns the sequence number of a sync token issued for this
+// change log.
+func (state *syncState) parseToken(token string) (uint64, error) {
+	s := strings.TrimPrefix(token, syncTokenPrefix)
+	i := strings.LastIndexByte(s, ':')
+	if s == token || i < 0 || s[:i] != state.ID {
+		return 0, newInvalidSyncTokenError()
+	}
+	seq, err := strconv.ParseUint(s[i+1:], 10, 64)
+	if err != nil || seq > state.Seq {
+		return 0, newInvalidSyncTokenError()
+	}
+	return seq, nil
+}
+
+func (state *syncState) record(name, uid string, deleted bool) {
+	state.Seq++
+	state.Changes[name] = &syncChange{Seq: state.Seq, Deleted: deleted, UID: uid}
+}
+
+// readSyncState reads the change log of a collection. Objects added or
+// removed behind the store's back are recorded as changes, in a deterministic
+// order so that the result is stable until the change log is written.
+func (s *Store) readSyncState(collName string) (*syncState, error) {
+	dir := filepath.Join(s.dir, collName)
+
+	var state syncState
+	data, err := ioutil.ReadFile(filepath.Join(dir, syncFilename))
+	if os.IsNotExist(err) {
+		state.Changes = make(map[string]*syncChange)
+	} else if err != nil {
+		return nil, ErrFromOS(err)
+	} else if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("storage: failed to parse change log of collection %q: %v", collName, err)
+	}
+	if state.Changes == nil {
+		state.Changes = make(map[string]*syncChange)
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, ErrFromOS(err)
+	}
+	exists := make(map[string]bool)
+	for _, entry := range entries {
+		if entry.IsDir() || !validName(entry.Name()) {
+			continue
+		}
+		exists[entry.Name()] = true
+		if change := state.Changes[entry.Name()]; change == nil || change.Deleted {
+			state.record(entry.Name(), "", false)
+		}
+	}
+
+	var missing []string
+	for name, change := range state.Changes {
+		if !change.Deleted && !exists[name] {
+			missing = append(missing, name)
+		}
+	}
+	sort.Strings(missing)
+	for _, name := range missing {
+		state.record(name, "", true)
+	}
+
+	return &state, nil
+}
+
+func (s *Store) writeSyncState(collName string, state *syncState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(s.dir, collName, syncFilename), data)
+}
+
+// recordChange records a change to an object in the change log of a
+// collection.
+func (s *Store) recordChange(collName string, state *syncState, objName, uid string, deleted bool) error {
+	if state.ID == "" {
+		// Collections created without a change log get an ID on first
+		// change, which invalidates the tokens issued so far
+		var err error
+		if state.ID, err = newSyncID(); err != nil {
+			return err
+		}
+	}
+	state.record(objName, uid, deleted)
+	return s.writeSyncState(collName, state)
+}
+
+// findUID returns the name of the object using the specified UID, ignoring
+// the object named ignore. An empty name is returned if there is none.
+//
+// Objects which weren't written by the store have an unknown UID in the change
+// log: they're parsed, and their UID is returned in parsed, indexed by object
+// name, so that the caller can save it with the next change. state isn't
+// modified.
+func (s *Store) findUID(collName string, state *syncState, uid, ignore string) (string, map[string]string, error) {
+	parsed := make(map[string]string)
+	for name, change := range state.Changes {
+		if change.Deleted || name == ignore {
+			continue
+		}
+		changeUID := change.UID
+		if changeUID == "" {
+			data, err := ioutil.ReadFile(filepath.Join(s.dir, collName, name))
+			if err != nil {
+				return "", nil, ErrFromOS(err)
+			}
+			if changeUID, err = s.parseUID(data); err != nil {
+				// Objects without a valid UID can't conflict
+				continue
+			}
+			parsed[name] = changeUID
+		}
+		if changeUID == uid {
+			return name, parsed, nil
+		}
+	}
+	return "", parsed, nil
+}
+
+// SyncToken returns the current sync token of a collection.
+func (s *Store) SyncToken(collName string) (string, error) {
+	state, err := s.readSyncState(collName)
+	if err != nil {
+		return "", err
+	}
+	return state.token(state.Seq), nil
+}
+
+// SyncResult is the result of a collection synchronization.
+type SyncResult struct {
+	SyncToken string
+	Updated   []Object
+	// Deleted contains the names of the deleted objects.
+	Deleted   []string
+	Truncated bool
+}
+
+// Sync returns the changes made to a collection since the specified sync
+// token, or all objects if the token is empty. If limit is positive, at most
+// limit changes are returned and the result is truncated.
+func (s *Store) Sync(collName, token string, limit int) (*SyncResult, error) {
+	state, err := s.readSyncState(collName)
+	if err != nil {
+		return nil, err
+	}
+
+	var since uint64
+	if token != "" {
+		since, err = state.parseToken(token)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	type namedChange struct {
+		name string
+		*syncChange
+	}
+	var changes []namedChange
+	for name, change := range state.Changes {
+		// An initial sync only needs to return existing objects
+		if change.Seq <= since || (token == "" && change.Deleted) {
+			continue
+		}
+		changes = append(changes, namedChange{name, change})
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Seq < changes[j].Seq
+	})
+
+	res := SyncResult{SyncToken: state.token(state.Seq)}
+	if limit > 0 && len(changes) > limit {
+		changes = changes[:limit]
+		res.SyncToken = state.token(changes[len(changes)-1].Seq)
+		res.Truncated = true
+	}
+
+	for _, change := range changes {
+		if change.Deleted {
+			res.Deleted = append(res.Deleted, change.name)
+			continue
+		}
+		obj, err := s.ReadObject(collName, change.name)
+		if err != nil {
+			return nil, err
+		}
+		res.Updated = append(res.Updated, *obj)
+	}
+
+	return &res, nil
+}
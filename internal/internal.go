@@ -2,9 +2,13 @@
 package internal
 
 import (
+	"encoding/xml"
 	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // Depth indicates whether a request applies to the resource's members. It's
@@ -68,9 +72,91 @@ func FormatOverwrite(overwrite bool) string {
 	}
 }
 
+// ParseTimeout parses a Timeout header, as defined in RFC 4918 section 10.7.
+// Only the first value is taken into account. A zero duration is returned for
+// infinite timeouts.
+func ParseTimeout(s string) (time.Duration, error) {
+	s = strings.TrimSpace(strings.SplitN(s, ",", 2)[0])
+	if strings.EqualFold(s, "Infinite") {
+		return 0, nil
+	}
+	if len(s) > len("Second-") && strings.EqualFold(s[:len("Second-")], "Second-") {
+		sec, err := strconv.ParseUint(s[len("Second-"):], 10, 32)
+		if err == nil {
+			return time.Duration(sec) * time.Second, nil
+		}
+	}
+	return 0, fmt.Errorf("webdav: invalid Timeout value")
+}
+
+// FormatTimeout formats a Timeout header. A zero duration is formatted as an
+// infinite timeout.
+func FormatTimeout(timeout time.Duration) string {
+	if timeout <= 0 {
+		return "Infinite"
+	}
+	sec := (timeout + time.Second - 1) / time.Second
+	return fmt.Sprintf("Second-%d", sec)
+}
+
+// Property is a WebDAV property.
+type Property struct {
+	XMLName xml.Name
+	// Status is the HTTP status code returned by the server for this
+	// property, e.g. 200 if the property exists or 404 if it doesn't. It's
+	// ignored when sending properties.
+	Status int
+	// Raw is the XML encoding of the property element, including the
+	// element itself. It's empty if Status isn't 2xx.
+	Raw []byte
+}
+
+// Err returns an error if the server didn't return a 2xx status for the
+// property.
+func (p *Property) Err() error {
+	if p.Status == 0 || p.Status/100 == 2 {
+		return nil
+	}
+	return &HTTPError{
+		Code: p.Status,
+		Err:  fmt.Errorf("property <%v %v>: %v", p.XMLName.Space, p.XMLName.Local, http.StatusText(p.Status)),
+	}
+}
+
+// Decode unmarshals the property's XML value into v.
+func (p *Property) Decode(v interface{}) error {
+	if err := p.Err(); err != nil {
+		return err
+	}
+	return xml.Unmarshal(p.Raw, v)
+}
+
+// Text returns the character data of the property.
+func (p *Property) Text() (string, error) {
+	var v struct {
+		Value string `xml:",chardata"`
+	}
+	if err := p.Decode(&v); err != nil {
+		return "", err
+	}
+	return v.Value, nil
+}
+
+// HTTPError is an error associated with an HTTP status code.
+//
+// On the client side, Conditions, Href and Description are populated from the
+// DAV:error and DAV:responsedescription elements sent by the server, if any.
 type HTTPError struct {
 	Code int
-	Err  error
+	// Conditions contains the names of the precondition and postcondition
+	// elements of the DAV:error body, e.g. DAV:lock-token-submitted.
+	Conditions []xml.Name
+	// Href is the path of the conflicting resource reported by a condition
+	// element, if any.
+	Href string
+	// Description is the human-readable DAV:responsedescription, if any.
+	Description string
+	Err         error
 }
 
 func HTTPErrorFromError(err error) *HTTPError {
@@ -80,7 +166,7 @@ func HTTPErrorFromError(err error) *HTTPError {
 	if httpErr, ok := err.(*HTTPError); ok {
 		return httpErr
 	} else {
-		return &HTTPError{http.StatusInternalServerError, err}
+		return &HTTPError{Code: http.StatusInternalServerError, Err: err}
 	}
 }
 
@@ -92,8 +178,70 @@ func IsNotFound(err error) bool {
 	return false
 }
 
+// HasCondition reports whether err is an *HTTPError carrying the specified
+// precondition or postcondition element.
+func HasCondition(err error, name xml.Name) bool {
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.HasCondition(name)
+	}
+	return false
+}
+
 func HTTPErrorf(code int, format string, a ...interface{}) *HTTPError {
-	return &HTTPError{code, fmt.Errorf(format, a...)}
+	return &HTTPError{Code: code, Err: fmt.Errorf(format, a...)}
+}
+
+// newDAVError creates an HTTPError from a DAV:error element and an optional
+// DAV:responsedescription.
+func newDAVError(code int, davErr *Error, desc string) *HTTPError {
+	httpErr := &HTTPError{Code: code, Description: desc}
+	if davErr != nil {
+		httpErr.Conditions = davErr.Conditions()
+		httpErr.Href = davErr.Href()
+	}
+	return httpErr
+}
+
+// NewConditionError creates an HTTPError carrying an empty precondition or
+// postcondition element.
+func NewConditionError(code int, name xml.Name) *HTTPError {
+	return &HTTPError{
+		Code:       code,
+		Conditions: []xml.Name{name},
+		Err: &Error{
+			Raw: []RawXMLValue{*NewRawXMLElement(name, nil, nil)},
+		},
+	}
+}
+
+// NewHrefConditionError creates an HTTPError carrying a precondition or
+// postcondition element with a DAV:href child, e.g. to reference a
+// conflicting resource.
+func NewHrefConditionError(code int, name xml.Name, href string) *HTTPError {
+	u := Href{Path: href}
+	child := NewRawXMLElement(xml.Name{Space: "DAV:", Local: "href"}, nil, []RawXMLValue{
+		{tok: xml.CharData(u.String())},
+	})
+	return &HTTPError{
+		Code:       code,
+		Conditions: []xml.Name{name},
+		Href:       href,
+		Err: &Error{
+			Raw: []RawXMLValue{*NewRawXMLElement(name, nil, []RawXMLValue{*child})},
+		},
+	}
+}
+
+// HasCondition reports whether the error carries the specified precondition
+// or postcondition element.
+func (err *HTTPError) HasCondition(name xml.Name) bool {
+	for _, cond := range err.Conditions {
+		if cond == name {
+			return true
+		}
+	}
+	return false
 }
 
 func (err *HTTPError) Error() string {
@@ -0,0 +1,70 @@
+package internal
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTimeout(t *testing.T) {
+	tests := []struct {
+		s       string
+		timeout time.Duration
+		err     bool
+	}{
+		{s: "Infinite", timeout: 0},
+		{s: "infinite", timeout: 0},
+		{s: "Second-3600", timeout: time.Hour},
+		{s: "second-42", timeout: 42 * time.Second},
+		{s: " Second-10 ", timeout: 10 * time.Second},
+		{s: "Second-10, Infinite", timeout: 10 * time.Second},
+		{s: "Infinite, Second-4100000000", timeout: 0},
+		{s: "", err: true},
+		{s: "Second-", err: true},
+		{s: "Second--1", err: true},
+		{s: "Second-abc", err: true},
+		{s: "Second-4294967296", err: true},
+		{s: "Minute-1", err: true},
+	}
+	for _, tc := range tests {
+		timeout, err := ParseTimeout(tc.s)
+		if tc.err {
+			if err == nil {
+				t.Errorf("ParseTimeout(%q) = %v, expected an error", tc.s, timeout)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseTimeout(%q) = %v", tc.s, err)
+		} else if timeout != tc.timeout {
+			t.Errorf("ParseTimeout(%q) = %v, expected %v", tc.s, timeout, tc.timeout)
+		}
+	}
+}
+
+func TestFormatTimeout(t *testing.T) {
+	tests := []struct {
+		timeout time.Duration
+		s       string
+	}{
+		{0, "Infinite"},
+		{-time.Second, "Infinite"},
+		{time.Hour, "Second-3600"},
+		// Partial seconds are rounded up
+		{1500 * time.Millisecond, "Second-2"},
+		{time.Nanosecond, "Second-1"},
+	}
+	for _, tc := range tests {
+		if s := FormatTimeout(tc.timeout); s != tc.s {
+			t.Errorf("FormatTimeout(%v) = %q, expected %q", tc.timeout, s, tc.s)
+		}
+		if tc.timeout < 0 {
+			continue
+		}
+		// Round-trip whole seconds
+		if tc.timeout%time.Second == 0 {
+			if timeout, err := ParseTimeout(FormatTimeout(tc.timeout)); err != nil || timeout != tc.timeout {
+				t.Errorf("ParseTimeout(FormatTimeout(%v)) = %v, %v", tc.timeout, timeout, err)
+			}
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"mime"
 	"net/http"
 	"net/url"
@@ -20,8 +21,13 @@ func ServeError(w http.ResponseWriter, err error) {
 
 	var errElt *Error
 	if errors.As(err, &errElt) {
-		w.WriteHeader(code)
-		ServeXML(w).Encode(errElt)
+		serveXMLWithStatus(w, code, errElt)
+		return
+	}
+
+	var mkcolResp *MkcolResponse
+	if errors.As(err, &mkcolResp) {
+		serveXMLWithStatus(w, code, mkcolResp)
 		return
 	}
 
@@ -39,7 +45,7 @@ func DecodeXMLRequest(r *http.Request, v interface{}) error {
 	}
 
 	if err := xml.NewDecoder(r.Body).Decode(v); err != nil {
-		return &HTTPError{http.StatusBadRequest, err}
+		return &HTTPError{Code: http.StatusBadRequest, Err: err}
 	}
 	return nil
 }
@@ -49,6 +55,38 @@ func IsRequestBodyEmpty(r *http.Request) bool {
 	return err == io.EOF
 }
 
+// ErrBodyTooLarge is returned by ReadRequestBody if the request body exceeds
+// the maximum size.
+var ErrBodyTooLarge = errors.New("webdav: request body too large")
+
+// ReadRequestBody reads the whole request body. If max is positive and the
+// body is larger than max bytes, ErrBodyTooLarge is returned.
+func ReadRequestBody(r *http.Request, max int64) ([]byte, error) {
+	if max <= 0 {
+		return ioutil.ReadAll(r.Body)
+	}
+	if r.ContentLength > max {
+		return nil, ErrBodyTooLarge
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(r.Body, max+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > max {
+		return nil, ErrBodyTooLarge
+	}
+	return data, nil
+}
+
+// serveXMLWithStatus writes an XML response with the specified status code.
+// The Content-Type header needs to be set before the status is written.
+func serveXMLWithStatus(w http.ResponseWriter, code int, v interface{}) error {
+	w.Header().Add("Content-Type", "application/xml; charset=\"utf-8\"")
+	w.WriteHeader(code)
+	w.Write([]byte(xml.Header))
+	return xml.NewEncoder(w).Encode(v)
+}
+
 func ServeXML(w http.ResponseWriter) *xml.Encoder {
 	w.Header().Add("Content-Type", "application/xml; charset=\"utf-8\"")
 	w.Write([]byte(xml.Header))
@@ -57,8 +95,7 @@ func ServeXML(w http.ResponseWriter) *xml.Encoder {
 
 func ServeMultiStatus(w http.ResponseWriter, ms *MultiStatus) error {
 	// TODO: streaming
-	w.WriteHeader(http.StatusMultiStatus)
-	return ServeXML(w).Encode(ms)
+	return serveXMLWithStatus(w, http.StatusMultiStatus, ms)
 }
 
 type Backend interface {
@@ -148,7 +185,7 @@ func (h *Handler) handlePropfind(w http.ResponseWriter, r *http.Request) error {
 		var err error
 		depth, err = ParseDepth(s)
 		if err != nil {
-			return &HTTPError{http.StatusBadRequest, err}
+			return &HTTPError{Code: http.StatusBadRequest, Err: err}
 		}
 	}
 
@@ -231,6 +268,143 @@ func NewPropFindResponse(path string, propfind *PropFind, props map[xml.Name]Pro
 	return resp, nil
 }
 
+// PropPatchFunc applies a single property update from a PROPPATCH request.
+// For removals, raw is an empty element.
+type PropPatchFunc func(raw *RawXMLValue, remove bool) error
+
+// NewPropPatchResponse applies a PROPPATCH request and builds the response.
+//
+// patch is called for each property to set or remove, in document order, so
+// that later instructions override earlier ones. Since PROPPATCH is
+// atomic, commit is only called if all properties could be applied, and
+// should persist the changes. If patch fails for some properties, the other
+// ones are reported with 424 Failed Dependency. If commit fails, all
+// properties are reported with its status.
+func NewPropPatchResponse(path string, update *PropertyUpdate, patch PropPatchFunc, commit func() error) (*Response, error) {
+	type result struct {
+		name xml.Name
+		code int
+	}
+	var results []result
+	failed := false
+
+	apply := func(prop *Prop, remove bool) {
+		for i := range prop.Raw {
+			raw := &prop.Raw[i]
+			name, ok := raw.XMLName()
+			if !ok {
+				continue
+			}
+
+			code := http.StatusOK
+			if err := patch(raw, remove); err != nil {
+				code = http.StatusConflict
+				var httpErr *HTTPError
+				if errors.As(err, &httpErr) {
+					code = httpErr.Code
+				}
+				failed = true
+			}
+			results = append(results, result{name, code})
+		}
+	}
+	// RFC 4918 section 9.2: instructions are processed in document order
+	for i := range update.Instructions {
+		inst := &update.Instructions[i]
+		if inst.IsSet() || inst.IsRemove() {
+			apply(&inst.Prop, inst.IsRemove())
+		}
+	}
+
+	if !failed && len(results) > 0 {
+		if err := commit(); err != nil {
+			code := HTTPErrorFromError(err).Code
+			for i := range results {
+				results[i].code = code
+			}
+		}
+	}
+
+	resp := &Response{Hrefs: []Href{{Path: path}}}
+	for _, res := range results {
+		code := res.code
+		if failed && code == http.StatusOK {
+			code = http.StatusFailedDependency
+		}
+		if err := resp.EncodeProp(code, NewRawXMLElement(res.name, nil, nil)); err != nil {
+			return nil, err
+		}
+	}
+	return resp, nil
+}
+
+// ParseSyncCollection checks a sync-collection REPORT request on a collection
+// which can't contain other collections, as defined in RFC 6578 section 3.2.
+// It returns the maximum number of results, or zero if unlimited.
+func ParseSyncCollection(sync *SyncCollectionQuery) (limit int, err error) {
+	// Both levels are equivalent if the collection has no child collection
+	if sync.SyncLevel != "1" && sync.SyncLevel != "infinite" {
+		return 0, HTTPErrorf(http.StatusBadRequest, "webdav: invalid sync-level %q", sync.SyncLevel)
+	}
+	if sync.Limit != nil {
+		if sync.Limit.NResults == 0 {
+			return 0, HTTPErrorf(http.StatusBadRequest, "webdav: invalid limit in sync-collection request")
+		}
+		limit = int(sync.Limit.NResults)
+	}
+	return limit, nil
+}
+
+// NewSyncCollectionMultiStatus builds the response to a sync-collection
+// REPORT request on the collection at path. updated contains the responses
+// for the updated members, and deleted the paths of the deleted ones. If
+// truncated is set, a 507 Insufficient Storage response for the collection is
+// appended, as defined in RFC 6578 section 3.6.
+func NewSyncCollectionMultiStatus(path, syncToken string, updated []Response, deleted []string, truncated bool) *MultiStatus {
+	resps := updated
+	for _, p := range deleted {
+		resps = append(resps, Response{
+			Hrefs:  []Href{{Path: p}},
+			Status: &Status{Code: http.StatusNotFound},
+		})
+	}
+	if truncated {
+		resps = append(resps, Response{
+			Hrefs:  []Href{{Path: path}},
+			Status: &Status{Code: http.StatusInsufficientStorage},
+		})
+	}
+
+	ms := NewMultiStatus(resps...)
+	ms.SyncToken = syncToken
+	return ms
+}
+
+// PatchDeadProp sets or removes an arbitrary property in a list of dead
+// properties stored by a backend.
+func PatchDeadProp(props *[]Property, raw *RawXMLValue, remove bool) error {
+	name, _ := raw.XMLName()
+
+	// Don't modify the slice in-place, it may be owned by the backend
+	var l []Property
+	for _, prop := range *props {
+		if prop.XMLName != name {
+			l = append(l, prop)
+		}
+	}
+
+	if !remove {
+		b, err := xml.Marshal(raw)
+		if err != nil {
+			return err
+		}
+		l = append(l, Property{XMLName: name, Raw: b})
+	}
+
+	*props = l
+	return nil
+}
+
 func (h *Handler) handleProppatch(w http.ResponseWriter, r *http.Request) error {
 	var update PropertyUpdate
 	if err := DecodeXMLRequest(r, &update); err != nil {
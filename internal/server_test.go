@@ -0,0 +1,102 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/xml"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const examplePropertyUpdateStr = `<?xml version="1.0" encoding="utf-8" ?>
+<D:propertyupdate xmlns:D="DAV:" xmlns:Z="http://ns.example.com/z/">
+  <D:set>
+    <D:prop><Z:a>1</Z:a><Z:b>1</Z:b></D:prop>
+  </D:set>
+  <D:remove>
+    <D:prop><Z:a/></D:prop>
+  </D:remove>
+  <Z:unknown/>
+  <D:set>
+    <D:prop><Z:b>2</Z:b></D:prop>
+  </D:set>
+</D:propertyupdate>`
+
+func TestNewPropPatchResponse_order(t *testing.T) {
+	var update PropertyUpdate
+	if err := xml.NewDecoder(strings.NewReader(examplePropertyUpdateStr)).Decode(&update); err != nil {
+		t.Fatalf("Decode() = %v", err)
+	}
+
+	type op struct {
+		name   string
+		remove bool
+	}
+	var ops []op
+	var props []Property
+	patch := func(raw *RawXMLValue, remove bool) error {
+		name, _ := raw.XMLName()
+		ops = append(ops, op{name.Local, remove})
+		return PatchDeadProp(&props, raw, remove)
+	}
+	committed := false
+	commit := func() error {
+		committed = true
+		return nil
+	}
+
+	resp, err := NewPropPatchResponse("/file", &update, patch, commit)
+	if err != nil {
+		t.Fatalf("NewPropPatchResponse() = %v", err)
+	}
+
+	expected := []op{{"a", false}, {"b", false}, {"a", true}, {"b", false}}
+	if !reflect.DeepEqual(ops, expected) {
+		t.Errorf("instructions applied as %v, expected %v", ops, expected)
+	}
+	if !committed {
+		t.Errorf("changes weren't committed")
+	}
+	if len(props) != 1 || props[0].XMLName.Local != "b" {
+		t.Fatalf("properties = %v, expected b", props)
+	}
+	if v, err := props[0].Text(); err != nil || v != "2" {
+		t.Errorf("property b = %q, %v, expected %q", v, err, "2")
+	}
+
+	for _, ps := range resp.PropStats {
+		if ps.Status.Code != http.StatusOK {
+			t.Errorf("property status = %v, expected %v", ps.Status.Code, http.StatusOK)
+		}
+	}
+}
+
+func TestPropertyUpdate_roundTrip(t *testing.T) {
+	a := NewRawXMLElement(xml.Name{"http://ns.example.com/z/", "a"}, nil, nil)
+	b := NewRawXMLElement(xml.Name{"http://ns.example.com/z/", "b"}, nil, nil)
+	update := PropertyUpdate{Instructions: []PropertyUpdateInstruction{
+		NewSetInstruction(Prop{Raw: []RawXMLValue{*a}}),
+		NewRemoveInstruction(Prop{Raw: []RawXMLValue{*a}}),
+		NewSetInstruction(Prop{Raw: []RawXMLValue{*b}}),
+	}}
+
+	var buf bytes.Buffer
+	if err := xml.NewEncoder(&buf).Encode(&update); err != nil {
+		t.Fatalf("Encode() = %v", err)
+	}
+
+	var decoded PropertyUpdate
+	if err := xml.NewDecoder(&buf).Decode(&decoded); err != nil {
+		t.Fatalf("Decode() = %v", err)
+	}
+	var got []string
+	for _, inst := range decoded.Instructions {
+		name, _ := inst.Prop.Raw[0].XMLName()
+		got = append(got, inst.XMLName.Local+" "+name.Local)
+	}
+	expected := []string{"set a", "remove a", "set b"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("decoded instructions = %v, expected %v", got, expected)
+	}
+}
@@ -65,6 +65,9 @@ func (val *RawXMLValue) MarshalXML(e *xml.Encoder, start xml.StartElement) error
 
 	switch tok := val.tok.(type) {
 	case xml.StartElement:
+		// Namespace declarations are emitted by the encoder, drop the ones
+		// copied from the decoded document to avoid duplicates
+		tok.Attr = stripNamespaceAttrs(tok.Attr)
 		if err := e.EncodeToken(tok); err != nil {
 			return err
 		}
@@ -82,6 +85,17 @@ func (val *RawXMLValue) MarshalXML(e *xml.Encoder, start xml.StartElement) error
 	}
 }
 
+func stripNamespaceAttrs(attrs []xml.Attr) []xml.Attr {
+	var l []xml.Attr
+	for _, attr := range attrs {
+		if attr.Name.Space == "xmlns" || (attr.Name.Space == "" && attr.Name.Local == "xmlns") {
+			continue
+		}
+		l = append(l, attr)
+	}
+	return l
+}
+
 var _ xml.Marshaler = (*RawXMLValue)(nil)
 var _ xml.Unmarshaler = (*RawXMLValue)(nil)
 
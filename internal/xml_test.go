@@ -41,6 +41,32 @@ func TestRawXMLValue(t *testing.T) {
 	}
 }
 
+const rawNamespacedXML = `<oc:fileid xmlns:oc="http://owncloud.org/ns" xmlns="DAV:"><oc:id>42</oc:id><href>/</href></oc:fileid>`
+
+func TestRawXMLValue_namespaces(t *testing.T) {
+	var rawValue RawXMLValue
+	if err := xml.Unmarshal([]byte(rawNamespacedXML), &rawValue); err != nil {
+		t.Fatalf("xml.Unmarshal() = %v", err)
+	}
+
+	b, err := xml.Marshal(&rawValue)
+	if err != nil {
+		t.Fatalf("xml.Marshal() = %v", err)
+	}
+
+	var v struct {
+		XMLName xml.Name `xml:"http://owncloud.org/ns fileid"`
+		ID      string   `xml:"http://owncloud.org/ns id"`
+		Href    string   `xml:"DAV: href"`
+	}
+	if err := xml.Unmarshal(b, &v); err != nil {
+		t.Fatalf("xml.Unmarshal() = %v, output:\n%v", err, string(b))
+	}
+	if v.ID != "42" || v.Href != "/" {
+		t.Errorf("namespaced values don't round-trip, output:\n%v", string(b))
+	}
+}
+
 func TestRawXMLValue_TokenReader(t *testing.T) {
 	var rawValue RawXMLValue
 	if err := xml.Unmarshal([]byte(rawXML), &rawValue); err != nil {
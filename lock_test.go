@@ -0,0 +1,271 @@
+package webdav
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-webdav/internal"
+)
+
+const testLockToken = "urn:uuid:e71d4fae-5dec-22d6-fea5-00a0c91e6be4"
+
+// testLockServer is a minimal server holding a single exclusive lock.
+type testLockServer struct {
+	mu       sync.Mutex
+	timeout  string
+	owner    string
+	requests []*http.Request
+	// refreshed receives a value for each successful refresh, if non-nil
+	refreshed chan struct{}
+	// maxRefreshes is the number of refreshes which succeed, if positive
+	maxRefreshes int
+	refreshes    int
+}
+
+func (s *testLockServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests = append(s.requests, r)
+
+	switch r.Method {
+	case "LOCK":
+		if r.Header.Get("If") != "" {
+			if r.Header.Get("If") != "(<"+testLockToken+">)" {
+				http.Error(w, "unknown lock token", http.StatusPreconditionFailed)
+				return
+			}
+			if s.maxRefreshes > 0 && s.refreshes >= s.maxRefreshes {
+				http.Error(w, "lock expired", http.StatusPreconditionFailed)
+				return
+			}
+			s.refreshes++
+			if s.refreshed != nil {
+				s.refreshed <- struct{}{}
+			}
+		} else {
+			var info internal.LockInfo
+			if err := xml.NewDecoder(r.Body).Decode(&info); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if info.LockType.Write == nil || info.LockScope.Exclusive == nil {
+				http.Error(w, "unsupported lock", http.StatusBadRequest)
+				return
+			}
+			if info.Owner != nil {
+				s.owner = info.Owner.Text
+			}
+			w.Header().Set("Lock-Token", "<"+testLockToken+">")
+		}
+
+		timeout := r.Header.Get("Timeout")
+		if timeout == "" {
+			timeout = s.timeout
+		}
+		depth := r.Header.Get("Depth")
+		if depth == "" {
+			depth = "infinity"
+		}
+
+		w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+		fmt.Fprintf(w, `<?xml version="1.0" encoding="utf-8"?>
+<D:prop xmlns:D="DAV:">
+  <D:lockdiscovery>
+    <D:activelock>
+      <D:locktype><D:write/></D:locktype>
+      <D:lockscope><D:exclusive/></D:lockscope>
+      <D:depth>%v</D:depth>
+      <D:owner>%v</D:owner>
+      <D:timeout>%v</D:timeout>
+      <D:locktoken><D:href>%v</D:href></D:locktoken>
+      <D:lockroot><D:href>%v</D:href></D:lockroot>
+    </D:activelock>
+  </D:lockdiscovery>
+</D:prop>`, depth, s.owner, timeout, testLockToken, r.URL.Path)
+	case "UNLOCK":
+		if r.Header.Get("Lock-Token") != "<"+testLockToken+">" {
+			http.Error(w, "unknown lock token", http.StatusConflict)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodPut, http.MethodDelete:
+		if r.Header.Get("If") == "" {
+			http.Error(w, "missing lock token", http.StatusLocked)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "unsupported method", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *testLockServer) lastRequest() *http.Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[len(s.requests)-1]
+}
+
+func isPreconditionFailed(err error) bool {
+	var httpErr *internal.HTTPError
+	return errors.As(err, &httpErr) && httpErr.Code == http.StatusPreconditionFailed
+}
+
+func TestClient_Lock(t *testing.T) {
+	ctx := context.Background()
+	s := &testLockServer{timeout: "Infinite"}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	c, err := NewClient(nil, srv.URL)
+	if err != nil {
+		t.Fatalf("NewClient() = %v", err)
+	}
+
+	lock, err := c.Lock(ctx, "/file", &LockOptions{
+		Depth:   DepthInfinity,
+		Timeout: 90 * time.Second,
+		Owner:   "alice",
+	})
+	if err != nil {
+		t.Fatalf("Lock() = %v", err)
+	}
+	expected := &Lock{
+		Token:   testLockToken,
+		Root:    "/file",
+		Scope:   LockScopeExclusive,
+		Depth:   DepthInfinity,
+		Timeout: 90 * time.Second,
+		Owner:   "alice",
+	}
+	if !reflect.DeepEqual(lock, expected) {
+		t.Errorf("Lock() = %+v, expected %+v", lock, expected)
+	}
+	req := s.lastRequest()
+	if h := req.Header.Get("Timeout"); h != "Second-90" {
+		t.Errorf("LOCK request Timeout = %q, expected %q", h, "Second-90")
+	}
+	if h := req.Header.Get("Depth"); h != "infinity" {
+		t.Errorf("LOCK request Depth = %q, expected %q", h, "infinity")
+	}
+
+	if _, err := c.Lock(ctx, "/file", &LockOptions{Depth: 1}); err == nil {
+		t.Errorf("Lock() with depth 1 succeeded")
+	}
+
+	lock, err = c.RefreshLock(ctx, "/file", lock.Token, 0)
+	if err != nil {
+		t.Fatalf("RefreshLock() = %v", err)
+	}
+	if lock.Token != testLockToken || lock.Timeout != 0 {
+		t.Errorf("RefreshLock() = %+v, expected token %q and no timeout", lock, testLockToken)
+	}
+	if h := s.lastRequest().Header.Get("Timeout"); h != "" {
+		t.Errorf("refresh request Timeout = %q, expected none", h)
+	}
+
+	if _, err := c.RefreshLock(ctx, "/file", "urn:uuid:unknown", 0); !isPreconditionFailed(err) {
+		t.Errorf("RefreshLock() with unknown token = %v, expected precondition failed", err)
+	}
+
+	wc, err := c.CreateWithOptions(ctx, "/file", &CreateOptions{LockToken: lock.Token})
+	if err != nil {
+		t.Fatalf("CreateWithOptions() = %v", err)
+	}
+	if err := wc.Close(); err != nil {
+		t.Fatalf("Close() = %v", err)
+	}
+	if err := c.RemoveAllWithOptions(ctx, "/file", &RemoveAllOptions{LockToken: lock.Token}); err != nil {
+		t.Fatalf("RemoveAllWithOptions() = %v", err)
+	}
+	expectedIf := fmt.Sprintf("<%v/file> (<%v>)", srv.URL, testLockToken)
+	if h := s.lastRequest().Header.Get("If"); h != expectedIf {
+		t.Errorf("DELETE request If = %q, expected %q", h, expectedIf)
+	}
+
+	if err := c.Unlock(ctx, "/file", lock.Token); err != nil {
+		t.Fatalf("Unlock() = %v", err)
+	}
+	if err := c.Unlock(ctx, "/file", "urn:uuid:unknown"); err == nil {
+		t.Errorf("Unlock() with unknown token succeeded")
+	}
+}
+
+func TestClient_KeepLockAlive(t *testing.T) {
+	s := &testLockServer{
+		timeout:      "Second-1",
+		refreshed:    make(chan struct{}, 1),
+		maxRefreshes: 1,
+	}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	c, err := NewClient(nil, srv.URL)
+	if err != nil {
+		t.Fatalf("NewClient() = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	lock, err := c.Lock(ctx, "/file", nil)
+	if err != nil {
+		t.Fatalf("Lock() = %v", err)
+	}
+	done := c.KeepLockAlive(ctx, "/file", lock)
+
+	select {
+	case <-s.refreshed:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("lock wasn't refreshed")
+	}
+
+	// The second refresh fails
+	select {
+	case err, ok := <-done:
+		if !ok || !isPreconditionFailed(err) {
+			t.Errorf("KeepLockAlive() = %v, expected precondition failed", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("KeepLockAlive() didn't report the refresh failure")
+	}
+	if _, ok := <-done; ok {
+		t.Errorf("KeepLockAlive() channel not closed after failure")
+	}
+}
+
+func TestClient_KeepLockAlive_cancel(t *testing.T) {
+	s := &testLockServer{timeout: "Second-3600"}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	c, err := NewClient(nil, srv.URL)
+	if err != nil {
+		t.Fatalf("NewClient() = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	lock, err := c.Lock(ctx, "/file", nil)
+	if err != nil {
+		t.Fatalf("Lock() = %v", err)
+	}
+	done := c.KeepLockAlive(ctx, "/file", lock)
+	cancel()
+
+	select {
+	case err, ok := <-done:
+		if ok {
+			t.Errorf("KeepLockAlive() = %v after cancellation, expected channel to be closed", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("KeepLockAlive() still running after cancellation")
+	}
+}
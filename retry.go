@@ -0,0 +1,134 @@
+package webdav
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RetryOptions contains options for HTTPClientWithRetry.
+type RetryOptions struct {
+	// MaxRetries is the maximum number of times a request is retried. If
+	// zero, 3 is used. If negative, requests aren't retried.
+	MaxRetries int
+	// MinBackoff is the delay before the first retry. It's doubled after each
+	// attempt. If zero, 1 second is used.
+	MinBackoff time.Duration
+	// MaxBackoff is the maximum delay between two attempts, including delays
+	// requested by the server via Retry-After. If zero, 30 seconds is used.
+	MaxBackoff time.Duration
+}
+
+type retryHTTPClient struct {
+	c       HTTPClient
+	options RetryOptions
+}
+
+func isIdempotentMethod(method string) bool {
+	switch strings.ToUpper(method) {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, "PROPFIND", "REPORT":
+		return true
+	}
+	return false
+}
+
+func isRetryableStatus(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// parseRetryAfter parses a Retry-After header, as defined in RFC 7231 section
+// 7.1.3. It returns false if the header is missing or invalid. Dates in the
+// past result in a zero delay.
+func parseRetryAfter(s string, now time.Time) (time.Duration, bool) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, false
+	}
+	if sec, err := strconv.ParseUint(s, 10, 32); err == nil {
+		return time.Duration(sec) * time.Second, true
+	}
+	if t, err := http.ParseTime(s); err == nil {
+		if !t.After(now) {
+			return 0, true
+		}
+		return t.Sub(now), true
+	}
+	return 0, false
+}
+
+func (c *retryHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	if !isIdempotentMethod(req.Method) {
+		return c.c.Do(req)
+	}
+
+	backoff := c.options.MinBackoff
+	for attempt := 0; ; attempt++ {
+		var next *http.Request
+		if attempt < c.options.MaxRetries {
+			next = replayRequest(req)
+		}
+
+		resp, err := c.c.Do(req)
+		if err != nil || !isRetryableStatus(resp.StatusCode) || next == nil {
+			return resp, err
+		}
+
+		delay, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+		if !ok {
+			delay = backoff
+		}
+		if delay > c.options.MaxBackoff {
+			delay = c.options.MaxBackoff
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			discardResponse(resp)
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+		discardResponse(resp)
+
+		req = next
+		backoff *= 2
+	}
+}
+
+// HTTPClientWithRetry returns an HTTP client that retries idempotent requests
+// (GET, HEAD, OPTIONS, PROPFIND and REPORT) when the server replies with 429
+// Too Many Requests, 502 Bad Gateway, 503 Service Unavailable or 504 Gateway
+// Timeout. The Retry-After header is honored, otherwise an exponential backoff
+// is used. If the request context is cancelled while waiting, its error is
+// returned.
+//
+// Requests are only retried if their body can be replayed (see
+// http.Request.GetBody). If c is nil, a default client is used. If options
+// is nil, defaults are used.
+func HTTPClientWithRetry(c HTTPClient, options *RetryOptions) HTTPClient {
+	if c == nil {
+		c = defaultHTTPClient
+	}
+
+	var opts RetryOptions
+	if options != nil {
+		opts = *options
+	}
+	if opts.MaxRetries == 0 {
+		opts.MaxRetries = 3
+	}
+	if opts.MinBackoff == 0 {
+		opts.MinBackoff = time.Second
+	}
+	if opts.MaxBackoff == 0 {
+		opts.MaxBackoff = 30 * time.Second
+	}
+
+	return &retryHTTPClient{c, opts}
+}
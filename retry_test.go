@@ -0,0 +1,207 @@
+package webdav
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2015, 10, 21, 7, 28, 0, 0, time.UTC)
+	tests := []struct {
+		s     string
+		delay time.Duration
+		ok    bool
+	}{
+		{"", 0, false},
+		{"0", 0, true},
+		{"120", 2 * time.Minute, true},
+		{" 5 ", 5 * time.Second, true},
+		{"Wed, 21 Oct 2015 07:30:00 GMT", 2 * time.Minute, true},
+		// Dates in the past mean no delay
+		{"Wed, 21 Oct 2015 07:00:00 GMT", 0, true},
+		{"-1", 0, false},
+		{"soon", 0, false},
+	}
+	for _, tc := range tests {
+		if delay, ok := parseRetryAfter(tc.s, now); delay != tc.delay || ok != tc.ok {
+			t.Errorf("parseRetryAfter(%q) = %v, %v, expected %v, %v", tc.s, delay, ok, tc.delay, tc.ok)
+		}
+	}
+}
+
+func TestHTTPClientWithRetry(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		method   string
+		status   int
+		requests int
+	}{
+		{"429", "PROPFIND", http.StatusTooManyRequests, 3},
+		{"500", "PROPFIND", http.StatusInternalServerError, 1},
+		{"502", "REPORT", http.StatusBadGateway, 3},
+		{"503", "GET", http.StatusServiceUnavailable, 3},
+		{"504", "PROPFIND", http.StatusGatewayTimeout, 3},
+		{"501", "PROPFIND", http.StatusNotImplemented, 1},
+		{"404", "PROPFIND", http.StatusNotFound, 1},
+		{"put", http.MethodPut, http.StatusServiceUnavailable, 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var bodies []string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				b, _ := ioutil.ReadAll(r.Body)
+				bodies = append(bodies, string(b))
+				// Succeed on the third attempt
+				if len(bodies) < 3 {
+					w.WriteHeader(tc.status)
+				}
+			}))
+			defer srv.Close()
+
+			c := HTTPClientWithRetry(nil, &RetryOptions{MinBackoff: time.Millisecond})
+			req, err := http.NewRequest(tc.method, srv.URL, strings.NewReader("<propfind/>"))
+			if err != nil {
+				t.Fatalf("NewRequest() = %v", err)
+			}
+			resp, err := c.Do(req)
+			if err != nil {
+				t.Fatalf("Do() = %v", err)
+			}
+			resp.Body.Close()
+
+			if len(bodies) != tc.requests {
+				t.Fatalf("server got %v requests, expected %v", len(bodies), tc.requests)
+			}
+			for i, b := range bodies {
+				if b != "<propfind/>" {
+					t.Errorf("request %v has body %q, expected it to be replayed", i, b)
+				}
+			}
+			if tc.requests == 3 && resp.StatusCode != http.StatusOK {
+				t.Errorf("Do() status = %v, expected 200", resp.StatusCode)
+			} else if tc.requests == 1 && resp.StatusCode != tc.status {
+				t.Errorf("Do() status = %v, expected %v", resp.StatusCode, tc.status)
+			}
+		})
+	}
+}
+
+func TestHTTPClientWithRetry_maxRetries(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		// Capped by MaxBackoff
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	c := HTTPClientWithRetry(nil, &RetryOptions{MaxRetries: 2, MaxBackoff: time.Millisecond})
+	req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+	if err != nil {
+		t.Fatalf("NewRequest() = %v", err)
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		t.Fatalf("Do() = %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Do() status = %v, expected 503", resp.StatusCode)
+	}
+	if requests != 3 {
+		t.Errorf("server got %v requests, expected 3", requests)
+	}
+}
+
+func TestHTTPClientWithRetry_cancel(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	c := HTTPClientWithRetry(nil, &RetryOptions{MaxBackoff: time.Hour})
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	if err != nil {
+		t.Fatalf("NewRequest() = %v", err)
+	}
+
+	start := time.Now()
+	resp, err := c.Do(req)
+	if err != context.DeadlineExceeded {
+		t.Errorf("Do() = %v, %v, expected %v", resp, err, context.DeadlineExceeded)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("Do() returned after %v, expected the backoff to be interrupted", d)
+	}
+	if requests != 1 {
+		t.Errorf("server got %v requests, expected 1", requests)
+	}
+}
+
+func TestHTTPClientWithRetry_disabled(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	c := HTTPClientWithRetry(nil, &RetryOptions{MaxRetries: -1, MinBackoff: time.Millisecond})
+	req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+	if err != nil {
+		t.Fatalf("NewRequest() = %v", err)
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		t.Fatalf("Do() = %v", err)
+	}
+	resp.Body.Close()
+
+	if requests != 1 {
+		t.Errorf("server got %v requests, expected 1", requests)
+	}
+}
+
+func TestHTTPClientWithRetry_retryAfterZero(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	// The backoff would exceed the test timeout if it was used
+	c := HTTPClientWithRetry(nil, &RetryOptions{MinBackoff: time.Hour, MaxBackoff: time.Hour})
+	req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+	if err != nil {
+		t.Fatalf("NewRequest() = %v", err)
+	}
+	start := time.Now()
+	resp, err := c.Do(req)
+	if err != nil {
+		t.Fatalf("Do() = %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || requests != 2 {
+		t.Errorf("Do() status = %v after %v requests, expected 200 after 2", resp.StatusCode, requests)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("Do() returned after %v, expected an immediate retry", d)
+	}
+}
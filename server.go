@@ -262,7 +262,7 @@ func (b *backend) Copy(
 	}
 	created, err = b.FileSystem.Copy(r.Context(), r.URL.Path, dest.Path, &options)
 	if os.IsExist(err) {
-		return false, &internal.HTTPError{http.StatusPreconditionFailed, err}
+		return false, &internal.HTTPError{Code: http.StatusPreconditionFailed, Err: err}
 	}
 	return created, err
 }
@@ -277,7 +277,7 @@ func (b *backend) Move(
 	}
 	created, err = b.FileSystem.Move(r.Context(), r.URL.Path, dest.Path, &options)
 	if os.IsExist(err) {
-		return false, &internal.HTTPError{http.StatusPreconditionFailed, err}
+		return false, &internal.HTTPError{Code: http.StatusPreconditionFailed, Err: err}
 	}
 	return created, err
 }
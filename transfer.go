@@ -0,0 +1,114 @@
+package webdav
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// ProgressFunc is called during a transfer with the number of bytes
+// transferred so far and the total number of bytes. total is -1 if unknown.
+type ProgressFunc func(done, total int64)
+
+// RateLimiter limits the bandwidth of transfers. A single RateLimiter can be
+// shared across multiple concurrent transfers, in which case the limit
+// applies to their combined bandwidth.
+type RateLimiter struct {
+	rate  float64 // bytes per second
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter creates a new rate limiter allowing up to bytesPerSecond
+// bytes per second.
+func NewRateLimiter(bytesPerSecond int64) *RateLimiter {
+	if bytesPerSecond <= 0 {
+		panic("webdav: rate limit must be positive")
+	}
+	return &RateLimiter{
+		rate:   float64(bytesPerSecond),
+		burst:  float64(bytesPerSecond),
+		tokens: float64(bytesPerSecond),
+		last:   time.Now(),
+	}
+}
+
+// maxChunk returns the maximum number of bytes a single transfer step should
+// process.
+func (rl *RateLimiter) maxChunk() int {
+	return int(rl.burst)
+}
+
+// wait blocks until n bytes can be transferred.
+func (rl *RateLimiter) wait(ctx context.Context, n int) error {
+	rl.mu.Lock()
+	now := time.Now()
+	rl.tokens += now.Sub(rl.last).Seconds() * rl.rate
+	if rl.tokens > rl.burst {
+		rl.tokens = rl.burst
+	}
+	rl.last = now
+	// Reserve the tokens right away, so that concurrent transfers queue up
+	rl.tokens -= float64(n)
+	deficit := -rl.tokens
+	rl.mu.Unlock()
+
+	if deficit <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(time.Duration(deficit / rl.rate * float64(time.Second)))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// transferReader wraps a reader to report progress and limit bandwidth.
+type transferReader struct {
+	r        io.Reader
+	ctx      context.Context
+	done     int64
+	total    int64
+	progress ProgressFunc
+	limiter  *RateLimiter
+}
+
+func newTransferReader(ctx context.Context, r io.Reader, total int64, progress ProgressFunc, limiter *RateLimiter) io.Reader {
+	if progress == nil && limiter == nil {
+		return r
+	}
+	return &transferReader{r: r, ctx: ctx, total: total, progress: progress, limiter: limiter}
+}
+
+func (tr *transferReader) Read(b []byte) (int, error) {
+	if tr.limiter != nil && len(b) > tr.limiter.maxChunk() {
+		b = b[:tr.limiter.maxChunk()]
+	}
+
+	n, err := tr.r.Read(b)
+	if n > 0 {
+		if tr.limiter != nil {
+			if waitErr := tr.limiter.wait(tr.ctx, n); waitErr != nil {
+				return n, waitErr
+			}
+		}
+		tr.done += int64(n)
+		if tr.progress != nil {
+			tr.progress(tr.done, tr.total)
+		}
+	}
+	return n, err
+}
+
+type transferReadCloser struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,132 @@
+package webdav
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClient_Create_progress(t *testing.T) {
+	var received string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		received = string(b)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer srv.Close()
+
+	c, err := NewClient(nil, srv.URL)
+	if err != nil {
+		t.Fatalf("NewClient() = %v", err)
+	}
+
+	data := strings.Repeat("x", 1000)
+	var lastDone, lastTotal int64
+	wc, err := c.CreateWithOptions(context.Background(), "/file", &CreateOptions{
+		ContentLength: int64(len(data)),
+		Progress: func(done, total int64) {
+			lastDone, lastTotal = done, total
+		},
+	})
+	if err != nil {
+		t.Fatalf("Create() = %v", err)
+	}
+	if _, err := io.WriteString(wc, data); err != nil {
+		t.Fatalf("Write() = %v", err)
+	}
+	if err := wc.Close(); err != nil {
+		t.Fatalf("Close() = %v", err)
+	}
+
+	if received != data {
+		t.Errorf("server received %v bytes, expected %v", len(received), len(data))
+	}
+	if lastDone != int64(len(data)) || lastTotal != int64(len(data)) {
+		t.Errorf("last progress = %v/%v, expected %v/%v", lastDone, lastTotal, len(data), len(data))
+	}
+}
+
+func TestClient_Create_cancel(t *testing.T) {
+	// The server never reads the body, so writes block until cancellation
+	block := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-block
+	}))
+	defer srv.Close()
+	defer close(block)
+
+	c, err := NewClient(nil, srv.URL)
+	if err != nil {
+		t.Fatalf("NewClient() = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	wc, err := c.Create(ctx, "/file")
+	if err != nil {
+		t.Fatalf("Create() = %v", err)
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		buf := make([]byte, 1<<20)
+		for {
+			if _, err := wc.Write(buf); err != nil {
+				errCh <- err
+				return
+			}
+		}
+	}()
+
+	cancel()
+	select {
+	case err := <-errCh:
+		if err == nil {
+			t.Errorf("Write() succeeded after cancellation")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Write() still blocked after cancellation")
+	}
+	if err := wc.Close(); err == nil {
+		t.Errorf("Close() succeeded after cancellation")
+	}
+}
+
+func TestClient_OpenWithOptions_progress(t *testing.T) {
+	data := strings.Repeat("x", 1000)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, data)
+	}))
+	defer srv.Close()
+
+	c, err := NewClient(nil, srv.URL)
+	if err != nil {
+		t.Fatalf("NewClient() = %v", err)
+	}
+
+	var lastDone, lastTotal int64
+	rc, err := c.OpenWithOptions(context.Background(), "/file", &OpenOptions{
+		Progress: func(done, total int64) {
+			lastDone, lastTotal = done, total
+		},
+	})
+	if err != nil {
+		t.Fatalf("OpenWithOptions() = %v", err)
+	}
+	b, err := ioutil.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		t.Fatalf("ReadAll() = %v", err)
+	}
+
+	if string(b) != data {
+		t.Errorf("read %v bytes, expected %v", len(b), len(data))
+	}
+	if lastDone != int64(len(data)) || lastTotal != int64(len(data)) {
+		t.Errorf("last progress = %v/%v, expected %v/%v", lastDone, lastTotal, len(data), len(data))
+	}
+}
@@ -4,6 +4,7 @@
 package webdav
 
 import (
+	"encoding/xml"
 	"time"
 
 	"github.com/emersion/go-webdav/internal"
@@ -19,13 +20,132 @@ type FileInfo struct {
 	ETag     string
 }
 
+// Depth indicates whether a request applies to the resource's members. It's
+// defined in RFC 4918 section 10.2.
+type Depth = internal.Depth
+
+const (
+	// DepthZero indicates that the request applies only to the resource.
+	DepthZero = internal.DepthZero
+	// DepthOne indicates that the request applies to the resource and its
+	// internal members only.
+	DepthOne = internal.DepthOne
+	// DepthInfinity indicates that the request applies to the resource and all
+	// of its members.
+	DepthInfinity = internal.DepthInfinity
+)
+
+// Property is a WebDAV property.
+type Property = internal.Property
+
+// NewTextProperty creates a new property with a text value.
+func NewTextProperty(name xml.Name, value string) Property {
+	v := struct {
+		XMLName xml.Name
+		Value   string `xml:",chardata"`
+	}{name, value}
+	b, err := xml.Marshal(&v)
+	if err != nil {
+		panic(err) // can't happen
+	}
+	return Property{XMLName: name, Raw: b}
+}
+
+// PropResponse holds the properties of a single resource returned by
+// PROPFIND or PROPPATCH.
+type PropResponse struct {
+	Path  string
+	Props map[xml.Name]Property
+}
+
+// HTTPError is an error associated with an HTTP status code.
+//
+// Client methods return an *HTTPError when the server replies with a non-2xx
+// status. Precondition and postcondition elements sent by the server in a
+// DAV:error body are available in Conditions.
+type HTTPError = internal.HTTPError
+
+// OpenOptions contains options for Client.OpenWithOptions.
+type OpenOptions struct {
+	// Progress, if non-nil, is called as the file is downloaded.
+	Progress ProgressFunc
+	// RateLimiter, if non-nil, limits the download bandwidth.
+	RateLimiter *RateLimiter
+}
+
+// CreateOptions contains options for Client.CreateWithOptions.
+type CreateOptions struct {
+	// LockToken is the token of a lock held on the file, if any.
+	LockToken string
+	// ContentLength is the size of the file, if known in advance. It's sent
+	// to the server and reported to Progress.
+	ContentLength int64
+	// Progress, if non-nil, is called as the file is uploaded.
+	Progress ProgressFunc
+	// RateLimiter, if non-nil, limits the upload bandwidth.
+	RateLimiter *RateLimiter
+}
+
+// RemoveAllOptions contains options for Client.RemoveAllWithOptions.
+type RemoveAllOptions struct {
+	// LockToken is the token of a lock held on the file, if any.
+	LockToken string
+}
+
 type CopyOptions struct {
 	NoRecursive bool
 	NoOverwrite bool
+	// DestinationLockToken is the token of a lock held on the destination,
+	// if any.
+	DestinationLockToken string
 }
 
 type MoveOptions struct {
 	NoOverwrite bool
+	// LockToken is the token of a lock held on the source, if any.
+	LockToken string
+	// DestinationLockToken is the token of a lock held on the destination,
+	// if any.
+	DestinationLockToken string
+}
+
+// LockScope is the scope of a lock.
+type LockScope int
+
+const (
+	// LockScopeExclusive indicates that only a single principal can hold a
+	// lock on the resource.
+	LockScopeExclusive LockScope = iota
+	// LockScopeShared indicates that multiple principals can hold a lock on
+	// the resource.
+	LockScopeShared
+)
+
+// LockOptions contains options for Client.Lock.
+type LockOptions struct {
+	Scope LockScope
+	// Depth is either DepthZero or DepthInfinity. DepthInfinity locks all
+	// members of a collection as well.
+	Depth Depth
+	// Timeout is the requested lock timeout. If zero, the server default is
+	// used. Servers may grant a different timeout.
+	Timeout time.Duration
+	// Owner describes the lock owner, e.g. a name or a URL.
+	Owner string
+}
+
+// Lock is a write lock on a resource, as described in RFC 4918 section 6.
+type Lock struct {
+	// Token is the lock token, e.g. "urn:uuid:…".
+	Token string
+	// Root is the path of the locked resource.
+	Root  string
+	Scope LockScope
+	Depth Depth
+	// Timeout is the duration after which the lock expires unless
+	// refreshed. Zero means the lock never expires.
+	Timeout time.Duration
+	Owner   string
 }
 
 // ConditionalMatch represents the value of a conditional header